@@ -141,13 +141,15 @@ CREATE TABLE qr_codes (
   id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT '二维码ID',
   park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
   type VARCHAR(20) NOT NULL COMMENT '类型: external-vehicle, internal-vehicle, non-road',
-  content TEXT NOT NULL COMMENT '二维码内容',
+  content VARCHAR(100) NOT NULL COMMENT '二维码内容令牌',
   is_enabled BOOLEAN DEFAULT TRUE COMMENT '是否启用',
   fields_config JSON COMMENT '字段配置',
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   
   FOREIGN KEY (park_id) REFERENCES parks(id) ON DELETE CASCADE,
+  UNIQUE INDEX idx_content (content),
+  UNIQUE INDEX idx_qr_codes_park_type (park_id, type),
   INDEX idx_park_id (park_id),
   INDEX idx_type (type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='二维码配置表';
@@ -197,14 +199,16 @@ CREATE TABLE external_vehicles (
   outbound_cargo_weight DECIMAL(10, 2) COMMENT '出货重量',
   
   -- 照片
-  vehicle_photo VARCHAR(500) COMMENT '车辆照片',
-  driving_license_photo VARCHAR(500) COMMENT '行驶证照片',
-  vehicle_list_photo VARCHAR(500) COMMENT '车辆清单照片',
+  attachments JSON COMMENT '照片附件: [{kind, key}]，kind 为 driving_license_main, driving_license_sub, vehicle_front, vehicle_list',
+
+  -- 证照识别
+  field_sources JSON COMMENT '字段来源: ocr, edited, manual',
   
   -- 审核与下发
-  audit_status VARCHAR(20) DEFAULT 'unaudited' COMMENT '审核状态: audited, unaudited',
+  audit_status VARCHAR(20) DEFAULT 'pending' COMMENT '审核状态: pending, approved, rejected, resubmitted',
+  audit_step INT DEFAULT 0 COMMENT '部门审核：本轮已通过的部门数',
   dispatch_status VARCHAR(20) DEFAULT 'undispatched' COMMENT '下发状态: dispatched, undispatched',
-  network_status VARCHAR(20) COMMENT '网络状态',
+  network_status VARCHAR(20) COMMENT '联网状态: online, pending, failed，由下发确认结果得出',
   dispatch_count INT DEFAULT 0 COMMENT '下发次数',
   dispatch_time DATETIME COMMENT '下发时间',
   
@@ -260,12 +264,10 @@ CREATE TABLE internal_vehicles (
   issue_date VARCHAR(20) COMMENT '签发日期',
   
   -- 照片
-  vehicle_list_photo VARCHAR(500) COMMENT '车辆清单照片',
-  driving_license_photo VARCHAR(500) COMMENT '行驶证照片',
-  vehicle_photo VARCHAR(500) COMMENT '车辆照片',
+  attachments JSON COMMENT '照片附件: [{kind, key}]，kind 为 driving_license_main, driving_license_sub, vehicle_front, vehicle_list',
   
   -- 联网与下发
-  network_status VARCHAR(20) COMMENT '网络状态',
+  network_status VARCHAR(20) COMMENT '联网状态: online, pending, failed，由下发确认结果得出',
   dispatch_status VARCHAR(20) DEFAULT 'undispatched' COMMENT '下发状态',
   dispatch_time DATETIME COMMENT '下发时间',
   
@@ -316,10 +318,7 @@ CREATE TABLE non_road_machineries (
   entry_date VARCHAR(20) COMMENT '进场日期',
   
   -- 照片
-  whole_machine_photo VARCHAR(500) COMMENT '整机铭牌照片',
-  engine_nameplate_photo VARCHAR(500) COMMENT '发动机铭牌照片',
-  environmental_label_photo VARCHAR(500) COMMENT '环保标签照片',
-  device_photo VARCHAR(500) COMMENT '设备照片',
+  attachments JSON COMMENT '照片附件: [{kind, key}]，kind 为 machine_nameplate, engine_nameplate, environmental_label, device',
   
   -- 下发
   dispatch_status VARCHAR(20) DEFAULT 'undispatched' COMMENT '下发状态',
@@ -346,8 +345,10 @@ CREATE TABLE non_road_machineries (
 CREATE TABLE plugin_auths (
   id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT '认证ID',
   park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
-  token VARCHAR(100) NOT NULL UNIQUE COMMENT '认证令牌',
+  token VARCHAR(100) NOT NULL UNIQUE COMMENT '会话令牌的SHA-256摘要',
   expires_at DATETIME NOT NULL COMMENT '过期时间',
+  protocol_version INT DEFAULT 1 COMMENT '验证时协商的协议版本',
+  encryption VARCHAR(20) DEFAULT 'none' COMMENT '载荷加密方式: none, aes-256-gcm',
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   
   FOREIGN KEY (park_id) REFERENCES parks(id) ON DELETE CASCADE,
@@ -357,6 +358,228 @@ CREATE TABLE plugin_auths (
   INDEX idx_expires_at (expires_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='PC端插件认证表';
 
+-- =====================================================
+-- 12. 二维码签发记录表 (QR Code Histories)
+-- =====================================================
+CREATE TABLE qr_code_histories (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT '记录ID',
+  qr_code_id BIGINT UNSIGNED NOT NULL COMMENT '二维码ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  type VARCHAR(20) NOT NULL COMMENT '类型: external-vehicle, internal-vehicle, non-road',
+  content VARCHAR(100) NOT NULL COMMENT '二维码内容令牌',
+  issued_at DATETIME NOT NULL COMMENT '签发时间',
+  revoked_at DATETIME NULL COMMENT '作废时间，为空表示当前有效',
+  rotated_by VARCHAR(50) COMMENT '更换该令牌的操作人',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  FOREIGN KEY (qr_code_id) REFERENCES qr_codes(id) ON DELETE CASCADE,
+
+  UNIQUE INDEX idx_content (content),
+  INDEX idx_qr_code_id (qr_code_id),
+  INDEX idx_park_id (park_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='二维码签发记录表';
+
+-- =====================================================
+-- 13. 旧二维码扫码记录表 (QR Code Scan Logs)
+-- =====================================================
+CREATE TABLE qr_code_scan_logs (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT '记录ID',
+  history_id BIGINT UNSIGNED NOT NULL COMMENT '签发记录ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  type VARCHAR(20) NOT NULL COMMENT '类型: external-vehicle, internal-vehicle, non-road',
+  content VARCHAR(100) NOT NULL COMMENT '扫描的旧令牌',
+  accepted BOOLEAN DEFAULT FALSE COMMENT '是否在宽限期内被接受',
+  client_ip VARCHAR(50) COMMENT '扫码客户端IP',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '扫码时间',
+
+  FOREIGN KEY (history_id) REFERENCES qr_code_histories(id) ON DELETE CASCADE,
+
+  INDEX idx_history_id (history_id),
+  INDEX idx_park_id (park_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='旧二维码扫码记录表';
+
+-- =====================================================
+-- 14. 台账同步变更日志表 (Sync Changes)
+-- =====================================================
+CREATE TABLE sync_changes (
+  seq BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT '变更序号，PC端插件增量拉取游标',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  data_type VARCHAR(20) NOT NULL COMMENT '台账类型: external-vehicle, internal-vehicle, non-road',
+  record_id BIGINT UNSIGNED NOT NULL COMMENT '台账记录ID',
+  op VARCHAR(10) NOT NULL COMMENT '操作: upsert, delete',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '变更时间',
+
+  INDEX idx_park_seq (park_id, seq)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='台账同步变更日志表';
+
+-- =====================================================
+-- 15. PC端插件请求随机数表 (Plugin Nonces)
+-- =====================================================
+CREATE TABLE plugin_nonces (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  nonce VARCHAR(64) NOT NULL COMMENT '请求随机数',
+  expires_at DATETIME NOT NULL COMMENT '过期时间，过期后清理',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  UNIQUE INDEX idx_park_nonce (park_id, nonce),
+  INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='PC端插件请求随机数表';
+
+-- =====================================================
+-- 16. 下发队列表 (Dispatch Items)
+-- =====================================================
+CREATE TABLE dispatch_items (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  data_type VARCHAR(20) NOT NULL COMMENT '台账类型: external-vehicle, internal-vehicle, non-road',
+  record_id BIGINT UNSIGNED NOT NULL COMMENT '台账记录ID',
+  version BIGINT DEFAULT 0 COMMENT '投递的记录版本',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT '状态: pending, delivered, dead',
+  attempts BIGINT DEFAULT 0 COMMENT '已投递次数',
+  next_attempt_at DATETIME COMMENT '下次可投递时间',
+  last_error VARCHAR(500) COMMENT '最近一次失败原因',
+  delivered_at DATETIME COMMENT '插件确认接收时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  INDEX idx_dispatch_park_status (park_id, status, next_attempt_at),
+  INDEX idx_record_id (record_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='下发队列表';
+
+-- =====================================================
+-- 17. PC端插件状态表 (Plugin Statuses)
+-- =====================================================
+CREATE TABLE plugin_statuses (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  plugin_version VARCHAR(50) COMMENT '插件版本',
+  host_name VARCHAR(100) COMMENT '主机名',
+  os VARCHAR(100) COMMENT '操作系统',
+  client_ip VARCHAR(50) COMMENT '客户端IP',
+  local_counts TEXT COMMENT '插件本地各类台账记录数（JSON）',
+  last_seen_at DATETIME COMMENT '最近一次心跳时间',
+  online_since DATETIME COMMENT '本次连续在线的开始时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  UNIQUE INDEX idx_park_id (park_id),
+  INDEX idx_last_seen_at (last_seen_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='PC端插件状态表';
+
+-- =====================================================
+-- 18. 自动审核规则表 (Audit Policies)
+-- =====================================================
+CREATE TABLE audit_policies (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  rules JSON COMMENT '自动审核规则配置',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  UNIQUE INDEX idx_park_id (park_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='自动审核规则表';
+
+-- =====================================================
+-- 19. 自动审核决定表 (Audit Decisions)
+-- =====================================================
+CREATE TABLE audit_decisions (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  vehicle_id BIGINT UNSIGNED NOT NULL COMMENT '厂外运输车辆ID',
+  decision VARCHAR(20) NOT NULL COMMENT '决定: approve, review, reject',
+  rule VARCHAR(50) COMMENT '决定性规则，全部通过时为空',
+  reason VARCHAR(500) COMMENT '决定原因',
+  results JSON COMMENT '各规则判定结果',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  INDEX idx_park_id (park_id),
+  INDEX idx_vehicle_id (vehicle_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='自动审核决定表';
+
+-- =====================================================
+-- 20. 车辆黑名单表 (Vehicle Blacklists)
+-- =====================================================
+CREATE TABLE vehicle_blacklists (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  license_plate VARCHAR(20) COMMENT '车牌号码',
+  vin VARCHAR(17) COMMENT '车辆识别代号',
+  reason VARCHAR(200) COMMENT '列入原因',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  INDEX idx_park_id (park_id),
+  INDEX idx_license_plate (license_plate),
+  INDEX idx_vin (vin)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='车辆黑名单表';
+
+-- =====================================================
+-- 21. 审核记录表 (Audit Records)
+-- =====================================================
+CREATE TABLE audit_records (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  vehicle_id BIGINT UNSIGNED NOT NULL COMMENT '厂外运输车辆ID',
+  action VARCHAR(20) NOT NULL COMMENT '审核操作: approve, reject, resubmit',
+  from_status VARCHAR(20) COMMENT '操作前审核状态',
+  to_status VARCHAR(20) COMMENT '操作后审核状态',
+  step INT DEFAULT 0 COMMENT '部门审核：本次审核的部门序号（从1开始），未启用部门审核时为0',
+  auto TINYINT(1) DEFAULT 0 COMMENT '是否为自动审核',
+  user_id BIGINT UNSIGNED COMMENT '审核人ID',
+  user_name VARCHAR(50) COMMENT '审核人',
+  department_id BIGINT UNSIGNED COMMENT '审核人所属部门ID',
+  department_name VARCHAR(50) COMMENT '审核人所属部门',
+  reason VARCHAR(500) COMMENT '审核理由',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',
+
+  INDEX idx_park_id (park_id),
+  INDEX idx_vehicle_id (vehicle_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='审核记录表';
+
+-- =====================================================
+-- 22. 证照识别记录表 (OCR Recognitions)
+-- =====================================================
+CREATE TABLE ocr_recognitions (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED DEFAULT 0 COMMENT '车场ID，识别时未指定为0',
+  kind VARCHAR(30) NOT NULL COMMENT '证照类型: driving_license, driving_license_back, nameplate',
+  provider VARCHAR(30) COMMENT '识别服务',
+  fields JSON COMMENT '规范化后的识别字段',
+  vehicle_id BIGINT UNSIGNED COMMENT '提交后关联的厂外运输车辆ID',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '识别时间',
+
+  INDEX idx_park_id (park_id),
+  INDEX idx_vehicle_id (vehicle_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='证照识别记录表';
+
+-- =====================================================
+-- 23. 导入任务表 (Import Jobs)
+-- =====================================================
+CREATE TABLE import_jobs (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY COMMENT 'ID',
+  park_id BIGINT UNSIGNED NOT NULL COMMENT '车场ID',
+  data_type VARCHAR(30) NOT NULL COMMENT '台账类型: external-vehicle, internal-vehicle, non-road',
+  file_name VARCHAR(200) COMMENT '上传的文件名',
+  source_key VARCHAR(512) COMMENT '上传文件的对象键',
+  headers JSON COMMENT '表头',
+  mapping JSON COMMENT '字段到表头的列映射',
+  status VARCHAR(20) COMMENT '状态: uploaded, running, validated, completed, failed',
+  dry_run BOOLEAN DEFAULT FALSE COMMENT '最近一次执行是否只校验',
+  total INT DEFAULT 0 COMMENT '数据行数',
+  processed INT DEFAULT 0 COMMENT '已处理行数',
+  succeeded INT DEFAULT 0 COMMENT '导入（校验通过）行数',
+  failed INT DEFAULT 0 COMMENT '未通过校验行数',
+  report_key VARCHAR(512) COMMENT '错误报告的对象键',
+  error VARCHAR(500) COMMENT '执行失败原因',
+  started_at DATETIME COMMENT '开始执行时间',
+  finished_at DATETIME COMMENT '执行完成时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '上传时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  INDEX idx_park_id (park_id),
+  INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='导入任务表';
+
 -- =====================================================
 -- 创建组合索引优化查询性能
 -- =====================================================
@@ -385,7 +608,7 @@ CREATE INDEX idx_internal_vehicles_search ON internal_vehicles(license_plate, vi
 -- =====================================================
 -- 脚本完成
 -- =====================================================
--- 总表数: 11个
+-- 总表数: 23个
 -- 总索引数: 20+个
 -- 字符集: utf8mb4 (支持Emoji和特殊字符)
 -- 存储引擎: InnoDB (支持事务和外键)
@@ -2,14 +2,33 @@
 // scan.js
 const app = getApp()
 
+// 上传的照片保存到的字段，按 data-kind 区分
+const photoFields = {
+  driving_license: 'vehicle.licenseMainPhoto',
+  driving_license_back: 'vehicle.licenseSubPhoto',
+  vehicle_front: 'vehicle.vehicleFrontPhoto'
+}
+
+// 质量输入框为文本，提交时转为数字，未填写或无法识别时为 null
+function toNumber(value) {
+  if (value === '' || value == null) {
+    return null
+  }
+  const number = Number(value)
+  return isNaN(number) ? null : number
+}
+
 Page({
   data: {
     qrcode: '',
+    parkId: 0,
+    uploadToken: '',
     parkName: '',
     companyEnabled: false,
     companies: [],
     companyIndex: 0,
     showForm: false,
+    ocrRecognitionIds: [],
     vehicle: {
       licensePlate: '',
       plateColor: '',
@@ -29,6 +48,10 @@ Page({
       approvedLoadMass: '',
       maxTowingMass: '',
       phone: '',
+      licenseMainPhoto: '',
+      licenseSubPhoto: '',
+      vehicleFrontPhoto: '',
+      vehicleListPhoto: '',
       isOBDEnabled: true
     }
   },
@@ -53,9 +76,11 @@ Page({
       success: (res) => {
         if (res.statusCode === 200) {
           this.setData({
-            parkName: res.data.parkName,
-            companyEnabled: res.data.companyEnabled,
-            companies: res.data.companies
+            parkId: res.data.park_id,
+            uploadToken: res.data.upload_token,
+            parkName: res.data.park_name,
+            companyEnabled: res.data.company_enabled,
+            companies: res.data.companies || []
           })
         } else {
           wx.showToast({
@@ -80,21 +105,65 @@ Page({
     })
   },
 
-  // 选择图片
-  chooseImage() {
+  // 选择图片，data-kind 为照片类型：driving_license 行驶证主页，driving_license_back 行驶证副页，vehicle_front 车头照片
+  chooseImage(e) {
+    const kind = e.currentTarget.dataset.kind
     wx.chooseImage({
       count: 1,
       sizeType: ['compressed'],
       sourceType: ['album', 'camera'],
       success: (res) => {
         const tempFilePaths = res.tempFilePaths
-        this.uploadImage(tempFilePaths[0])
+        this.uploadImage(tempFilePaths[0], kind)
       }
     })
   },
 
-  // 上传图片并识别
-  uploadImage(filePath) {
+  // 上传照片作为车辆照片保存，行驶证照片再识别证照内容
+  uploadImage(filePath, kind) {
+    wx.showLoading({
+      title: '上传中...'
+    })
+
+    wx.uploadFile({
+      url: app.globalData.apiBase + '/mini-program/uploads',
+      filePath: filePath,
+      name: 'file',
+      formData: {
+        park_id: this.data.parkId,
+        upload_token: this.data.uploadToken
+      },
+      success: (res) => {
+        const data = JSON.parse(res.data)
+        if (res.statusCode === 200) {
+          this.setData({
+            [photoFields[kind]]: data.key
+          })
+          if (kind === 'vehicle_front') {
+            wx.hideLoading()
+            return
+          }
+          this.recognizeImage(filePath, kind)
+        } else {
+          wx.hideLoading()
+          wx.showToast({
+            title: data.error || '上传失败',
+            icon: 'none'
+          })
+        }
+      },
+      fail: (err) => {
+        wx.hideLoading()
+        wx.showToast({
+          title: '上传失败',
+          icon: 'none'
+        })
+      }
+    })
+  },
+
+  // 识别证照照片
+  recognizeImage(filePath, kind) {
     wx.showLoading({
       title: '识别中...'
     })
@@ -103,32 +172,49 @@ Page({
       url: app.globalData.apiBase + '/mini-program/ocr',
       filePath: filePath,
       name: 'file',
+      formData: {
+        kind: kind,
+        park_id: this.data.parkId
+      },
       success: (res) => {
         wx.hideLoading()
         const data = JSON.parse(res.data)
-        if (data.code === 0) {
+        if (res.statusCode === 200) {
+          const recognized = data.vehicle
           this.setData({
             showForm: true,
+            ocrRecognitionIds: [...this.data.ocrRecognitionIds, data.recognition_id],
             vehicle: {
               ...this.data.vehicle,
-              licensePlate: data.licensePlate,
-              plateColor: data.plateColor,
-              vehicleType: data.vehicleType,
-              vin: data.vin,
-              registerDate: data.registerDate,
-              issueDate: data.issueDate,
-              brandModel: data.brandModel,
-              usageNature: data.usageNature,
-              owner: data.owner,
-              address: data.address,
-              engineNumber: data.engineNumber
+              licensePlate: recognized.license_plate || this.data.vehicle.licensePlate,
+              plateColor: recognized.plate_color || this.data.vehicle.plateColor,
+              vehicleType: recognized.vehicle_type || this.data.vehicle.vehicleType,
+              vin: recognized.vin || this.data.vehicle.vin,
+              registerDate: recognized.register_date || this.data.vehicle.registerDate,
+              issueDate: recognized.issue_date || this.data.vehicle.issueDate,
+              brandModel: recognized.brand_model || this.data.vehicle.brandModel,
+              usageNature: recognized.usage_nature || this.data.vehicle.usageNature,
+              owner: recognized.owner || this.data.vehicle.owner,
+              address: recognized.address || this.data.vehicle.address,
+              engineNumber: recognized.engine_number || this.data.vehicle.engineNumber,
+              approvedLoadMass: recognized.approved_load_mass != null ? String(recognized.approved_load_mass) : this.data.vehicle.approvedLoadMass,
+              maxTowingMass: recognized.max_towing_mass != null ? String(recognized.max_towing_mass) : this.data.vehicle.maxTowingMass
             }
           })
+          const warnings = Object.values(data.warnings || {})
+          if (warnings.length > 0) {
+            wx.showToast({
+              title: '请核对：' + warnings[0],
+              icon: 'none'
+            })
+          }
           // 获取第三方数据
-          this.getThirdPartyData()
+          if (kind !== 'driving_license_back') {
+            this.getThirdPartyData()
+          }
         } else {
           wx.showToast({
-            title: data.message || '识别失败',
+            title: data.error || '识别失败',
             icon: 'none'
           })
         }
@@ -162,7 +248,8 @@ Page({
               engineModel: res.data.engine_model || this.data.vehicle.engineModel,
               engineManufacturer: res.data.engine_manufacturer || this.data.vehicle.engineManufacturer,
               emissionStandard: res.data.emission_standard || this.data.vehicle.emissionStandard,
-              fuelType: res.data.fuel_type || this.data.vehicle.fuelType
+              fuelType: res.data.fuel_type || this.data.vehicle.fuelType,
+              vehicleListPhoto: res.data.vehicle_list_photo || this.data.vehicle.vehicleListPhoto
             }
           })
         }
@@ -242,17 +329,64 @@ Page({
       return
     }
 
+    if (!this.data.vehicle.licenseMainPhoto || !this.data.vehicle.licenseSubPhoto) {
+      wx.showToast({
+        title: '请上传行驶证主页和副页',
+        icon: 'none'
+      })
+      return
+    }
+
+    if (!this.data.vehicle.vehicleFrontPhoto) {
+      wx.showToast({
+        title: '请上传车头照片',
+        icon: 'none'
+      })
+      return
+    }
+
     wx.showLoading({
       title: '提交中...'
     })
 
+    const vehicle = this.data.vehicle
+    const attachments = [
+      { kind: 'driving_license_main', key: vehicle.licenseMainPhoto },
+      { kind: 'driving_license_sub', key: vehicle.licenseSubPhoto },
+      { kind: 'vehicle_front', key: vehicle.vehicleFrontPhoto }
+    ]
+    if (vehicle.vehicleListPhoto) {
+      attachments.push({ kind: 'vehicle_list', key: vehicle.vehicleListPhoto })
+    }
+
     wx.request({
       url: app.globalData.apiBase + '/mini-program/vehicle',
       method: 'POST',
+      // 字段名与服务端车辆 JSON 一致
       data: {
-        ...this.data.vehicle,
-        parkId: 1, // 从扫码结果中获取
-        companyId: this.data.companyEnabled ? this.data.companies[this.data.companyIndex].id : null
+        park_id: this.data.parkId,
+        company_id: this.data.companyEnabled ? this.data.companies[this.data.companyIndex].id : null,
+        license_plate: vehicle.licensePlate,
+        plate_color: vehicle.plateColor,
+        vehicle_type: vehicle.vehicleType,
+        vin: vehicle.vin,
+        register_date: vehicle.registerDate,
+        issue_date: vehicle.issueDate,
+        brand_model: vehicle.brandModel,
+        usage_nature: vehicle.usageNature,
+        owner: vehicle.owner,
+        address: vehicle.address,
+        engine_number: vehicle.engineNumber,
+        engine_model: vehicle.engineModel,
+        engine_manufacturer: vehicle.engineManufacturer,
+        emission_standard: vehicle.emissionStandard,
+        fuel_type: vehicle.fuelType,
+        approved_load_mass: toNumber(vehicle.approvedLoadMass),
+        max_towing_mass: toNumber(vehicle.maxTowingMass),
+        phone: vehicle.phone,
+        is_obd_enabled: vehicle.isOBDEnabled,
+        attachments: attachments,
+        ocr_recognition_ids: this.data.ocrRecognitionIds
       },
       success: (res) => {
         wx.hideLoading()
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"strings"
@@ -20,6 +21,8 @@ import (
 )
 
 func main() {
+	flag.Parse()
+
 	// 初始化日志系统
 	// logs 目录，保留 30 天的日志
 	if err := customlogger.Init("./logs", 30); err != nil {
@@ -84,6 +87,35 @@ func main() {
 	// 初始化服务
 	services := service.New(repos, cfg)
 
+	// 旧版审核状态迁移为新状态，已迁移时不做任何修改
+	if migrated, err := services.ExternalVehicle.MigrateAuditStatuses(); err != nil {
+		log.Fatalf("Failed to migrate audit statuses: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated audit status of %d external vehicles", migrated)
+	}
+
+	// 旧版单列照片迁移为照片附件，只执行一次；旧字段保留，由 drop-legacy-photo-columns 命令删除
+	if migrated, err := services.File.MigrateLegacyPhotos(); err != nil {
+		log.Fatalf("Failed to migrate legacy photos: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated photos of %d ledger records to attachments", migrated)
+	}
+
+	// 服务停止时未执行完的导入任务标记为失败，可重新执行
+	if interrupted, err := services.Import.RecoverJobs(); err != nil {
+		log.Fatalf("Failed to recover import jobs: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("Marked %d interrupted import jobs as failed", interrupted)
+	}
+
+	// 带参数运行时执行管理命令后退出，不启动HTTP服务
+	if command := flag.Arg(0); command != "" {
+		if err := runCommand(command, services); err != nil {
+			log.Fatalf("Command %s failed: %v", command, err)
+		}
+		return
+	}
+
 	// 初始化处理器
 	handlers := handler.New(services)
 
@@ -99,7 +131,7 @@ func main() {
 	r.StaticFile("/", "./web/login.html")
 
 	// 注册路由
-	setupRoutes(r, handlers)
+	setupRoutes(r, handlers, services, cfg)
 
 	// 启动服务器
 	log.Printf("Server starting on port %s", cfg.Server.Port)
@@ -109,7 +141,7 @@ func main() {
 	}
 }
 
-func setupRoutes(r *gin.Engine, h *handler.Handler) {
+func setupRoutes(r *gin.Engine, h *handler.Handler, s *service.Services, cfg *config.Config) {
 	// 管理层API
 	apiV1 := r.Group("/api/v1")
 	{
@@ -151,6 +183,12 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 			qrcodeGroup.POST("/internal-vehicle/update", h.QRCode.UpdateInternalVehicle)
 			qrcodeGroup.GET("/non-road", h.QRCode.GetNonRoad)
 			qrcodeGroup.POST("/non-road/update", h.QRCode.UpdateNonRoad)
+			qrcodeGroup.GET("/:type/fields", h.QRCode.GetFieldsConfig)
+			qrcodeGroup.PUT("/:type/fields", h.QRCode.UpdateFieldsConfig)
+			qrcodeGroup.GET("/:type/image", h.QRCode.GetImage)
+			qrcodeGroup.GET("/:type/poster", h.QRCode.GetPoster)
+			qrcodeGroup.GET("/:type/history", h.QRCode.GetHistory)
+			qrcodeGroup.GET("/:type/revoked-scans", h.QRCode.GetRevokedScans)
 		}
 
 		// 厂外运输车辆
@@ -158,11 +196,15 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 		{
 			externalVehicleGroup.POST("", h.ExternalVehicle.Create)
 			externalVehicleGroup.GET("", h.ExternalVehicle.List)
+			externalVehicleGroup.GET("/export", h.ExternalVehicle.Export)
 			externalVehicleGroup.GET("/:id", h.ExternalVehicle.Get)
 			externalVehicleGroup.PUT("/:id", h.ExternalVehicle.Update)
 			externalVehicleGroup.DELETE("/:id", h.ExternalVehicle.Delete)
 			externalVehicleGroup.POST("/audit", h.ExternalVehicle.Audit)
-			externalVehicleGroup.POST("/dispatch", h.ExternalVehicle.Dispatch)
+			externalVehicleGroup.POST("/audit/batch", h.ExternalVehicle.BatchAudit)
+			externalVehicleGroup.GET("/:id/audit-records", h.ExternalVehicle.AuditRecords)
+			externalVehicleGroup.POST("/dispatch", h.ExternalVehicle.BatchDispatch)
+			externalVehicleGroup.POST("/:id/dispatch", h.ExternalVehicle.Dispatch)
 		}
 
 		// 厂内运输车辆
@@ -170,10 +212,12 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 		{
 			internalVehicleGroup.POST("", h.InternalVehicle.Create)
 			internalVehicleGroup.GET("", h.InternalVehicle.List)
+			internalVehicleGroup.GET("/export", h.InternalVehicle.Export)
 			internalVehicleGroup.GET("/:id", h.InternalVehicle.Get)
 			internalVehicleGroup.PUT("/:id", h.InternalVehicle.Update)
 			internalVehicleGroup.DELETE("/:id", h.InternalVehicle.Delete)
-			internalVehicleGroup.POST("/dispatch", h.InternalVehicle.Dispatch)
+			internalVehicleGroup.POST("/dispatch", h.InternalVehicle.BatchDispatch)
+			internalVehicleGroup.POST("/:id/dispatch", h.InternalVehicle.Dispatch)
 		}
 
 		// 非道路移动机械
@@ -181,10 +225,37 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 		{
 			nonRoadGroup.POST("", h.NonRoad.Create)
 			nonRoadGroup.GET("", h.NonRoad.List)
+			nonRoadGroup.GET("/export", h.NonRoad.Export)
 			nonRoadGroup.GET("/:id", h.NonRoad.Get)
 			nonRoadGroup.PUT("/:id", h.NonRoad.Update)
 			nonRoadGroup.DELETE("/:id", h.NonRoad.Delete)
-			nonRoadGroup.POST("/dispatch", h.NonRoad.Dispatch)
+			nonRoadGroup.POST("/dispatch", h.NonRoad.BatchDispatch)
+			nonRoadGroup.POST("/:id/dispatch", h.NonRoad.Dispatch)
+		}
+
+		// 下发队列
+		dispatchGroup := apiV1.Group("/dispatch-items")
+		{
+			dispatchGroup.GET("", h.Dispatch.List)
+			dispatchGroup.POST("/:id/retry", h.Dispatch.Retry)
+		}
+
+		// PC端插件在线状态
+		pluginStatusGroup := apiV1.Group("/plugin-status")
+		{
+			pluginStatusGroup.GET("", h.PluginStatus.List)
+			pluginStatusGroup.GET("/silent", h.PluginStatus.Silent)
+		}
+
+		// 自动审核
+		apiV1.GET("/audit-rules", h.Audit.GetRules)
+		apiV1.PUT("/audit-rules", h.Audit.UpdateRules)
+		apiV1.GET("/audit-decisions", h.Audit.ListDecisions)
+		blacklistGroup := apiV1.Group("/blacklist")
+		{
+			blacklistGroup.GET("", h.Audit.ListBlacklist)
+			blacklistGroup.POST("", h.Audit.CreateBlacklist)
+			blacklistGroup.DELETE("/:id", h.Audit.DeleteBlacklist)
 		}
 
 		// 用户权限
@@ -217,6 +288,21 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 			departmentGroup.DELETE("/:id", h.Department.Delete)
 		}
 
+		// 照片上传与限时下载
+		apiV1.POST("/uploads", h.File.Upload)
+		apiV1.POST("/files/sign", h.File.Sign)
+		apiV1.GET("/files/*key", h.File.Download)
+
+		// 台账批量导入
+		importGroup := apiV1.Group("/imports")
+		{
+			importGroup.POST("", h.Import.Upload)
+			importGroup.GET("", h.Import.List)
+			importGroup.GET("/:id", h.Import.Get)
+			importGroup.POST("/:id/run", h.Import.Run)
+			importGroup.GET("/:id/report", h.Import.Report)
+		}
+
 		// 车主端小程序API
 		miniProgram := apiV1.Group("/mini-program")
 		{
@@ -226,20 +312,76 @@ func setupRoutes(r *gin.Engine, h *handler.Handler) {
 			miniProgram.POST("/vehicle", h.MiniProgram.SubmitVehicle)
 			// 获取第三方随车清单数据
 			miniProgram.POST("/get-car-data", h.MiniProgram.GetCarData)
+			miniProgram.POST("/ocr", h.MiniProgram.OCR)
+			// 上传照片，须携带扫码返回的上传令牌，按 IP 限制频率
+			miniProgram.POST("/uploads", middleware.RateLimit(cfg.Storage.UploadRateLimit, time.Minute), h.File.MiniProgramUpload)
 		}
 
 		// PC端插件API
-		plugin := apiV1.Group("/plugin")
+		// 所有插件请求均须签名，见 README 中的请求签名说明
+		plugin := apiV1.Group("/plugin", middleware.PluginSignature(s.Plugin))
 		{
 			plugin.POST("/verify", h.Plugin.Verify)
-			plugin.POST("/sync", h.Plugin.Sync)
+
+			// 以下接口须携带验证时签发的令牌：Authorization: Bearer <token>
+			authorized := plugin.Group("", middleware.PluginAuth(s.Plugin))
+			authorized.POST("/token/refresh", h.Plugin.RefreshToken)
+			authorized.POST("/token/revoke", h.Plugin.RevokeToken)
+			authorized.POST("/sync/pull", h.Plugin.Pull)
+			authorized.POST("/sync/push", h.Plugin.Push)
+			authorized.POST("/dispatch/fetch", h.Plugin.FetchDispatch)
+			authorized.POST("/dispatch/ack", h.Plugin.AckDispatch)
+			authorized.POST("/heartbeat", h.Plugin.Heartbeat)
+			authorized.GET("/ws", h.Plugin.WebSocket)
+			authorized.GET("/events", h.Plugin.Events)
+			authorized.POST("/files/sign", h.Plugin.SignFiles)
+		}
+	}
+}
+
+// runCommand 执行管理命令
+func runCommand(command string, services *service.Services) error {
+	switch command {
+	case "backfill-qrcodes":
+		// 为缺少二维码的车场补齐三类二维码
+		parks, created, err := services.QRCode.BackfillQRCodes()
+		if err != nil {
+			return err
+		}
+		log.Printf("Backfilled %d qrcodes for %d parks", created, parks)
+		return nil
+	case "backfill-sync-changes":
+		// 为存量台账记录补写同步变更日志，插件首次拉取时可获得全部数据
+		count, err := services.Plugin.BackfillSyncChanges()
+		if err != nil {
+			return err
 		}
+		log.Printf("Backfilled %d sync changes", count)
+		return nil
+	case "drop-legacy-photo-columns":
+		// 确认照片已迁移为附件后删除各台账表的旧版照片字段
+		dropped, err := services.File.DropLegacyPhotoColumns()
+		if err != nil {
+			return err
+		}
+		log.Printf("Dropped %d legacy photo columns", dropped)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, available: backfill-qrcodes, backfill-sync-changes, drop-legacy-photo-columns", command)
 	}
 }
 
 // autoMigrate 自动迁移数据库表结构
 func autoMigrate(db *gorm.DB) error {
 	log.Println("Starting database auto migration...")
+
+	// 建立二维码 (park_id, type) 唯一索引前合并已有的重复二维码
+	if merged, err := service.MergeDuplicateQRCodes(db); err != nil {
+		return fmt.Errorf("merge duplicate qrcodes: %w", err)
+	} else if merged > 0 {
+		log.Printf("Merged %d duplicate qrcodes", merged)
+	}
+
 	return db.AutoMigrate(
 		&model.Park{},
 		&model.Company{},
@@ -251,7 +393,20 @@ func autoMigrate(db *gorm.DB) error {
 		&model.Role{},
 		&model.Department{},
 		&model.QRCode{},
+		&model.QRCodeHistory{},
+		&model.QRCodeScanLog{},
 		&model.PluginAuth{},
+		&model.PluginNonce{},
+		&model.SyncChange{},
+		&model.DispatchItem{},
+		&model.PluginStatus{},
+		&model.AuditPolicy{},
+		&model.AuditDecision{},
+		&model.VehicleBlacklist{},
+		&model.AuditRecord{},
+		&model.OCRRecognition{},
+		&model.ImportJob{},
+		&model.DataMigration{},
 	)
 }
 
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/validation"
+)
+
+// Facts 规则判定所需的外部数据，由调用方按规则需要预先查询
+type Facts struct {
+	ThirdParty    *model.ThirdPartyVehicleData // 第三方随车清单数据
+	ThirdPartyErr error                        // 第三方查询失败原因
+	Blacklist     *model.VehicleBlacklist      // 命中的黑名单记录
+}
+
+// Outcome 自动审核结果
+type Outcome struct {
+	Decision string
+	Rule     string // 决定性规则，全部通过时为空
+	Reason   string
+	Results  []model.AuditRuleResult
+}
+
+// ruleLabels 规则名称，用于提示信息
+var ruleLabels = map[string]string{
+	model.AuditRuleEmissionStandard: "排放标准",
+	model.AuditRuleThirdPartyMatch:  "随车清单核验",
+	model.AuditRulePhotosComplete:   "照片齐全",
+	model.AuditRuleBlacklist:        "黑名单",
+}
+
+// photoLabels 可要求上传的照片类型
+var photoLabels = map[string]string{
+	model.AttachmentDrivingLicenseMain: "行驶证主页",
+	model.AttachmentDrivingLicenseSub:  "行驶证副页",
+	model.AttachmentVehicleFront:       "车头照片",
+	model.AttachmentVehicleList:        "随车清单",
+}
+
+var allPhotos = []string{
+	model.AttachmentDrivingLicenseMain,
+	model.AttachmentDrivingLicenseSub,
+	model.AttachmentVehicleFront,
+	model.AttachmentVehicleList,
+}
+
+// severity 决定的严格程度，多条规则不通过时取最严格的处理
+var severity = map[string]int{
+	model.AuditDecisionApprove: 0,
+	model.AuditDecisionReview:  1,
+	model.AuditDecisionReject:  2,
+}
+
+// DefaultConfig 默认规则：国五及以上、随车清单可查、照片齐全，命中黑名单直接驳回；默认不启用
+func DefaultConfig() *model.AuditRulesConfig {
+	return &model.AuditRulesConfig{
+		Enabled: false,
+		Rules: []model.AuditRule{
+			{Kind: model.AuditRuleBlacklist, Enabled: true, Action: model.AuditDecisionReject},
+			{Kind: model.AuditRuleEmissionStandard, Enabled: true, Action: model.AuditDecisionReview, EmissionStandards: []string{"国五", "国六"}},
+			{Kind: model.AuditRuleThirdPartyMatch, Enabled: true, Action: model.AuditDecisionReview},
+			{Kind: model.AuditRulePhotosComplete, Enabled: true, Action: model.AuditDecisionReview},
+		},
+	}
+}
+
+// NormalizeConfig 校验规则配置并规范取值：处理方式默认转人工审核，排放标准统一为中文写法
+// 配置不合法时返回 validation.Errors
+func NormalizeConfig(config *model.AuditRulesConfig) error {
+	seen := make(map[string]bool, len(config.Rules))
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		label, ok := ruleLabels[rule.Kind]
+		if !ok {
+			return invalid("不支持的审核规则: %s", rule.Kind)
+		}
+		if seen[rule.Kind] {
+			return invalid("审核规则重复: %s", label)
+		}
+		seen[rule.Kind] = true
+
+		switch rule.Action {
+		case "":
+			rule.Action = model.AuditDecisionReview
+		case model.AuditDecisionReview, model.AuditDecisionReject:
+		default:
+			return invalid("%s规则的处理方式无效: %s", label, rule.Action)
+		}
+
+		switch rule.Kind {
+		case model.AuditRuleEmissionStandard:
+			standards := make([]string, 0, len(rule.EmissionStandards))
+			for _, standard := range rule.EmissionStandards {
+				normalized := NormalizeEmission(standard)
+				if normalized == "" {
+					continue
+				}
+				standards = append(standards, normalized)
+			}
+			if rule.Enabled && len(standards) == 0 {
+				return invalid("排放标准规则须至少允许一种排放标准")
+			}
+			rule.EmissionStandards = standards
+		case model.AuditRulePhotosComplete:
+			for j, photo := range rule.Photos {
+				rule.Photos[j] = photoKind(photo)
+				if _, ok := photoLabels[rule.Photos[j]]; !ok {
+					return invalid("不支持的照片类型: %s", photo)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// photoKind 返回照片类型，兼容改为照片附件前按照片字段保存的规则
+func photoKind(photo string) string {
+	if kind, ok := model.LegacyPhotoFields[photo]; ok {
+		return kind
+	}
+	return photo
+}
+
+// invalid 规则配置错误，按字段校验错误返回以便接口响应 400
+func invalid(format string, args ...interface{}) error {
+	return validation.Errors{{Field: "rules", Label: "审核规则", Message: fmt.Sprintf(format, args...)}}
+}
+
+// NeedsThirdParty 规则配置是否需要查询第三方随车清单
+func NeedsThirdParty(config *model.AuditRulesConfig) bool {
+	return config.Enabled && ruleEnabled(config, model.AuditRuleThirdPartyMatch)
+}
+
+// NeedsBlacklist 规则配置是否需要查询黑名单
+func NeedsBlacklist(config *model.AuditRulesConfig) bool {
+	return config.Enabled && ruleEnabled(config, model.AuditRuleBlacklist)
+}
+
+func ruleEnabled(config *model.AuditRulesConfig, kind string) bool {
+	for _, rule := range config.Rules {
+		if rule.Kind == kind && rule.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate 按顺序执行已启用的规则，全部通过时自动通过，否则取最严格的处理
+// 未启用自动审核或没有启用任何规则时转人工审核
+func Evaluate(config *model.AuditRulesConfig, vehicle *model.ExternalVehicle, facts Facts) Outcome {
+	outcome := Outcome{Decision: model.AuditDecisionApprove, Results: []model.AuditRuleResult{}}
+	if !config.Enabled {
+		outcome.Decision = model.AuditDecisionReview
+		outcome.Reason = "车场未启用自动审核"
+		return outcome
+	}
+
+	for _, rule := range config.Rules {
+		if !rule.Enabled {
+			continue
+		}
+		passed, message := check(rule, vehicle, facts)
+		result := model.AuditRuleResult{Kind: rule.Kind, Passed: passed, Message: message}
+		if !passed {
+			result.Action = rule.Action
+			if severity[rule.Action] > severity[outcome.Decision] {
+				outcome.Decision = rule.Action
+				outcome.Rule = rule.Kind
+				outcome.Reason = message
+			}
+		}
+		outcome.Results = append(outcome.Results, result)
+	}
+
+	if len(outcome.Results) == 0 {
+		outcome.Decision = model.AuditDecisionReview
+		outcome.Reason = "未启用任何审核规则"
+	} else if outcome.Decision == model.AuditDecisionApprove {
+		outcome.Reason = "全部审核规则通过"
+	}
+	return outcome
+}
+
+func check(rule model.AuditRule, vehicle *model.ExternalVehicle, facts Facts) (bool, string) {
+	switch rule.Kind {
+	case model.AuditRuleEmissionStandard:
+		return checkEmission(rule, vehicle)
+	case model.AuditRuleThirdPartyMatch:
+		return checkThirdParty(rule, vehicle, facts)
+	case model.AuditRulePhotosComplete:
+		return checkPhotos(rule, vehicle)
+	case model.AuditRuleBlacklist:
+		if facts.Blacklist != nil {
+			reason := "车辆在车场黑名单中"
+			if facts.Blacklist.Reason != "" {
+				reason += "：" + facts.Blacklist.Reason
+			}
+			return false, reason
+		}
+		return true, "未命中黑名单"
+	}
+	return false, fmt.Sprintf("不支持的审核规则: %s", rule.Kind)
+}
+
+func checkEmission(rule model.AuditRule, vehicle *model.ExternalVehicle) (bool, string) {
+	standard := NormalizeEmission(vehicle.EmissionStandard)
+	if standard == "" {
+		return false, "未填写排放标准"
+	}
+	for _, allowed := range rule.EmissionStandards {
+		if standard == allowed {
+			return true, fmt.Sprintf("排放标准%s符合要求", standard)
+		}
+	}
+	return false, fmt.Sprintf("排放标准%s不在允许范围（%s）内", standard, strings.Join(rule.EmissionStandards, "、"))
+}
+
+func checkThirdParty(rule model.AuditRule, vehicle *model.ExternalVehicle, facts Facts) (bool, string) {
+	if facts.ThirdPartyErr != nil {
+		return false, fmt.Sprintf("随车清单查询失败：%v", facts.ThirdPartyErr)
+	}
+	data := facts.ThirdParty
+	if data == nil {
+		return false, "未查询到随车清单数据"
+	}
+	if data.VIN != "" && !strings.EqualFold(data.VIN, vehicle.VIN) {
+		return false, fmt.Sprintf("随车清单VIN %s 与提交的 %s 不一致", data.VIN, vehicle.VIN)
+	}
+	if rule.MatchEmission {
+		listed := NormalizeEmission(data.EmissionStandard)
+		if listed != "" && listed != NormalizeEmission(vehicle.EmissionStandard) {
+			return false, fmt.Sprintf("随车清单排放标准%s与提交的%s不一致", listed, vehicle.EmissionStandard)
+		}
+	}
+	return true, "随车清单数据核验一致"
+}
+
+func checkPhotos(rule model.AuditRule, vehicle *model.ExternalVehicle) (bool, string) {
+	required := rule.Photos
+	if len(required) == 0 {
+		required = allPhotos
+	}
+	var missing []string
+	for _, photo := range required {
+		kind := photoKind(photo)
+		if strings.TrimSpace(vehicle.Attachments.Get(kind)) == "" {
+			missing = append(missing, photoLabels[kind])
+		}
+	}
+	if len(missing) > 0 {
+		return false, "缺少" + strings.Join(missing, "、")
+	}
+	return true, "照片齐全"
+}
+
+// emissionStages 排放阶段的各种写法，按长度从长到短匹配
+var emissionStages = []struct {
+	prefix string
+	stage  string
+}{
+	{"VI", "六"}, {"IV", "四"}, {"V", "五"}, {"III", "三"}, {"II", "二"}, {"I", "一"},
+	{"Ⅵ", "六"}, {"Ⅴ", "五"}, {"Ⅳ", "四"}, {"Ⅲ", "三"}, {"Ⅱ", "二"}, {"Ⅰ", "一"},
+	{"6", "六"}, {"5", "五"}, {"4", "四"}, {"3", "三"}, {"2", "二"}, {"1", "一"},
+	{"六", "六"}, {"五", "五"}, {"四", "四"}, {"三", "三"}, {"二", "二"}, {"一", "一"},
+}
+
+// NormalizeEmission 将国6、国VI、国Ⅵ、国六b 等写法统一为“国六”，无法识别的原样返回（去除空白）
+func NormalizeEmission(value string) string {
+	value = strings.TrimSpace(value)
+	rest, ok := strings.CutPrefix(value, "国")
+	if !ok {
+		return value
+	}
+	upper := strings.ToUpper(strings.TrimSpace(rest))
+	for _, s := range emissionStages {
+		if strings.HasPrefix(upper, s.prefix) {
+			return "国" + s.stage
+		}
+	}
+	return value
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -12,6 +13,11 @@ type Config struct {
 	Database   DatabaseConfig
 	ThirdParty ThirdPartyConfig
 	OSS        OSSConfig
+	Storage    StorageConfig
+	QRCode     QRCodeConfig
+	Plugin     PluginConfig
+	OCR        OCRConfig
+	Import     ImportConfig
 }
 
 type ServerConfig struct {
@@ -24,8 +30,14 @@ type DatabaseConfig struct {
 }
 
 type ThirdPartyConfig struct {
-	ParkID  string
-	BaseURL string
+	ParkID           string
+	BaseURL          string
+	Timeout          time.Duration // 单次请求超时时间
+	Retries          int           // 网络错误或服务端错误时的重试次数
+	RetryBackoff     time.Duration // 首次重试前的等待时间，之后逐次加倍
+	CacheTTL         time.Duration // 按查询条件缓存查询结果的时间，为 0 时不缓存
+	BreakerThreshold int           // 连续失败达到此次数后熔断
+	BreakerCooldown  time.Duration // 熔断持续时间，之后放行一次试探请求
 }
 
 type OSSConfig struct {
@@ -33,6 +45,58 @@ type OSSConfig struct {
 	AccessKeyID     string
 	AccessKeySecret string
 	BucketName      string
+	Region          string // 签名使用的区域，默认 us-east-1
+	PathStyle       bool   // 使用 endpoint/bucket/key 形式的地址（MinIO 等），否则为 bucket.endpoint/key
+}
+
+// StorageConfig 照片等文件的存储配置
+type StorageConfig struct {
+	Backend   string        // local（本地目录）或 s3（S3 兼容对象存储，使用 oss 配置）
+	LocalDir  string        // 本地存储目录
+	MaxSize   int64         // 单个文件大小上限（字节）
+	URLSecret string        // 下载地址签名密钥，为空时每次启动随机生成，重启后已签发的地址失效
+	URLTTL    time.Duration // 下载地址有效期
+	Timeout   time.Duration // 对象存储请求超时时间
+
+	// 图片处理
+	ThumbnailSize  int   // 缩略图最长边（像素）
+	MaxDimension   int   // 原图最长边上限（像素），超出时缩小
+	JPEGQuality    int   // 重新压缩时的 JPEG 质量（1-100）
+	RecompressSize int64 // 原图超过此大小（字节）时重新压缩
+
+	ExportURLTTL time.Duration // 导出表格中照片下载地址的有效期
+
+	// 小程序上传
+	UploadTokenTTL  time.Duration // 扫码签发的上传令牌有效期
+	UploadRateLimit int           // 小程序上传接口每个 IP 每分钟的请求数上限，为 0 时不限制
+}
+
+// QRCodeConfig 车场二维码配置
+type QRCodeConfig struct {
+	BaseURL     string        // 扫码落地页地址，为空时二维码仅包含内容令牌
+	GracePeriod time.Duration // 二维码更换后旧码仍可扫码登记的宽限期，为 0 时旧码立即失效
+}
+
+// PluginConfig PC端插件配置
+type PluginConfig struct {
+	TokenTTL        time.Duration // 会话令牌有效期
+	OfflineAfter    time.Duration // 超过此时间未收到心跳视为离线
+	SilentThreshold time.Duration // 管理端静默车场列表的默认阈值
+}
+
+// OCRConfig 证照识别服务配置
+type OCRConfig struct {
+	Provider  string        // baidu、fake，为空时不启用证照识别
+	APIKey    string        // 百度智能云应用 API Key
+	SecretKey string        // 百度智能云应用 Secret Key
+	Timeout   time.Duration // 单次识别请求超时时间
+}
+
+// ImportConfig 台账批量导入配置
+type ImportConfig struct {
+	MaxSize  int64 // 导入文件大小上限（字节）
+	MaxRows  int   // 导入文件行数上限
+	SyncRows int   // 数据行数不超过此值时在请求内执行，否则在后台执行
 }
 
 var cfg *Config
@@ -52,6 +116,31 @@ func Load() *Config {
 	// 设置默认值
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.mode", "release")
+	viper.SetDefault("plugin.token_ttl", "2h")
+	viper.SetDefault("plugin.offline_after", "5m")
+	viper.SetDefault("plugin.silent_threshold", "1h")
+	viper.SetDefault("ocr.timeout", "10s")
+	viper.SetDefault("thirdparty.timeout", "10s")
+	viper.SetDefault("thirdparty.retries", 2)
+	viper.SetDefault("thirdparty.retry_backoff", "500ms")
+	viper.SetDefault("thirdparty.cache_ttl", "10m")
+	viper.SetDefault("thirdparty.breaker_threshold", 5)
+	viper.SetDefault("thirdparty.breaker_cooldown", "30s")
+	viper.SetDefault("storage.backend", "local")
+	viper.SetDefault("storage.local_dir", "./uploads")
+	viper.SetDefault("storage.max_size", 10<<20)
+	viper.SetDefault("storage.url_ttl", "1h")
+	viper.SetDefault("storage.timeout", "30s")
+	viper.SetDefault("storage.thumbnail_size", 320)
+	viper.SetDefault("storage.max_dimension", 2560)
+	viper.SetDefault("storage.jpeg_quality", 82)
+	viper.SetDefault("storage.recompress_size", 1<<20)
+	viper.SetDefault("storage.export_url_ttl", "168h")
+	viper.SetDefault("storage.upload_token_ttl", "2h")
+	viper.SetDefault("storage.upload_rate_limit", 30)
+	viper.SetDefault("import.max_size", 20<<20)
+	viper.SetDefault("import.max_rows", 50000)
+	viper.SetDefault("import.sync_rows", 200)
 
 	// 允许通过环境变量覆盖配置（优先级：环境变量 > 配置文件 > 默认值）
 	viper.SetEnvPrefix("TAIZHANG")
@@ -59,10 +148,43 @@ func Load() *Config {
 	viper.BindEnv("database.dsn", "TAIZHANG_DATABASE_DSN")
 	viper.BindEnv("thirdparty.park_id", "TAIZHANG_PARK_ID")
 	viper.BindEnv("thirdparty.base_url", "TAIZHANG_BASE_URL")
+	viper.BindEnv("thirdparty.timeout", "TAIZHANG_THIRDPARTY_TIMEOUT")
+	viper.BindEnv("thirdparty.retries", "TAIZHANG_THIRDPARTY_RETRIES")
+	viper.BindEnv("thirdparty.retry_backoff", "TAIZHANG_THIRDPARTY_RETRY_BACKOFF")
+	viper.BindEnv("thirdparty.cache_ttl", "TAIZHANG_THIRDPARTY_CACHE_TTL")
+	viper.BindEnv("thirdparty.breaker_threshold", "TAIZHANG_THIRDPARTY_BREAKER_THRESHOLD")
+	viper.BindEnv("thirdparty.breaker_cooldown", "TAIZHANG_THIRDPARTY_BREAKER_COOLDOWN")
 	viper.BindEnv("oss.endpoint", "TAIZHANG_OSS_ENDPOINT")
 	viper.BindEnv("oss.access_key_id", "TAIZHANG_OSS_ACCESS_KEY_ID")
 	viper.BindEnv("oss.access_key_secret", "TAIZHANG_OSS_ACCESS_KEY_SECRET")
 	viper.BindEnv("oss.bucket_name", "TAIZHANG_OSS_BUCKET_NAME")
+	viper.BindEnv("oss.region", "TAIZHANG_OSS_REGION")
+	viper.BindEnv("oss.path_style", "TAIZHANG_OSS_PATH_STYLE")
+	viper.BindEnv("storage.backend", "TAIZHANG_STORAGE_BACKEND")
+	viper.BindEnv("storage.local_dir", "TAIZHANG_STORAGE_LOCAL_DIR")
+	viper.BindEnv("storage.max_size", "TAIZHANG_STORAGE_MAX_SIZE")
+	viper.BindEnv("storage.url_secret", "TAIZHANG_STORAGE_URL_SECRET")
+	viper.BindEnv("storage.url_ttl", "TAIZHANG_STORAGE_URL_TTL")
+	viper.BindEnv("storage.timeout", "TAIZHANG_STORAGE_TIMEOUT")
+	viper.BindEnv("storage.thumbnail_size", "TAIZHANG_STORAGE_THUMBNAIL_SIZE")
+	viper.BindEnv("storage.max_dimension", "TAIZHANG_STORAGE_MAX_DIMENSION")
+	viper.BindEnv("storage.jpeg_quality", "TAIZHANG_STORAGE_JPEG_QUALITY")
+	viper.BindEnv("storage.recompress_size", "TAIZHANG_STORAGE_RECOMPRESS_SIZE")
+	viper.BindEnv("storage.export_url_ttl", "TAIZHANG_STORAGE_EXPORT_URL_TTL")
+	viper.BindEnv("storage.upload_token_ttl", "TAIZHANG_STORAGE_UPLOAD_TOKEN_TTL")
+	viper.BindEnv("storage.upload_rate_limit", "TAIZHANG_STORAGE_UPLOAD_RATE_LIMIT")
+	viper.BindEnv("qrcode.base_url", "TAIZHANG_QRCODE_BASE_URL")
+	viper.BindEnv("qrcode.grace_period", "TAIZHANG_QRCODE_GRACE_PERIOD")
+	viper.BindEnv("plugin.token_ttl", "TAIZHANG_PLUGIN_TOKEN_TTL")
+	viper.BindEnv("plugin.offline_after", "TAIZHANG_PLUGIN_OFFLINE_AFTER")
+	viper.BindEnv("plugin.silent_threshold", "TAIZHANG_PLUGIN_SILENT_THRESHOLD")
+	viper.BindEnv("ocr.provider", "TAIZHANG_OCR_PROVIDER")
+	viper.BindEnv("ocr.api_key", "TAIZHANG_OCR_API_KEY")
+	viper.BindEnv("ocr.secret_key", "TAIZHANG_OCR_SECRET_KEY")
+	viper.BindEnv("ocr.timeout", "TAIZHANG_OCR_TIMEOUT")
+	viper.BindEnv("import.max_size", "TAIZHANG_IMPORT_MAX_SIZE")
+	viper.BindEnv("import.max_rows", "TAIZHANG_IMPORT_MAX_ROWS")
+	viper.BindEnv("import.sync_rows", "TAIZHANG_IMPORT_SYNC_ROWS")
 
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("Warning: Config file not found, using defaults and environment variables: %v", err)
@@ -77,14 +199,60 @@ func Load() *Config {
 			DSN: viper.GetString("database.dsn"),
 		},
 		ThirdParty: ThirdPartyConfig{
-			ParkID:  viper.GetString("thirdparty.park_id"),
-			BaseURL: viper.GetString("thirdparty.base_url"),
+			ParkID:           viper.GetString("thirdparty.park_id"),
+			BaseURL:          viper.GetString("thirdparty.base_url"),
+			Timeout:          viper.GetDuration("thirdparty.timeout"),
+			Retries:          viper.GetInt("thirdparty.retries"),
+			RetryBackoff:     viper.GetDuration("thirdparty.retry_backoff"),
+			CacheTTL:         viper.GetDuration("thirdparty.cache_ttl"),
+			BreakerThreshold: viper.GetInt("thirdparty.breaker_threshold"),
+			BreakerCooldown:  viper.GetDuration("thirdparty.breaker_cooldown"),
 		},
 		OSS: OSSConfig{
 			Endpoint:        viper.GetString("oss.endpoint"),
 			AccessKeyID:     viper.GetString("oss.access_key_id"),
 			AccessKeySecret: viper.GetString("oss.access_key_secret"),
 			BucketName:      viper.GetString("oss.bucket_name"),
+			Region:          viper.GetString("oss.region"),
+			PathStyle:       viper.GetBool("oss.path_style"),
+		},
+		Storage: StorageConfig{
+			Backend:   viper.GetString("storage.backend"),
+			LocalDir:  viper.GetString("storage.local_dir"),
+			MaxSize:   viper.GetInt64("storage.max_size"),
+			URLSecret: viper.GetString("storage.url_secret"),
+			URLTTL:    viper.GetDuration("storage.url_ttl"),
+			Timeout:   viper.GetDuration("storage.timeout"),
+
+			ThumbnailSize:  viper.GetInt("storage.thumbnail_size"),
+			MaxDimension:   viper.GetInt("storage.max_dimension"),
+			JPEGQuality:    viper.GetInt("storage.jpeg_quality"),
+			RecompressSize: viper.GetInt64("storage.recompress_size"),
+
+			ExportURLTTL: viper.GetDuration("storage.export_url_ttl"),
+
+			UploadTokenTTL:  viper.GetDuration("storage.upload_token_ttl"),
+			UploadRateLimit: viper.GetInt("storage.upload_rate_limit"),
+		},
+		QRCode: QRCodeConfig{
+			BaseURL:     viper.GetString("qrcode.base_url"),
+			GracePeriod: viper.GetDuration("qrcode.grace_period"),
+		},
+		Plugin: PluginConfig{
+			TokenTTL:        viper.GetDuration("plugin.token_ttl"),
+			OfflineAfter:    viper.GetDuration("plugin.offline_after"),
+			SilentThreshold: viper.GetDuration("plugin.silent_threshold"),
+		},
+		OCR: OCRConfig{
+			Provider:  viper.GetString("ocr.provider"),
+			APIKey:    viper.GetString("ocr.api_key"),
+			SecretKey: viper.GetString("ocr.secret_key"),
+			Timeout:   viper.GetDuration("ocr.timeout"),
+		},
+		Import: ImportConfig{
+			MaxSize:  viper.GetInt64("import.max_size"),
+			MaxRows:  viper.GetInt("import.max_rows"),
+			SyncRows: viper.GetInt("import.sync_rows"),
 		},
 	}
 
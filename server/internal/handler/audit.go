@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AuditHandler 自动审核规则、审核决定和黑名单处理器
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// GetRules 获取车场自动审核规则，未保存时返回默认规则
+func (h *AuditHandler) GetRules(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	rules, err := h.service.GetRules(uint(parkID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// UpdateRules 保存车场自动审核规则
+func (h *AuditHandler) UpdateRules(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	var rules model.AuditRulesConfig
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.UpdateRules(uint(parkID), &rules); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "park not found"})
+			return
+		}
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// ListDecisions 查询自动审核决定，可按车场、车辆、决定（approve、review、reject）筛选
+func (h *AuditHandler) ListDecisions(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	vehicleID, _ := strconv.ParseUint(c.Query("vehicle_id"), 10, 32)
+	decision := c.Query("decision")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	decisions, total, err := h.service.ListDecisions(uint(parkID), uint(vehicleID), decision, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      decisions,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// ListBlacklist 查询车场黑名单
+func (h *AuditHandler) ListBlacklist(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	entries, total, err := h.service.ListBlacklist(uint(parkID), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateBlacklist 添加黑名单
+func (h *AuditHandler) CreateBlacklist(c *gin.Context) {
+	var entry model.VehicleBlacklist
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.CreateBlacklist(&entry); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "park not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// DeleteBlacklist 删除黑名单
+func (h *AuditHandler) DeleteBlacklist(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.service.DeleteBlacklist(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"taizhang-server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DispatchHandler 下发队列处理器
+type DispatchHandler struct {
+	service *service.DispatchService
+}
+
+func NewDispatchHandler(service *service.DispatchService) *DispatchHandler {
+	return &DispatchHandler{service: service}
+}
+
+// List 查询下发队列，可按车场、状态（pending、delivered、dead）、数据类型筛选
+func (h *DispatchHandler) List(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	status := c.Query("status")
+	dataType := c.Query("data_type")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	items, total, err := h.service.List(uint(parkID), status, dataType, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      items,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// Retry 重新投递死信下发项
+func (h *DispatchHandler) Retry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	item, err := h.service.Retry(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrDispatchItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
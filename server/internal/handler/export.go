@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/service"
+	"taizhang-server/internal/spreadsheet"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export 按列表的筛选条件导出厂外运输车辆，format 为 xlsx（默认）或 csv，photos=true 时附带照片链接
+func (h *ExternalVehicleHandler) Export(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	licensePlate := c.Query("license_plate")
+	auditStatus := c.Query("audit_status")
+	dispatchStatus := c.Query("dispatch_status")
+	emissionStandard := c.Query("emission_standard")
+
+	writeExport(c, "external_vehicles", "厂外运输车辆", func(w io.Writer, opts service.ExportOptions) error {
+		return h.service.Export(w, uint(parkID), licensePlate, auditStatus, dispatchStatus, emissionStandard, opts)
+	})
+}
+
+// Export 按列表的筛选条件导出厂内运输车辆，参数同厂外运输车辆导出
+func (h *InternalVehicleHandler) Export(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	licensePlate := c.Query("license_plate")
+	dispatchStatus := c.Query("dispatch_status")
+	emissionStandard := c.Query("emission_standard")
+
+	writeExport(c, "internal_vehicles", "厂内运输车辆", func(w io.Writer, opts service.ExportOptions) error {
+		return h.service.Export(w, uint(parkID), licensePlate, dispatchStatus, emissionStandard, opts)
+	})
+}
+
+// Export 按列表的筛选条件导出非道路移动机械，参数同厂外运输车辆导出
+func (h *NonRoadHandler) Export(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	environmentalCode := c.Query("environmental_code")
+	licensePlate := c.Query("license_plate")
+	dispatchStatus := c.Query("dispatch_status")
+	emissionStandard := c.Query("emission_standard")
+
+	writeExport(c, "non_road", "非道路移动机械", func(w io.Writer, opts service.ExportOptions) error {
+		return h.service.Export(w, uint(parkID), environmentalCode, licensePlate, dispatchStatus, emissionStandard, opts)
+	})
+}
+
+// writeExport 流式写出导出文件，文件名为 name（下载名称为 title）加导出时间
+// 开始写出前的错误返回 JSON 错误响应，开始写出后出错只能中断响应
+func writeExport(c *gin.Context, name, title string, export func(w io.Writer, opts service.ExportOptions) error) {
+	photos, _ := strconv.ParseBool(c.Query("photos"))
+	opts := service.ExportOptions{
+		Format: c.DefaultQuery("format", spreadsheet.FormatXLSX),
+		Photos: photos,
+		Origin: requestOrigin(c),
+	}
+	suffix := time.Now().Format("20060102150405") + "." + opts.Format
+	w := &exportResponse{
+		c:           c,
+		contentType: spreadsheet.ContentType(opts.Format),
+		disposition: fmt.Sprintf("attachment; filename=%s_%s; filename*=UTF-8''%s", name, suffix, url.PathEscape(title+"_"+suffix)),
+	}
+
+	err := export(w, opts)
+	switch {
+	case err == nil:
+	case c.Writer.Written():
+		log.Printf("Failed to export %s: %v", name, err)
+		c.Abort()
+	case errors.Is(err, service.ErrInvalidExport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// exportResponse 在写出第一个字节时设置下载响应头
+type exportResponse struct {
+	c           *gin.Context
+	contentType string
+	disposition string
+}
+
+func (w *exportResponse) Write(p []byte) (int, error) {
+	if !w.c.Writer.Written() {
+		w.c.Header("Content-Type", w.contentType)
+		w.c.Header("Content-Disposition", w.disposition)
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+// requestOrigin 返回请求的协议和主机，经反向代理访问时使用 X-Forwarded-Proto 和 X-Forwarded-Host
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ","); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if forwarded, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Host"), ","); strings.TrimSpace(forwarded) != "" {
+		host = strings.TrimSpace(forwarded)
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/service"
+	"taizhang-server/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// FileHandler 照片上传与下载处理器
+type FileHandler struct {
+	service *service.FileService
+}
+
+func NewFileHandler(service *service.FileService) *FileHandler {
+	return &FileHandler{service: service}
+}
+
+// Upload 上传车场照片（multipart：file 为图片，park_id 为所属车场），返回对象键和限时下载地址
+func (h *FileHandler) Upload(c *gin.Context) {
+	parkID, err := strconv.ParseUint(c.PostForm("park_id"), 10, 32)
+	if err != nil || parkID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid park_id"})
+		return
+	}
+	h.upload(c, uint(parkID))
+}
+
+// MiniProgramUpload 小程序上传照片（multipart：file 为图片，upload_token 为扫码返回的上传令牌）
+// 照片归属令牌对应的车场，同时提交 park_id 时须与之一致
+func (h *FileHandler) MiniProgramUpload(c *gin.Context) {
+	parkID, err := h.service.VerifyUploadToken(c.PostForm("upload_token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUploadToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if raw := c.PostForm("park_id"); raw != "" && raw != strconv.FormatUint(uint64(parkID), 10) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "upload token does not belong to this park"})
+		return
+	}
+	h.upload(c, parkID)
+}
+
+func (h *FileHandler) upload(c *gin.Context, parkID uint) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+	if header.Size > h.service.MaxSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, h.service.MaxSize()+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.Upload(c.Request.Context(), parkID, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUpload):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "park not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Sign 为车场的照片生成限时下载地址：{"park_id": 1, "keys": ["parks/1/..."]}
+func (h *FileHandler) Sign(c *gin.Context) {
+	var req struct {
+		ParkID uint     `json:"park_id" binding:"required"`
+		Keys   []string `json:"keys" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": h.service.SignURLs(req.ParkID, req.Keys)})
+}
+
+// Download 按限时下载地址输出文件
+func (h *FileHandler) Download(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	object, err := h.service.Open(c.Request.Context(), key, c.Request.URL.Query())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFileForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, storage.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	defer object.Body.Close()
+
+	// 对象键由内容决定，地址有效期内可以缓存
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if maxAge := expires - time.Now().Unix(); maxAge > 0 {
+		c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+	}
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, object.Body, nil)
+}
@@ -2,7 +2,13 @@
 package handler
 
 import (
+	"errors"
+	"net/http"
+
 	"taizhang-server/internal/service"
+	"taizhang-server/internal/validation"
+
+	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
@@ -18,6 +24,11 @@ type Handler struct {
 	Department      *DepartmentHandler
 	MiniProgram     *MiniProgramHandler
 	Plugin          *PluginHandler
+	Dispatch        *DispatchHandler
+	PluginStatus    *PluginStatusHandler
+	Audit           *AuditHandler
+	File            *FileHandler
+	Import          *ImportHandler
 }
 
 func New(services *service.Services) *Handler {
@@ -33,6 +44,21 @@ func New(services *service.Services) *Handler {
 		Role:            NewRoleHandler(services.Role),
 		Department:      NewDepartmentHandler(services.Department),
 		MiniProgram:     NewMiniProgramHandler(services.MiniProgram),
-		Plugin:          NewPluginHandler(services.Plugin),
+		Plugin:          NewPluginHandler(services.Plugin, services.Dispatch, services.File),
+		Dispatch:        NewDispatchHandler(services.Dispatch),
+		PluginStatus:    NewPluginStatusHandler(services.Plugin),
+		Audit:           NewAuditHandler(services.Audit),
+		File:            NewFileHandler(services.File),
+		Import:          NewImportHandler(services.Import),
+	}
+}
+
+// writeServiceError 字段校验错误返回 400 及逐字段明细，便于前端高亮；其余错误返回 500
+func writeServiceError(c *gin.Context, err error) {
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fieldErrs.Error(), "fields": fieldErrs})
+		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
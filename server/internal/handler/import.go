@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/service"
+	"taizhang-server/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImportHandler 台账批量导入处理器
+type ImportHandler struct {
+	service *service.ImportService
+}
+
+func NewImportHandler(service *service.ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+// Upload 上传导入文件（multipart：file 为 XLSX 或 CSV 表格，park_id 为车场，data_type 为台账类型），返回推荐的列映射和数据预览
+func (h *ImportHandler) Upload(c *gin.Context) {
+	parkID, err := strconv.ParseUint(c.PostForm("park_id"), 10, 32)
+	if err != nil || parkID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid park_id"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要导入的文件"})
+		return
+	}
+	if header.Size > h.service.MaxSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, h.service.MaxSize()+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, err := h.service.Upload(c.Request.Context(), uint(parkID), c.PostForm("data_type"), header.Filename, data)
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// List 查询车场的导入任务，可按 data_type 筛选
+func (h *ImportHandler) List(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	jobs, total, err := h.service.List(uint(parkID), c.Query("data_type"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      jobs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// Get 查询导入任务，后台执行的任务据此轮询进度
+func (h *ImportHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	job, err := h.service.Get(uint(id))
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Run 按列映射执行导入任务：{"mapping": {"license_plate": "车牌号码"}, "dry_run": true}
+// 在后台执行时返回 202 和执行中的任务
+func (h *ImportHandler) Run(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req model.ImportRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.service.Run(uint(id), &req)
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	if job.Status == model.ImportStatusRunning {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Report 下载错误报告（CSV）：行号、原表格各列和错误原因
+func (h *ImportHandler) Report(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	job, object, err := h.service.Report(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "没有错误报告"})
+			return
+		}
+		writeImportError(c, err)
+		return
+	}
+	defer object.Body.Close()
+
+	name := strings.TrimSuffix(job.FileName, ".xlsx")
+	name = strings.TrimSuffix(name, ".csv") + "_错误报告.csv"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=import_report_%d.csv; filename*=UTF-8''%s", job.ID, url.PathEscape(name)))
+	c.DataFromReader(http.StatusOK, object.Size, "text/csv; charset=utf-8", object.Body, nil)
+}
+
+func writeImportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidImport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrImportNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -2,11 +2,15 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"taizhang-server/internal/model"
 	"taizhang-server/internal/service"
+	"taizhang-server/internal/thirdparty"
 )
 
 type MiniProgramHandler struct {
@@ -27,7 +31,7 @@ func (h *MiniProgramHandler) Scan(c *gin.Context) {
 		return
 	}
 
-	result, err := h.service.Scan(req.QRCode)
+	result, err := h.service.Scan(req.QRCode, c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -45,7 +49,7 @@ func (h *MiniProgramHandler) SubmitVehicle(c *gin.Context) {
 	}
 
 	if err := h.service.SubmitVehicle(&vehicle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -65,11 +69,60 @@ func (h *MiniProgramHandler) GetCarData(c *gin.Context) {
 		return
 	}
 
-	data, err := h.service.GetCarData(req.Plate, req.VIN, req.EngineNumber, req.VehicleType)
+	data, err := h.service.GetCarData(c.Request.Context(), req.Plate, req.VIN, req.EngineNumber, req.VehicleType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var apiErr *thirdparty.APIError
+		switch {
+		case errors.As(err, &apiErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, thirdparty.ErrCircuitOpen):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, data)
 }
+
+// OCR 识别证照照片（multipart：file 为照片，kind 为证照类型，默认行驶证主页，park_id 可选）
+func (h *MiniProgramHandler) OCR(c *gin.Context) {
+	kind := c.DefaultPostForm("kind", model.OCRKindDrivingLicense)
+	parkID, _ := strconv.ParseUint(c.PostForm("park_id"), 10, 32)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传证照照片"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	// 多读一个字节以便服务层判断是否超过大小上限
+	image, err := io.ReadAll(io.LimitReader(file, service.MaxOCRImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.Recognize(c.Request.Context(), uint(parkID), kind, image)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOCRRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrOCRUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrOCRFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -1,58 +1,410 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"taizhang-server/internal/middleware"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/payload"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type PluginHandler struct {
-	service *service.PluginService
+	service  *service.PluginService
+	dispatch *service.DispatchService
+	files    *service.FileService
 }
 
-func NewPluginHandler(service *service.PluginService) *PluginHandler {
-	return &PluginHandler{service: service}
+func NewPluginHandler(service *service.PluginService, dispatch *service.DispatchService, files *service.FileService) *PluginHandler {
+	return &PluginHandler{service: service, dispatch: dispatch, files: files}
 }
 
-// Verify PC端插件验证
+// Verify PC端插件验证，请求签名由中间件校验
+// 可选请求体 {"protocol_version": 2, "encryption": "aes-256-gcm"} 用于协商载荷加密，省略时按协议版本 1 明文传输
 func (h *PluginHandler) Verify(c *gin.Context) {
 	var req struct {
-		ParkID    uint   `json:"park_id" binding:"required"`
-		Timestamp int64  `json:"timestamp" binding:"required"`
-		Signature string `json:"signature" binding:"required"`
+		ProtocolVersion int    `json:"protocol_version"`
+		Encryption      string `json:"encryption"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	park, err := h.service.Verify(req.ParkID, req.Timestamp, req.Signature)
+	session, err := h.service.Verify(c.GetUint(middleware.PluginParkIDKey), req.ProtocolVersion, req.Encryption)
 	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedProtocol) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "protocol_version": model.SyncProtocolVersion})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, park)
+	c.JSON(http.StatusOK, session)
 }
 
-// Sync 同步数据
-func (h *PluginHandler) Sync(c *gin.Context) {
+// RefreshToken 刷新会话令牌，旧令牌立即失效
+func (h *PluginHandler) RefreshToken(c *gin.Context) {
+	session, err := h.service.RefreshToken(middleware.BearerToken(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPluginToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// RevokeToken 注销当前会话令牌
+func (h *PluginHandler) RevokeToken(c *gin.Context) {
+	if err := h.service.RevokeToken(middleware.BearerToken(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// Pull 增量拉取台账变更
+func (h *PluginHandler) Pull(c *gin.Context) {
 	var req struct {
-		ParkID   uint        `json:"park_id" binding:"required"`
-		DataType string      `json:"data_type" binding:"required"`
-		Data     interface{} `json:"data" binding:"required"`
+		ParkID          uint     `json:"park_id"`
+		ProtocolVersion int      `json:"protocol_version" binding:"required"`
+		Cursor          uint64   `json:"cursor"`
+		DataTypes       []string `json:"data_types"`
+		Limit           int      `json:"limit"`
+	}
+	if !h.bindPayload(c, &req) {
+		return
+	}
+	if req.ProtocolVersion < model.SyncMinProtocolVersion || req.ProtocolVersion > model.SyncProtocolVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported protocol version", "protocol_version": model.SyncProtocolVersion})
+		return
+	}
+
+	parkID, ok := pluginParkID(c, req.ParkID)
+	if !ok {
+		return
+	}
+
+	result, err := h.service.Pull(parkID, req.Cursor, req.DataTypes, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result.ProtocolVersion = req.ProtocolVersion
+
+	h.writePayload(c, result)
+}
+
+// Push 上传本地变更，逐条返回接受、冲突或拒绝结果
+func (h *PluginHandler) Push(c *gin.Context) {
+	var req struct {
+		ParkID          uint                   `json:"park_id"`
+		ProtocolVersion int                    `json:"protocol_version" binding:"required"`
+		Changes         []model.SyncPushChange `json:"changes" binding:"required"`
+	}
+	if !h.bindPayload(c, &req) {
+		return
+	}
+	if req.ProtocolVersion < model.SyncMinProtocolVersion || req.ProtocolVersion > model.SyncProtocolVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported protocol version", "protocol_version": model.SyncProtocolVersion})
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+
+	parkID, ok := pluginParkID(c, req.ParkID)
+	if !ok {
+		return
+	}
+
+	results, err := h.service.Push(parkID, req.Changes)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.service.Sync(req.ParkID, req.DataType, req.Data); err != nil {
+	h.writePayload(c, gin.H{
+		"protocol_version": req.ProtocolVersion,
+		"results":          results,
+	})
+}
+
+// FetchDispatch 取出待投递的下发项，插件保存后须逐条确认
+func (h *PluginHandler) FetchDispatch(c *gin.Context) {
+	var req struct {
+		ParkID uint `json:"park_id"`
+		Limit  int  `json:"limit"`
+	}
+	if !h.bindPayload(c, &req) {
+		return
+	}
+
+	parkID, ok := pluginParkID(c, req.ParkID)
+	if !ok {
+		return
+	}
+
+	items, err := h.dispatch.Fetch(parkID, req.Limit)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "success"})
+	h.writePayload(c, gin.H{"items": items})
+}
+
+// AckDispatch 确认下发项接收结果，确认接收后记录才标记为已下发
+func (h *PluginHandler) AckDispatch(c *gin.Context) {
+	var req struct {
+		ParkID uint                `json:"park_id"`
+		Acks   []model.DispatchAck `json:"acks" binding:"required"`
+	}
+	if !h.bindPayload(c, &req) {
+		return
+	}
+
+	parkID, ok := pluginParkID(c, req.ParkID)
+	if !ok {
+		return
+	}
+
+	results, err := h.dispatch.Ack(parkID, req.Acks)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writePayload(c, gin.H{"results": results})
+}
+
+// Heartbeat 插件心跳，上报插件版本、主机信息和本地记录数
+func (h *PluginHandler) Heartbeat(c *gin.Context) {
+	var req model.PluginHeartbeat
+	if !h.bindPayload(c, &req) {
+		return
+	}
+
+	result, err := h.service.Heartbeat(c.GetUint(middleware.PluginParkIDKey), c.ClientIP(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writePayload(c, result)
+}
+
+// SignFiles 为本车场的照片生成限时下载地址：{"keys": ["parks/1/..."]}
+func (h *PluginHandler) SignFiles(c *gin.Context) {
+	var req struct {
+		Keys []string `json:"keys" binding:"required"`
+	}
+	if !h.bindPayload(c, &req) {
+		return
+	}
+
+	h.writePayload(c, gin.H{"data": h.files.SignURLs(c.GetUint(middleware.PluginParkIDKey), req.Keys)})
+}
+
+// 实时事件连接参数
+const (
+	eventsPollDefaultTimeout = 25 * time.Second
+	eventsPollMaxTimeout     = 60 * time.Second
+	websocketPingInterval    = 30 * time.Second
+	websocketReadTimeout     = 75 * time.Second // 插件须在此时间内回应 Ping 或发送消息
+)
+
+// WebSocket 建立实时事件连接，推送下发、二维码作废、配置变更和令牌注销事件
+// 可选查询参数 cursor 为上次收到的事件序号，重连时补发期间错过的事件
+func (h *PluginHandler) WebSocket(c *gin.Context) {
+	session := c.MustGet(middleware.PluginSessionKey).(*model.PluginAuth)
+	cursor, _ := strconv.ParseUint(c.Query("cursor"), 10, 64)
+
+	conn, err := realtime.Upgrade(c.Writer, c.Request)
+	if err != nil {
+		if errors.Is(err, realtime.ErrBadHandshake) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	sub, backlog, seq, reset := h.service.Subscribe(session, cursor)
+	defer h.service.Unsubscribe(sub)
+
+	readErr := make(chan error, 1)
+	go func() {
+		touch := func() {
+			conn.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+			h.service.TouchPresence(sub.ParkID)
+		}
+		for {
+			touch()
+			if _, _, err := conn.ReadMessage(touch); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	send := func(ev realtime.Event) bool {
+		data, err := h.encodeEvent(c, ev)
+		if err == nil {
+			err = conn.WriteMessage(realtime.OpText, data)
+		}
+		if err != nil {
+			conn.Close(realtime.CloseGoingAway, "")
+			return false
+		}
+		return true
+	}
+
+	ready := realtime.Event{
+		Seq:       seq,
+		Type:      realtime.EventReady,
+		Data:      gin.H{"cursor": seq, "reset": reset},
+		CreatedAt: time.Now(),
+	}
+	if !send(ready) {
+		return
+	}
+	for _, ev := range backlog {
+		if !send(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(websocketPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-sub.Events():
+			if !send(ev) {
+				return
+			}
+		case <-sub.Done():
+			// 发出关闭前排队的事件（如令牌注销通知）
+			for len(sub.Events()) > 0 {
+				if !send(<-sub.Events()) {
+					return
+				}
+			}
+			conn.Close(realtime.CloseGoingAway, "session closed")
+			return
+		case <-ticker.C:
+			if time.Now().After(sub.ExpiresAt) {
+				send(realtime.Event{Seq: seq, Type: realtime.EventTokenRevoked, Data: gin.H{"reason": "expired"}, CreatedAt: time.Now()})
+				conn.Close(realtime.ClosePolicyViolation, "token expired")
+				return
+			}
+			if err := conn.WriteMessage(realtime.OpPing, nil); err != nil {
+				conn.Close(realtime.CloseGoingAway, "")
+				return
+			}
+		case <-readErr:
+			conn.Close(realtime.CloseNormal, "")
+			return
+		}
+	}
+}
+
+// Events 长轮询获取实时事件，无法使用 WebSocket 时的备选方式
+// 查询参数 cursor 为上次收到的事件序号，timeout 为最长等待秒数（默认 25，最大 60）
+func (h *PluginHandler) Events(c *gin.Context) {
+	cursor, _ := strconv.ParseUint(c.Query("cursor"), 10, 64)
+	timeout := eventsPollDefaultTimeout
+	if seconds, err := strconv.Atoi(c.Query("timeout")); err == nil && seconds >= 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout > eventsPollMaxTimeout {
+		timeout = eventsPollMaxTimeout
+	}
+
+	events, seq, reset := h.service.WaitEvents(c.Request.Context(), c.GetUint(middleware.PluginParkIDKey), cursor, timeout)
+	if events == nil {
+		events = []realtime.Event{}
+	}
+
+	h.writePayload(c, gin.H{
+		"events": events,
+		"cursor": seq,
+		"reset":  reset,
+	})
+}
+
+// encodeEvent 序列化推送事件，协商了加密的会话输出加密信封
+func (h *PluginHandler) encodeEvent(c *gin.Context, ev realtime.Event) ([]byte, error) {
+	if c.GetString(middleware.PluginEncryptionKey) != payload.EncryptionAES256GCM {
+		return json.Marshal(ev)
+	}
+	env, err := h.service.EncryptPayload(c.GetUint(middleware.PluginParkIDKey), ev)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// bindPayload 绑定插件请求体，请求体为加密信封时先解密；协商了加密的会话只接受加密信封
+func (h *PluginHandler) bindPayload(c *gin.Context, obj interface{}) bool {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var env payload.Envelope
+	encrypted := json.Unmarshal(body, &env) == nil && env.Ciphertext != ""
+	if !encrypted && c.GetString(middleware.PluginEncryptionKey) == payload.EncryptionAES256GCM {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session requires an encrypted payload envelope"})
+		return false
+	}
+	if encrypted {
+		body, err = h.service.DecryptPayload(c.GetUint(middleware.PluginParkIDKey), &env)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	if err := binding.JSON.BindBody(body, obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// writePayload 输出插件响应，验证时协商了加密的会话只返回加密信封，车主姓名、住址、电话等信息不以明文传输
+func (h *PluginHandler) writePayload(c *gin.Context, obj interface{}) {
+	if c.GetString(middleware.PluginEncryptionKey) != payload.EncryptionAES256GCM {
+		c.JSON(http.StatusOK, obj)
+		return
+	}
+
+	env, err := h.service.EncryptPayload(c.GetUint(middleware.PluginParkIDKey), obj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, env)
+}
+
+// pluginParkID 取令牌所属车场，请求中携带了其他车场ID时拒绝访问
+func pluginParkID(c *gin.Context, requested uint) (uint, bool) {
+	parkID := c.GetUint(middleware.PluginParkIDKey)
+	if requested != 0 && requested != parkID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token does not belong to this park"})
+		return 0, false
+	}
+	return parkID, true
 }
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"taizhang-server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PluginStatusHandler 车场插件在线状态处理器，供管理端展示
+type PluginStatusHandler struct {
+	service *service.PluginService
+}
+
+func NewPluginStatusHandler(service *service.PluginService) *PluginStatusHandler {
+	return &PluginStatusHandler{service: service}
+}
+
+// List 查询各车场插件的在线状态、版本、主机信息和最近活动时间，可按 park_id 查询单个车场
+func (h *PluginStatusHandler) List(c *gin.Context) {
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	statuses, err := h.service.PluginStatuses(uint(parkID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": statuses})
+}
+
+// Silent 列出插件超过阈值没有心跳的有效车场，threshold 如 30m、2h，省略时使用配置的默认阈值
+func (h *PluginStatusHandler) Silent(c *gin.Context) {
+	var threshold time.Duration
+	if value := c.Query("threshold"); value != "" {
+		var err error
+		threshold, err = time.ParseDuration(value)
+		if err != nil || threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid threshold"})
+			return
+		}
+	}
+
+	parks, err := h.service.SilentParks(threshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": parks, "total": len(parks)})
+}
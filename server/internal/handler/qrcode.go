@@ -2,11 +2,18 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"taizhang-server/internal/model"
 	"taizhang-server/internal/service"
+	"taizhang-server/internal/validation"
 )
 
 type QRCodeHandler struct {
@@ -31,8 +38,13 @@ func (h *QRCodeHandler) GetExternalVehicle(c *gin.Context) {
 
 func (h *QRCodeHandler) UpdateExternalVehicle(c *gin.Context) {
 	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	operator, err := bindOperator(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	qrcode, err := h.service.UpdateQRCode(uint(parkID), "external-vehicle")
+	qrcode, err := h.service.UpdateQRCode(uint(parkID), "external-vehicle", operator)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -55,8 +67,13 @@ func (h *QRCodeHandler) GetInternalVehicle(c *gin.Context) {
 
 func (h *QRCodeHandler) UpdateInternalVehicle(c *gin.Context) {
 	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	operator, err := bindOperator(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	qrcode, err := h.service.UpdateQRCode(uint(parkID), "internal-vehicle")
+	qrcode, err := h.service.UpdateQRCode(uint(parkID), "internal-vehicle", operator)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -79,8 +96,13 @@ func (h *QRCodeHandler) GetNonRoad(c *gin.Context) {
 
 func (h *QRCodeHandler) UpdateNonRoad(c *gin.Context) {
 	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+	operator, err := bindOperator(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	qrcode, err := h.service.UpdateQRCode(uint(parkID), "non-road")
+	qrcode, err := h.service.UpdateQRCode(uint(parkID), "non-road", operator)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -88,3 +110,151 @@ func (h *QRCodeHandler) UpdateNonRoad(c *gin.Context) {
 
 	c.JSON(http.StatusOK, qrcode)
 }
+
+// GetHistory 获取二维码令牌签发记录
+func (h *QRCodeHandler) GetHistory(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	histories, err := h.service.ListHistory(uint(parkID), qrcodeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, histories)
+}
+
+// GetRevokedScans 获取已作废二维码的扫码汇总
+func (h *QRCodeHandler) GetRevokedScans(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	summaries, err := h.service.ListRevokedScans(uint(parkID), qrcodeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetFieldsConfig 获取字段配置，未保存时返回默认模板
+func (h *QRCodeHandler) GetFieldsConfig(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	config, err := h.service.GetFieldsConfig(uint(parkID), qrcodeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// UpdateFieldsConfig 保存字段配置
+func (h *QRCodeHandler) UpdateFieldsConfig(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	var config model.FieldsConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.UpdateFieldsConfig(uint(parkID), qrcodeType, &config); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// GetImage 下载二维码图片
+func (h *QRCodeHandler) GetImage(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+		return
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(service.QRCodeImageDefaultSize)))
+	if err != nil || size < service.QRCodeImageMinSize || size > service.QRCodeImageMaxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size must be between %d and %d", service.QRCodeImageMinSize, service.QRCodeImageMaxSize)})
+		return
+	}
+
+	data, contentType, err := h.service.RenderImage(uint(parkID), qrcodeType, format, size)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// GetPoster 下载可打印的二维码海报
+func (h *QRCodeHandler) GetPoster(c *gin.Context) {
+	qrcodeType := c.Param("type")
+	if !validation.SupportedType(qrcodeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported qrcode type"})
+		return
+	}
+	parkID, _ := strconv.ParseUint(c.Query("park_id"), 10, 32)
+
+	data, filename, err := h.service.RenderPoster(uint(parkID), qrcodeType)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=qrcode_poster.pdf; filename*=UTF-8''%s", url.PathEscape(filename)))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// bindOperator 读取请求体中可选的操作人，请求体为空时返回空字符串
+func bindOperator(c *gin.Context) (string, error) {
+	var req struct {
+		Operator string `json:"operator"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return req.Operator, nil
+}
@@ -2,10 +2,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"taizhang-server/internal/model"
 	"taizhang-server/internal/service"
 )
@@ -27,7 +29,7 @@ func (h *ExternalVehicleHandler) Create(c *gin.Context) {
 	}
 
 	if err := h.service.Create(&vehicle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -88,7 +90,7 @@ func (h *ExternalVehicleHandler) Update(c *gin.Context) {
 
 	vehicle.ID = uint(id)
 	if err := h.service.Update(&vehicle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -110,22 +112,79 @@ func (h *ExternalVehicleHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
+// Audit 审核操作：status 为 approved（审核通过）、rejected（驳回）或 resubmitted（重新提交）
 func (h *ExternalVehicleHandler) Audit(c *gin.Context) {
-	var req struct {
-		ID     uint   `json:"id"`
-		Status string `json:"status"`
-	}
+	var req model.AuditRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.service.Audit(req.ID, req.Status); err != nil {
+	vehicle, err := h.service.Audit(&req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		case errors.Is(err, service.ErrAuditNotAllowed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// AuditRecords 查询车辆的审核记录
+func (h *ExternalVehicleHandler) AuditRecords(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	records, err := h.service.AuditRecords(uint(id))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "success"})
+	c.JSON(http.StatusOK, records)
+}
+
+// BatchAudit 批量审核：按 ids 或 filter 选择车辆，dry_run 时只预览结果
+func (h *ExternalVehicleHandler) BatchAudit(c *gin.Context) {
+	var req model.BatchAuditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.BatchAudit(&req)
+	if err != nil {
+		writeBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// BatchDispatch 批量下发：按 ids 或 filter 选择车辆，dry_run 时只预览结果
+func (h *ExternalVehicleHandler) BatchDispatch(c *gin.Context) {
+	var req model.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.BatchDispatch(&req)
+	if err != nil {
+		writeBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
 func (h *ExternalVehicleHandler) Dispatch(c *gin.Context) {
@@ -160,7 +219,7 @@ func (h *InternalVehicleHandler) Create(c *gin.Context) {
 	}
 
 	if err := h.service.Create(&vehicle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -220,7 +279,7 @@ func (h *InternalVehicleHandler) Update(c *gin.Context) {
 
 	vehicle.ID = uint(id)
 	if err := h.service.Update(&vehicle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -242,6 +301,23 @@ func (h *InternalVehicleHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
+// BatchDispatch 批量下发：按 ids 或 filter 选择车辆，dry_run 时只预览结果
+func (h *InternalVehicleHandler) BatchDispatch(c *gin.Context) {
+	var req model.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.BatchDispatch(&req)
+	if err != nil {
+		writeBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 func (h *InternalVehicleHandler) Dispatch(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -274,7 +350,7 @@ func (h *NonRoadHandler) Create(c *gin.Context) {
 	}
 
 	if err := h.service.Create(&machinery); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -335,7 +411,7 @@ func (h *NonRoadHandler) Update(c *gin.Context) {
 
 	machinery.ID = uint(id)
 	if err := h.service.Update(&machinery); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -357,6 +433,23 @@ func (h *NonRoadHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
+// BatchDispatch 批量下发：按 ids 或 filter 选择机械，dry_run 时只预览结果
+func (h *NonRoadHandler) BatchDispatch(c *gin.Context) {
+	var req model.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.BatchDispatch(&req)
+	if err != nil {
+		writeBatchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 func (h *NonRoadHandler) Dispatch(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -371,3 +464,12 @@ func (h *NonRoadHandler) Dispatch(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
+
+// writeBatchError 批量请求本身不合法时返回 400，单条记录的失败在结果中逐条返回
+func writeBatchError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidBatch) || errors.Is(err, service.ErrAuditNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,275 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/storage"
+
+	"golang.org/x/image/webp"
+)
+
+// maxPixels 解码前按图片尺寸拒绝过大的图片，避免解压后占用过多内存
+const maxPixels = 50_000_000
+
+var (
+	// ErrUnsupported 不支持的图片格式
+	ErrUnsupported = errors.New("unsupported image type")
+	// ErrInvalidImage 图片无法解码或尺寸过大
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// extensions 处理后的图片类型及扩展名
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Result 处理后的图片
+type Result struct {
+	Data        []byte
+	ContentType string
+	Thumbnail   []byte // JPEG 缩略图
+}
+
+// Saved 已保存的图片
+type Saved struct {
+	Key         string
+	ContentType string
+	Size        int64
+	Thumbnail   bool // 是否生成了缩略图，见 storage.ThumbnailKey
+}
+
+// Processor 照片入库前的处理：去除 EXIF 等元数据（含拍摄位置），按 EXIF 方向摆正，
+// 缩小超出尺寸上限的原图、重新压缩较大的原图，并生成固定尺寸的缩略图
+type Processor struct {
+	thumbnailSize  int
+	maxDimension   int
+	quality        int
+	recompressSize int64
+}
+
+func New(cfg config.StorageConfig) *Processor {
+	return &Processor{
+		thumbnailSize:  cfg.ThumbnailSize,
+		maxDimension:   cfg.MaxDimension,
+		quality:        cfg.JPEGQuality,
+		recompressSize: cfg.RecompressSize,
+	}
+}
+
+// Process 处理图片，支持 JPEG、PNG 和 WebP
+func (p *Processor) Process(data []byte) (*Result, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg":
+		return p.processJPEG(data)
+	case "image/png":
+		return p.processPNG(data)
+	case "image/webp":
+		return p.processWebP(data)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+}
+
+// Save 处理图片后保存原图和缩略图，原图键为 prefix + 处理后内容的哈希 + 扩展名，相同图片得到相同的键
+func (p *Processor) Save(ctx context.Context, store storage.Storage, prefix string, data []byte) (*Saved, error) {
+	result, err := p.Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(result.Data)
+	key := prefix + hex.EncodeToString(sum[:16]) + extensions[result.ContentType]
+	// 先保存缩略图，原图保存成功即说明缩略图已就绪
+	if result.Thumbnail != nil {
+		if err := store.Put(ctx, storage.ThumbnailKey(key), result.Thumbnail, "image/jpeg"); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.Put(ctx, key, result.Data, result.ContentType); err != nil {
+		return nil, err
+	}
+	return &Saved{
+		Key:         key,
+		ContentType: result.ContentType,
+		Size:        int64(len(result.Data)),
+		Thumbnail:   result.Thumbnail != nil,
+	}, nil
+}
+
+func (p *Processor) processJPEG(data []byte) (*Result, error) {
+	if err := checkSize(jpeg.DecodeConfig(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	orientation := jpegOrientation(data)
+
+	thumbnail, err := p.thumbnail(img, orientation)
+	if err != nil {
+		return nil, err
+	}
+
+	// 方向不正的照片去除 EXIF 后会显示错误，须按方向重新编码
+	resized, needResize := p.fit(img, orientation, p.maxDimension)
+	if needResize || orientation > 1 || int64(len(data)) > p.recompressSize {
+		encoded, err := p.encodeJPEG(resized)
+		if err != nil {
+			return nil, err
+		}
+		if needResize || orientation > 1 || len(encoded) < len(data) {
+			return &Result{Data: encoded, ContentType: "image/jpeg", Thumbnail: thumbnail}, nil
+		}
+	}
+
+	stripped, err := stripJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Data: stripped, ContentType: "image/jpeg", Thumbnail: thumbnail}, nil
+}
+
+func (p *Processor) processPNG(data []byte) (*Result, error) {
+	if err := checkSize(png.DecodeConfig(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	thumbnail, err := p.thumbnail(img, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	resized, needResize := p.fit(img, 1, p.maxDimension)
+	if needResize || int64(len(data)) > p.recompressSize {
+		// 不透明的大图（照片截图等）转为 JPEG，透明图片仍保存为 PNG
+		if opaque(resized) {
+			encoded, err := p.encodeJPEG(resized)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Data: encoded, ContentType: "image/jpeg", Thumbnail: thumbnail}, nil
+		}
+		var buf bytes.Buffer
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, resized); err != nil {
+			return nil, err
+		}
+		if needResize || buf.Len() < len(data) {
+			return &Result{Data: buf.Bytes(), ContentType: "image/png", Thumbnail: thumbnail}, nil
+		}
+	}
+
+	stripped, err := stripPNG(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Data: stripped, ContentType: "image/png", Thumbnail: thumbnail}, nil
+}
+
+// processWebP 没有 WebP 编码器：原图去除元数据后保存，超出尺寸上限时缩小并转为 JPEG（透明图片转为 PNG）
+func (p *Processor) processWebP(data []byte) (*Result, error) {
+	if err := checkSize(webp.DecodeConfig(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	thumbnail, err := p.thumbnail(img, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if resized, needResize := p.fit(img, 1, p.maxDimension); needResize {
+		if opaque(resized) {
+			encoded, err := p.encodeJPEG(resized)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Data: encoded, ContentType: "image/jpeg", Thumbnail: thumbnail}, nil
+		}
+		var buf bytes.Buffer
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, resized); err != nil {
+			return nil, err
+		}
+		return &Result{Data: buf.Bytes(), ContentType: "image/png", Thumbnail: thumbnail}, nil
+	}
+
+	stripped, err := stripWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Data: stripped, ContentType: "image/webp", Thumbnail: thumbnail}, nil
+}
+
+// thumbnail 生成最长边不超过 thumbnailSize 的 JPEG 缩略图，透明部分填充白色
+func (p *Processor) thumbnail(img image.Image, orientation int) ([]byte, error) {
+	small, _ := p.fit(img, orientation, p.thumbnailSize)
+	flat := image.NewRGBA(small.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), small, small.Bounds().Min, draw.Over)
+	return p.encodeJPEG(flat)
+}
+
+// fit 按方向摆正图片并缩小到最长边不超过 limit，resized 表示是否缩小了
+func (p *Processor) fit(img image.Image, orientation, limit int) (out image.Image, resized bool) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if limit > 0 && (w > limit || h > limit) {
+		if w >= h {
+			w, h = limit, max(1, h*limit/w)
+		} else {
+			w, h = max(1, w*limit/h), limit
+		}
+		resized = true
+	}
+	if !resized && orientation <= 1 {
+		return img, false
+	}
+	// 缩放前后宽高方向不变，摆正在缩小后进行以减少计算量
+	return orient(resize(img, w, h), orientation), resized
+}
+
+func (p *Processor) encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func checkSize(cfg image.Config, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return fmt.Errorf("%w: 图片尺寸 %dx%d 超出限制", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
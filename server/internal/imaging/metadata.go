@@ -0,0 +1,188 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// jpegOrientation 读取 JPEG 中 EXIF 的方向值，没有或无法解析时返回 1
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	_, _ = walkJPEG(data, func(marker byte, segment []byte) bool {
+		if marker != 0xE1 || !bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			return true
+		}
+		if o := exifOrientation(segment[10:]); o > 0 {
+			orientation = o
+		}
+		return false
+	})
+	return orientation
+}
+
+// exifOrientation 在 TIFF 结构的第 0 个 IFD 中查找方向标签（0x0112）
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// 类型 3 为 SHORT，值直接存放在条目中
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// stripJPEG 去除 JPEG 中的 EXIF、XMP、IPTC 和注释段，只保留 JFIF（APP0）、ICC 色彩配置（APP2）和 Adobe（APP14）应用段
+// 文件结束标记之后附加的图片（多图格式的预览图等）也一并去除
+func stripJPEG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	start, err := walkJPEG(data, func(marker byte, segment []byte) bool {
+		keep := marker == 0xE0 || marker == 0xEE ||
+			marker == 0xE2 && bytes.HasPrefix(segment[4:], []byte("ICC_PROFILE\x00")) ||
+			marker < 0xE0 || marker > 0xEF && marker != 0xFE
+		if keep {
+			out = append(out, segment...)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 扫描数据中的 0xFF 均已转义，第一个 FFD9 即为结束标记
+	scan := data[start:]
+	if end := bytes.Index(scan, []byte{0xFF, 0xD9}); end >= 0 {
+		scan = scan[:end+2]
+	}
+	return append(out, scan...), nil
+}
+
+// walkJPEG 依次回调扫描数据之前的各段，segment 含标记和长度，回调返回 false 时停止
+// 返回停止处或扫描数据（SOS 段）的起始位置
+func walkJPEG(data []byte, fn func(marker byte, segment []byte) bool) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, fmt.Errorf("%w: 不是 JPEG 文件", ErrInvalidImage)
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 0, fmt.Errorf("%w: JPEG 段标记错误", ErrInvalidImage)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // 填充字节
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return pos, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 0, fmt.Errorf("%w: JPEG 段长度错误", ErrInvalidImage)
+		}
+		if !fn(marker, data[pos:pos+2+length]) {
+			return pos, nil
+		}
+		pos += 2 + length
+	}
+	return 0, fmt.Errorf("%w: JPEG 文件不完整", ErrInvalidImage)
+}
+
+// pngMetadataChunks 去除的 PNG 数据块：EXIF、文本和修改时间
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG 去除 PNG 中的元数据块
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, fmt.Errorf("%w: 不是 PNG 文件", ErrInvalidImage)
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, signature...)
+	for pos := len(signature); pos < len(data); {
+		if pos+12 > len(data) {
+			return nil, fmt.Errorf("%w: PNG 文件不完整", ErrInvalidImage)
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("%w: PNG 数据块长度错误", ErrInvalidImage)
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out, nil
+}
+
+// stripWebP 去除 WebP 中的 EXIF 和 XMP 数据块，并清除 VP8X 中对应的标志位
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("%w: 不是 WebP 文件", ErrInvalidImage)
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("%w: WebP 文件不完整", ErrInvalidImage)
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2 // 数据块按偶数字节对齐
+		if end == len(data)+1 {
+			end = len(data) // 部分编码器省略最后一个数据块的填充字节
+		}
+		if size < 0 || end > len(data) {
+			return nil, fmt.Errorf("%w: WebP 数据块长度错误", ErrInvalidImage)
+		}
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[pos:end]...)
+			if size > 0 {
+				out[start+8] &^= 0x08 | 0x04 // EXIF、XMP 标志
+			}
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,242 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage w×h 的渐变图片，各像素颜色不同
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+// jpegSegment 组装 JPEG 段：标记、长度和内容
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// exifSegment 只含方向标签的 EXIF（APP1）段，字节序为大端
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // 值填充和下一个 IFD 偏移
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// jpegWithMetadata 在编码后的 JPEG 起始标记后插入 JFIF、EXIF、XMP、ICC 和注释段，并在结束标记后附加预览图
+func jpegWithMetadata(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	var data []byte
+	data = append(data, encoded[:2]...)
+	data = append(data, jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))...)
+	data = append(data, exifSegment(orientation)...)
+	data = append(data, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+	data = append(data, jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile"))...)
+	data = append(data, jpegSegment(0xFE, []byte("GPS 39.9,116.4"))...)
+	data = append(data, encoded[2:]...)
+	return append(data, encoded...) // 多图格式的预览图
+}
+
+func jpegMarkers(t *testing.T, data []byte) map[byte]int {
+	t.Helper()
+	markers := make(map[byte]int)
+	if _, err := walkJPEG(data, func(marker byte, segment []byte) bool {
+		markers[marker]++
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return markers
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := jpegWithMetadata(t, testImage(16, 8), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("orientation = %d, want 6", got)
+	}
+	before := jpegMarkers(t, data)
+	if before[0xE1] != 2 || before[0xFE] != 1 {
+		t.Fatalf("fixture markers = %v", before)
+	}
+
+	stripped, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := jpegMarkers(t, stripped)
+	if markers[0xE1] != 0 || markers[0xFE] != 0 {
+		t.Errorf("APP1/COM segments left: %v", markers)
+	}
+	if markers[0xE0] != 1 || markers[0xE2] != 1 || markers[0xDB] == 0 || markers[0xC0] != 1 {
+		t.Errorf("JFIF, ICC, quantization or frame segments missing: %v", markers)
+	}
+	if bytes.Contains(stripped, []byte("Exif")) || bytes.Contains(stripped, []byte("GPS")) {
+		t.Error("metadata bytes left in output")
+	}
+	if got := jpegOrientation(stripped); got != 1 {
+		t.Errorf("orientation after strip = %d, want 1", got)
+	}
+	// 预览图被去除，结束标记为最后两个字节
+	if bytes.Count(stripped, []byte{0xFF, 0xD8}) != 1 || !bytes.HasSuffix(stripped, []byte{0xFF, 0xD9}) {
+		t.Error("trailing preview image not removed")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("decoded size = %v", b)
+	}
+
+	if _, err := stripJPEG([]byte("not a jpeg")); err == nil {
+		t.Error("stripJPEG(non-JPEG): want error")
+	}
+	if _, err := stripJPEG(data[:len(data)/4]); err == nil {
+		t.Error("stripJPEG(truncated header): want error")
+	}
+}
+
+func TestExifOrientationLittleEndian(t *testing.T) {
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 8)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	if got := exifOrientation(tiff); got != 8 {
+		t.Errorf("orientation = %d, want 8", got)
+	}
+	if got := exifOrientation(tiff[:12]); got != 0 {
+		t.Errorf("truncated orientation = %d, want 0", got)
+	}
+}
+
+// pngChunk 组装 PNG 数据块：长度、类型、内容和 CRC
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	iend := bytes.Index(encoded, []byte("IEND")) - 4
+
+	var data []byte
+	data = append(data, encoded[:iend]...)
+	data = append(data, pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08"))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00GPS 39.9,116.4"))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	data = append(data, pngChunk("tIME", []byte{0x07, 0xE8, 3, 1, 8, 0, 0})...)
+	data = append(data, encoded[iend:]...)
+	data = append(data, "trailing"...)
+
+	stripped, err := stripPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunkType := range []string{"eXIf", "tEXt", "iTXt", "tIME", "GPS", "trailing"} {
+		if bytes.Contains(stripped, []byte(chunkType)) {
+			t.Errorf("%s left in output", chunkType)
+		}
+	}
+	if !bytes.Equal(stripped, encoded) {
+		t.Error("stripped PNG differs from the original encoding")
+	}
+
+	if _, err := stripPNG([]byte("GIF89a")); err == nil {
+		t.Error("stripPNG(non-PNG): want error")
+	}
+	if _, err := stripPNG(data[:iend+6]); err == nil {
+		t.Error("stripPNG(truncated): want error")
+	}
+}
+
+// riffChunk 组装 WebP 数据块，奇数长度补一个填充字节
+func riffChunk(fourCC string, payload []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestStripWebP(t *testing.T) {
+	// VP8X 标志：ICC(0x20)、EXIF(0x08)、XMP(0x04)
+	vp8x := riffChunk("VP8X", []byte{0x20 | 0x08 | 0x04, 0, 0, 0, 15, 0, 0, 7, 0, 0})
+	iccp := riffChunk("ICCP", []byte("profile"))
+	bitstream := riffChunk("VP8L", []byte("\x2f\x0f\xc0\x01\x00pixels")) // 奇数长度，带填充字节
+	exif := riffChunk("EXIF", []byte("MM\x00\x2a\x00\x00\x00\x08GPS"))
+	xmp := riffChunk("XMP ", []byte("<x:xmpmeta/>"))
+	data := webpFile(vp8x, iccp, bitstream, exif, xmp)
+
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("EXIF")) || bytes.Contains(stripped, []byte("XMP ")) || bytes.Contains(stripped, []byte("GPS")) {
+		t.Error("EXIF/XMP chunks left in output")
+	}
+	want := webpFile(riffChunk("VP8X", []byte{0x20, 0, 0, 0, 15, 0, 0, 7, 0, 0}), iccp, bitstream)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("stripped = %q\nwant %q", stripped, want)
+	}
+
+	// 最后一个数据块省略了填充字节
+	unpadded := webpFile(vp8x, exif, bitstream)
+	unpadded = unpadded[:len(unpadded)-1]
+	binary.LittleEndian.PutUint32(unpadded[4:], uint32(len(unpadded)-8))
+	stripped, err = stripWebP(unpadded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("EXIF")) || binary.LittleEndian.Uint32(stripped[4:]) != uint32(len(stripped)-8) {
+		t.Errorf("unpadded: stripped = %q", stripped)
+	}
+
+	if _, err := stripWebP([]byte("RIFF\x00\x00\x00\x00WAVE")); err == nil {
+		t.Error("stripWebP(non-WebP): want error")
+	}
+	if _, err := stripWebP(webpFile(riffChunk("VP8L", make([]byte, 100)))[:40]); err == nil {
+		t.Error("stripWebP(truncated): want error")
+	}
+}
@@ -0,0 +1,93 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// resize 按区域平均缩放到 w×h，只用于缩小
+func resize(img image.Image, w, h int) *image.RGBA {
+	// YCbCr（JPEG）逐像素转换，其余格式先整体转为 RGBA
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+	src, isRGBA := img.(*image.RGBA)
+	if !isYCbCr && !isRGBA {
+		src = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+
+	b := img.Bounds()
+	if !isYCbCr {
+		b = src.Bounds()
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0 := b.Min.Y + dy*sh/h
+		y1 := max(b.Min.Y+(dy+1)*sh/h, y0+1)
+		for dx := 0; dx < w; dx++ {
+			x0 := b.Min.X + dx*sw/w
+			x1 := max(b.Min.X+(dx+1)*sw/w, x0+1)
+
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					if isYCbCr {
+						c := ycbcr.YCbCrAt(x, y)
+						cr, cg, cb := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+						r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+0xff
+					} else {
+						i := src.PixOffset(x, y)
+						r += uint64(src.Pix[i])
+						g += uint64(src.Pix[i+1])
+						bl += uint64(src.Pix[i+2])
+						a += uint64(src.Pix[i+3])
+					}
+					n++
+				}
+			}
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient 按 EXIF 方向值（1-8）摆正图片
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch orientation {
+			case 2: // 水平翻转
+				nx, ny = w-1-x, y
+			case 3: // 旋转180度
+				nx, ny = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				nx, ny = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				nx, ny = y, x
+			case 6: // 顺时针旋转90度
+				nx, ny = h-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				nx, ny = h-1-y, w-1-x
+			case 8: // 逆时针旋转90度
+				nx, ny = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(nx, ny):dst.PixOffset(nx, ny)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,150 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"taizhang-server/internal/config"
+
+	"golang.org/x/image/webp"
+)
+
+// letterImage 按字母网格生成图片，每个字母对应一种颜色，便于比对像素位置
+func letterImage(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			img.Set(x, y, color.RGBA{uint8(c), 0, 0, 255})
+		}
+	}
+	return img
+}
+
+func letters(img *image.RGBA) string {
+	var rows []string
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var sb strings.Builder
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sb.WriteByte(img.RGBAAt(x, y).R)
+		}
+		rows = append(rows, sb.String())
+	}
+	return strings.Join(rows, "/")
+}
+
+func TestOrient(t *testing.T) {
+	// 存储的图片为 abc/def，期望结果为按 EXIF 方向摆正后显示的图片
+	tests := []struct {
+		orientation int
+		want        string
+	}{
+		{0, "abc/def"}, // 无效值不处理
+		{1, "abc/def"},
+		{2, "cba/fed"},
+		{3, "fed/cba"},
+		{4, "def/abc"},
+		{5, "ad/be/cf"},
+		{6, "da/eb/fc"},
+		{7, "fc/eb/da"},
+		{8, "cf/be/ad"},
+		{9, "abc/def"},
+	}
+	for _, tt := range tests {
+		if got := letters(orient(letterImage("abc", "def"), tt.orientation)); got != tt.want {
+			t.Errorf("orient(%d) = %s, want %s", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	// 2×2 区域取平均
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.Set(x, 0, color.RGBA{200, 0, 0, 255})
+		src.Set(x, 1, color.RGBA{100, 0, 0, 255})
+	}
+	dst := resize(src, 2, 1)
+	if b := dst.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("size = %v", b)
+	}
+	if c := dst.RGBAAt(0, 0); c.R != 150 || c.A != 255 {
+		t.Errorf("pixel = %v, want R 150", c)
+	}
+
+	// 非零起点的子图按自身区域缩放
+	sub := letterImage("aabb", "aabb", "ccdd", "ccdd").SubImage(image.Rect(2, 2, 4, 4))
+	if got := letters(resize(sub, 1, 1)); got != "d" {
+		t.Errorf("sub image = %s, want d", got)
+	}
+}
+
+func TestProcessOrientedJPEG(t *testing.T) {
+	p := New(config.StorageConfig{ThumbnailSize: 10, MaxDimension: 1000, JPEGQuality: 90, RecompressSize: 1 << 20})
+	data := jpegWithMetadata(t, testImage(40, 20), 6)
+
+	result, err := p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/jpeg" || jpegOrientation(result.Data) != 1 || bytes.Contains(result.Data, []byte("Exif")) {
+		t.Errorf("result = %s, orientation %d", result.ContentType, jpegOrientation(result.Data))
+	}
+	// 顺时针旋转90度后宽高互换
+	for name, data := range map[string][]byte{"image": result.Data, "thumbnail": result.Thumbnail} {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.Width >= cfg.Height {
+			t.Errorf("%s size = %dx%d, want portrait", name, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestProcessWebP(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "blue-purple-pink.lossy.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := webp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(config.StorageConfig{ThumbnailSize: 16, MaxDimension: 1000, JPEGQuality: 90, RecompressSize: 1 << 20})
+	result, err := p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/webp" || len(result.Thumbnail) == 0 {
+		t.Fatalf("result = %s, thumbnail %d bytes", result.ContentType, len(result.Thumbnail))
+	}
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(result.Thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max(thumb.Width, thumb.Height) != 16 {
+		t.Errorf("thumbnail size = %dx%d, want longest side 16", thumb.Width, thumb.Height)
+	}
+
+	// 超出尺寸上限时缩小并转为 JPEG
+	p = New(config.StorageConfig{ThumbnailSize: 16, MaxDimension: 32, JPEGQuality: 90, RecompressSize: 1 << 20})
+	result, err = p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resized, err := jpeg.DecodeConfig(bytes.NewReader(result.Data))
+	if err != nil || result.ContentType != "image/jpeg" {
+		t.Fatalf("resized = %s, %v", result.ContentType, err)
+	}
+	if max(resized.Width, resized.Height) != 32 || (cfg.Width > cfg.Height) != (resized.Width > resized.Height) {
+		t.Errorf("resized = %dx%d from %dx%d", resized.Width, resized.Height, cfg.Width, cfg.Height)
+	}
+}
@@ -2,9 +2,19 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"taizhang-server/internal/model"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -53,3 +63,160 @@ func Logging() gin.HandlerFunc {
 		)
 	}
 }
+
+// RateLimit 按客户端 IP 限制请求频率，每个时间窗口内至多 limit 次，超出返回 429；limit 为 0 时不限制
+// 计数保存在进程内存中，多实例部署时各实例分别计数
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	type counter struct {
+		count int
+		reset time.Time
+	}
+	var (
+		mu       sync.Mutex
+		counters = make(map[string]*counter)
+		cleanAt  time.Time
+	)
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := c.ClientIP()
+
+		mu.Lock()
+		// 每个时间窗口清理一次过期的计数
+		if now.After(cleanAt) {
+			for key, entry := range counters {
+				if now.After(entry.reset) {
+					delete(counters, key)
+				}
+			}
+			cleanAt = now.Add(window)
+		}
+		entry, ok := counters[ip]
+		if !ok || now.After(entry.reset) {
+			entry = &counter{reset: now.Add(window)}
+			counters[ip] = entry
+		}
+		entry.count++
+		allowed := entry.count <= limit
+		retryAfter := entry.reset.Sub(now)
+		mu.Unlock()
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 插件认证信息在请求上下文中的键
+const (
+	PluginParkIDKey          = "plugin_park_id"          // 令牌所属车场ID
+	PluginProtocolVersionKey = "plugin_protocol_version" // 验证时协商的协议版本
+	PluginEncryptionKey      = "plugin_encryption"       // 验证时协商的载荷加密方式
+	PluginSessionKey         = "plugin_session"          // 令牌记录 *model.PluginAuth
+)
+
+// 插件请求签名相关请求头
+const (
+	HeaderParkID    = "X-Park-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// maxSignedBodySize 参与签名的请求体大小上限
+const maxSignedBodySize = 8 << 20
+
+// PluginRequestVerifier 校验插件请求签名
+type PluginRequestVerifier interface {
+	VerifyRequest(req *model.SignedRequest) error
+}
+
+// PluginSignature PC端插件请求签名中间件，校验通过后将签名车场写入上下文
+// 签名覆盖请求方法、路径、时间戳、随机数和请求体摘要，读取后的请求体会还原供后续处理
+func PluginSignature(verifier PluginRequestVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parkID, err := strconv.ParseUint(c.GetHeader(HeaderParkID), 10, 32)
+		if err != nil || parkID == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid " + HeaderParkID})
+			return
+		}
+		timestamp, err := strconv.ParseInt(c.GetHeader(HeaderTimestamp), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid " + HeaderTimestamp})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		err = verifier.VerifyRequest(&model.SignedRequest{
+			ParkID:    uint(parkID),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.RequestURI(),
+			Timestamp: timestamp,
+			Nonce:     c.GetHeader(HeaderNonce),
+			BodyHash:  hex.EncodeToString(sum[:]),
+			Signature: c.GetHeader(HeaderSignature),
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(PluginParkIDKey, uint(parkID))
+		c.Next()
+	}
+}
+
+// PluginAuthenticator 校验插件会话令牌
+type PluginAuthenticator interface {
+	AuthenticateToken(token string) (*model.PluginAuth, error)
+}
+
+// PluginAuth PC端插件令牌认证中间件，通过后将令牌所属车场写入上下文
+// 与 PluginSignature 同时使用时，令牌所属车场须与签名车场一致
+func PluginAuth(auth PluginAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		session, err := auth.AuthenticateToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if signed, ok := c.Get(PluginParkIDKey); ok && signed.(uint) != session.ParkID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token does not belong to this park"})
+			return
+		}
+
+		c.Set(PluginParkIDKey, session.ParkID)
+		c.Set(PluginProtocolVersionKey, session.ProtocolVersion)
+		c.Set(PluginEncryptionKey, session.Encryption)
+		c.Set(PluginSessionKey, session)
+		c.Next()
+	}
+}
+
+// BearerToken 读取 Authorization 请求头中的 Bearer 令牌
+func BearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -49,19 +52,106 @@ type Company struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// 二维码类型
+const (
+	QRCodeTypeExternalVehicle = "external-vehicle" // 厂外运输车辆
+	QRCodeTypeInternalVehicle = "internal-vehicle" // 厂内运输车辆
+	QRCodeTypeNonRoad         = "non-road"         // 非道路移动机械
+)
+
+// QRCodeTypes 每个车场都应具备的二维码类型
+var QRCodeTypes = []string{QRCodeTypeExternalVehicle, QRCodeTypeInternalVehicle, QRCodeTypeNonRoad}
+
 // QRCode 二维码配置
 type QRCode struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	ParkID       uint      `gorm:"not null;index" json:"park_id"`
+	ParkID       uint      `gorm:"not null;index;uniqueIndex:idx_qr_codes_park_type" json:"park_id"`
 	Park         Park      `gorm:"foreignKey:ParkID" json:"park,omitempty"`
-	Type         string    `gorm:"type:varchar(20);not null" json:"type"` // external-vehicle, internal-vehicle, non-road
-	Content      string    `gorm:"type:text;not null" json:"content"`
+	Type         string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_qr_codes_park_type" json:"type"` // external-vehicle, internal-vehicle, non-road，每个车场每种类型一个
+	Content      string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"content"`                    // 二维码内容令牌，扫码时据此定位车场和类型
 	IsEnabled    bool      `gorm:"default:true" json:"is_enabled"`
 	FieldsConfig string    `gorm:"type:json" json:"fields_config"` // 字段配置JSON
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// 字段配置中的功能开关
+const (
+	FeatureCompany         = "company"          // 公司管理：扫码登记时选择公司
+	FeatureEntryNotice     = "entry_notice"     // 入厂通知：扫码后展示通知内容
+	FeatureDepartmentAudit = "department_audit" // 部门审核
+	FeatureAutoDispatch    = "auto_dispatch"    // 自动下发：新增或修改后立即下发到PC端插件
+)
+
+// FieldsConfig 二维码字段配置（存储于 QRCode.FieldsConfig）
+type FieldsConfig struct {
+	Enabled  bool             `json:"enabled"`  // 是否启用字段配置，未启用时使用系统默认规则
+	Fields   []FieldSetting   `json:"fields"`   // 字段显示/必填设置
+	Features []FeatureSetting `json:"features"` // 功能开关
+}
+
+// FieldSetting 字段显示/必填设置
+type FieldSetting struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Visible  bool   `json:"visible"`  // 用户扫码或管理员人工录入时是否显示
+	Required bool   `json:"required"` // 是否必填
+}
+
+// FeatureSetting 功能开关（无必填选项）
+type FeatureSetting struct {
+	Key     string `json:"key"`
+	Label   string `json:"label"`
+	Enabled bool   `json:"enabled"`
+	Content string `json:"content,omitempty"` // 功能附带内容，如入厂通知正文
+
+	Departments []uint `json:"departments,omitempty"` // 部门审核：须依次审核通过的部门ID
+}
+
+// Feature 按 key 查找功能开关
+func (c *FieldsConfig) Feature(key string) (FeatureSetting, bool) {
+	for _, f := range c.Features {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return FeatureSetting{}, false
+}
+
+// QRCodeHistory 二维码令牌签发记录，每次更换二维码时旧令牌在此标记为已作废
+type QRCodeHistory struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	QRCodeID  uint       `gorm:"not null;index" json:"qrcode_id"`
+	ParkID    uint       `gorm:"not null;index" json:"park_id"`
+	Type      string     `gorm:"type:varchar(20);not null" json:"type"`
+	Content   string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"content"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	RevokedAt *time.Time `json:"revoked_at"`                         // 为空表示当前有效
+	RotatedBy string     `gorm:"type:varchar(50)" json:"rotated_by"` // 更换（作废）该令牌的操作人
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// QRCodeScanLog 已作废二维码的扫码记录，便于车场找出仍在张贴的旧海报
+type QRCodeScanLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	HistoryID uint      `gorm:"not null;index" json:"history_id"`
+	ParkID    uint      `gorm:"not null;index" json:"park_id"`
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"`
+	Content   string    `gorm:"type:varchar(100);not null" json:"content"`
+	Accepted  bool      `json:"accepted"` // 是否在宽限期内被接受
+	ClientIP  string    `gorm:"type:varchar(50)" json:"client_ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevokedScanSummary 已作废二维码的扫码汇总
+type RevokedScanSummary struct {
+	HistoryID     uint      `json:"history_id"`
+	Content       string    `json:"content"`
+	ScanCount     int64     `json:"scan_count"`
+	AcceptedCount int64     `json:"accepted_count"` // 宽限期内被接受的次数
+	LastScannedAt time.Time `json:"last_scanned_at"`
+}
+
 // ExternalVehicle 厂外运输车辆
 type ExternalVehicle struct {
 	ID        uint     `gorm:"primaryKey" json:"id"`
@@ -104,15 +194,20 @@ type ExternalVehicle struct {
 	OutboundCargoName   string   `gorm:"type:varchar(100)" json:"outbound_cargo_name"`
 	OutboundCargoWeight *float64 `json:"outbound_cargo_weight"`
 
-	// 照片
-	VehiclePhoto        string `gorm:"type:varchar(500)" json:"vehicle_photo"`
-	DrivingLicensePhoto string `gorm:"type:varchar(500)" json:"driving_license_photo"`
-	VehicleListPhoto    string `gorm:"type:varchar(500)" json:"vehicle_list_photo"`
+	// 照片：行驶证主页、副页、车头照片、随车清单
+	Attachments Attachments `gorm:"type:json" json:"attachments"`
+	// 照片的限时下载地址，按照片类型索引：列表接口为缩略图，详情接口为原图
+	PhotoURLs map[string]string `gorm:"-" json:"photo_urls,omitempty"`
+
+	// 证照识别：提交时携带识别记录ID，服务端据此记录各字段来源（ocr、edited、manual）
+	OCRRecognitionIDs []uint          `gorm:"-" json:"ocr_recognition_ids,omitempty"`
+	FieldSources      json.RawMessage `gorm:"type:json" json:"field_sources"` // map[字段]来源，未列出的字段为空
 
 	// 审核与下发
-	AuditStatus    string     `gorm:"type:varchar(20);default:'unaudited'" json:"audit_status"`       // audited, unaudited
+	AuditStatus    string     `gorm:"type:varchar(20);default:'pending'" json:"audit_status"`         // pending, approved, rejected, resubmitted
+	AuditStep      int        `gorm:"default:0" json:"audit_step"`                                    // 部门审核：本轮已通过的部门数
 	DispatchStatus string     `gorm:"type:varchar(20);default:'undispatched'" json:"dispatch_status"` // dispatched, undispatched
-	NetworkStatus  string     `gorm:"type:varchar(20)" json:"network_status"`
+	NetworkStatus  string     `gorm:"type:varchar(20)" json:"network_status"`                         // online, pending, failed，由下发确认结果得出
 	DispatchCount  int        `gorm:"default:0" json:"dispatch_count"`
 	DispatchTime   *time.Time `json:"dispatch_time"`
 
@@ -122,6 +217,313 @@ type ExternalVehicle struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// 厂外运输车辆审核状态
+// 待审核(pending) 和 重新提交(resubmitted) 可审核通过或驳回，驳回(rejected) 后可重新提交，审核通过(approved) 后才能下发
+const (
+	AuditStatusPending     = "pending"
+	AuditStatusApproved    = "approved"
+	AuditStatusRejected    = "rejected"
+	AuditStatusResubmitted = "resubmitted"
+)
+
+// 审核操作
+const (
+	AuditActionApprove  = "approve"
+	AuditActionReject   = "reject"
+	AuditActionResubmit = "resubmit"
+)
+
+// AuditRecord 厂外运输车辆审核记录，每次状态变更一条
+type AuditRecord struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ParkID         uint      `gorm:"not null;index" json:"park_id"`
+	VehicleID      uint      `gorm:"not null;index" json:"vehicle_id"`
+	Action         string    `gorm:"type:varchar(20);not null" json:"action"` // approve, reject, resubmit
+	FromStatus     string    `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus       string    `gorm:"type:varchar(20)" json:"to_status"`
+	Step           int       `gorm:"default:0" json:"step"` // 部门审核：本次审核的部门序号（从1开始），未启用部门审核时为0
+	Auto           bool      `gorm:"default:false" json:"auto"`
+	UserID         *uint     `json:"user_id"`
+	UserName       string    `gorm:"type:varchar(50)" json:"user_name"`
+	DepartmentID   *uint     `json:"department_id"`
+	DepartmentName string    `gorm:"type:varchar(50)" json:"department_name"`
+	Reason         string    `gorm:"type:varchar(500)" json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// BatchFilter 批量操作的筛选条件，须指定车场
+type BatchFilter struct {
+	ParkID            uint   `json:"park_id"`
+	LicensePlate      string `json:"license_plate"`      // 模糊匹配
+	AuditStatus       string `json:"audit_status"`       // 仅厂外运输车辆；unaudited 表示待审核和重新提交
+	DispatchStatus    string `json:"dispatch_status"`    // dispatched, undispatched
+	EmissionStandard  string `json:"emission_standard"`  // 国6、国VI 等写法均按国六匹配
+	EnvironmentalCode string `json:"environmental_code"` // 仅非道路移动机械
+}
+
+// BatchRequest 批量操作的目标：指定 ids，或按 filter 筛选；dry_run 时只预览结果不做修改
+type BatchRequest struct {
+	IDs    []uint       `json:"ids"`
+	Filter *BatchFilter `json:"filter"`
+	DryRun bool         `json:"dry_run"`
+}
+
+// BatchAuditRequest 批量审核请求
+type BatchAuditRequest struct {
+	BatchRequest
+	Status string `json:"status"` // 目标状态：approved、rejected、resubmitted
+	Reason string `json:"reason"`
+	UserID *uint  `json:"user_id"`
+}
+
+// BatchItemResult 批量操作中单条记录的结果
+type BatchItemResult struct {
+	ID           uint   `json:"id"`
+	LicensePlate string `json:"license_plate"`
+	Success      bool   `json:"success"`
+	Status       string `json:"status,omitempty"` // 批量审核：操作后的审核状态
+	Error        string `json:"error,omitempty"`
+}
+
+// BatchResult 批量操作结果，逐条返回成功或失败原因
+type BatchResult struct {
+	DryRun    bool              `json:"dry_run"`
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// Add 记录单条结果并更新计数
+func (r *BatchResult) Add(item BatchItemResult) {
+	r.Total++
+	if item.Success {
+		r.Succeeded++
+	} else {
+		r.Failed++
+	}
+	r.Results = append(r.Results, item)
+}
+
+// AuditRequest 审核操作请求
+type AuditRequest struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"`  // 目标状态：approved、rejected、resubmitted
+	Reason string `json:"reason"`  // 审核理由，可为空
+	UserID *uint  `json:"user_id"` // 审核人，启用部门审核时必填且须属于当前审核部门
+}
+
+// 自动审核规则类型
+const (
+	AuditRuleEmissionStandard = "emission_standard" // 排放标准须在允许范围内
+	AuditRuleThirdPartyMatch  = "third_party_match" // 须能查到第三方随车清单数据
+	AuditRulePhotosComplete   = "photos_complete"   // 照片须上传齐全
+	AuditRuleBlacklist        = "blacklist"         // 车牌、VIN 不得命中车场黑名单
+)
+
+// 自动审核决定，规则不满足时的处理取其一
+const (
+	AuditDecisionApprove = "approve" // 自动通过并下发
+	AuditDecisionReview  = "review"  // 转人工审核
+	AuditDecisionReject  = "reject"  // 直接驳回
+)
+
+// AuditRule 自动审核规则
+type AuditRule struct {
+	Kind              string   `json:"kind"`
+	Enabled           bool     `json:"enabled"`
+	Action            string   `json:"action"`                       // 不满足时的处理：review 或 reject
+	EmissionStandards []string `json:"emission_standards,omitempty"` // emission_standard：允许的排放标准，如 国五、国六
+	Photos            []string `json:"photos,omitempty"`             // photos_complete：须上传的照片类型，为空时四张均须上传
+	MatchEmission     bool     `json:"match_emission,omitempty"`     // third_party_match：排放标准须与第三方数据一致
+}
+
+// AuditRulesConfig 车场的自动审核规则配置（存储于 AuditPolicy.Rules）
+type AuditRulesConfig struct {
+	Enabled bool        `json:"enabled"` // 未启用时车主提交的车辆全部转人工审核
+	Rules   []AuditRule `json:"rules"`   // 按顺序执行
+}
+
+// AuditPolicy 车场的自动审核规则，每个车场一条
+type AuditPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ParkID    uint      `gorm:"not null;uniqueIndex" json:"park_id"`
+	Rules     string    `gorm:"type:json" json:"rules"` // 规则配置JSON
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuditRuleResult 单条规则的判定结果
+type AuditRuleResult struct {
+	Kind    string `json:"kind"`
+	Passed  bool   `json:"passed"`
+	Action  string `json:"action,omitempty"` // 未通过时的处理
+	Message string `json:"message"`
+}
+
+// AuditDecision 自动审核决定，记录决定性规则及全部规则的判定结果
+type AuditDecision struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ParkID    uint            `gorm:"not null;index" json:"park_id"`
+	VehicleID uint            `gorm:"not null;index" json:"vehicle_id"`
+	Decision  string          `gorm:"type:varchar(20);not null" json:"decision"` // approve, review, reject
+	Rule      string          `gorm:"type:varchar(50)" json:"rule"`              // 决定性规则，全部通过时为空
+	Reason    string          `gorm:"type:varchar(500)" json:"reason"`
+	Results   json.RawMessage `gorm:"type:json" json:"results"` // []AuditRuleResult
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// VehicleBlacklist 车场车辆黑名单，按车牌或 VIN 匹配
+type VehicleBlacklist struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ParkID       uint      `gorm:"not null;index" json:"park_id"`
+	LicensePlate string    `gorm:"type:varchar(20);index" json:"license_plate"`
+	VIN          string    `gorm:"type:varchar(17);index" json:"vin"`
+	Reason       string    `gorm:"type:varchar(200)" json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// 证照类型
+const (
+	OCRKindDrivingLicense     = "driving_license"      // 行驶证主页
+	OCRKindDrivingLicenseBack = "driving_license_back" // 行驶证副页
+	OCRKindNameplate          = "nameplate"            // 车辆铭牌
+)
+
+// 照片类型
+const (
+	// 厂外、厂内运输车辆
+	AttachmentDrivingLicenseMain = "driving_license_main" // 行驶证主页
+	AttachmentDrivingLicenseSub  = "driving_license_sub"  // 行驶证副页
+	AttachmentVehicleFront       = "vehicle_front"        // 车头照片
+	AttachmentVehicleList        = "vehicle_list"         // 随车清单
+	// 非道路移动机械
+	AttachmentMachineNameplate   = "machine_nameplate"   // 整车（机）铭牌
+	AttachmentEngineNameplate    = "engine_nameplate"    // 发动机铭牌
+	AttachmentEnvironmentalLabel = "environmental_label" // 机械环保信息标
+	AttachmentDevice             = "device"              // 设备照片
+)
+
+// LegacyPhotoFields 改为照片附件前的照片字段及对应的照片类型，用于迁移旧数据和兼容旧的字段配置、审核规则
+// 原行驶证照片迁移为行驶证主页
+var LegacyPhotoFields = map[string]string{
+	"vehicle_photo":             AttachmentVehicleFront,
+	"driving_license_photo":     AttachmentDrivingLicenseMain,
+	"vehicle_list_photo":        AttachmentVehicleList,
+	"whole_machine_photo":       AttachmentMachineNameplate,
+	"engine_nameplate_photo":    AttachmentEngineNameplate,
+	"environmental_label_photo": AttachmentEnvironmentalLabel,
+	"device_photo":              AttachmentDevice,
+}
+
+// DataMigrationLegacyPhotos 旧版单列照片迁移为照片附件
+const DataMigrationLegacyPhotos = "legacy_photos"
+
+// DataMigration 已完成的一次性数据迁移，启动时据此跳过，避免重复执行
+type DataMigration struct {
+	Name      string    `gorm:"type:varchar(100);primaryKey" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Attachment 照片附件
+type Attachment struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"` // 对象键，见 POST /api/v1/uploads
+}
+
+// Attachments 记录的照片附件，每种类型至多一张，以 JSON 存储
+type Attachments []Attachment
+
+// Get 返回指定类型照片的对象键，没有时返回空字符串
+func (a Attachments) Get(kind string) string {
+	for _, attachment := range a {
+		if attachment.Kind == kind {
+			return attachment.Key
+		}
+	}
+	return ""
+}
+
+func (a Attachments) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (a *Attachments) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported attachments value %T", src)
+	}
+	return json.Unmarshal(data, a)
+}
+
+// 字段来源
+const (
+	FieldSourceOCR    = "ocr"    // 采用识别结果
+	FieldSourceEdited = "edited" // 识别后由车主修改
+	FieldSourceManual = "manual" // 未识别，由车主填写
+)
+
+// OCRRecognition 证照识别记录，车主提交车辆时据此判断字段来源
+type OCRRecognition struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ParkID    uint            `gorm:"index" json:"park_id"` // 识别时未指定车场为 0
+	Kind      string          `gorm:"type:varchar(30);not null" json:"kind"`
+	Provider  string          `gorm:"type:varchar(30)" json:"provider"`
+	Fields    json.RawMessage `gorm:"type:json" json:"fields"` // map[字段]规范化后的识别值
+	VehicleID *uint           `gorm:"index" json:"vehicle_id"` // 提交车辆后关联，每条识别记录只能使用一次
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// 导入任务状态
+// 已上传(uploaded) 和 已校验(validated) 的任务可确认列映射后校验或导入，执行失败(failed) 的任务可重新执行，导入完成(completed) 后不能再执行
+const (
+	ImportStatusUploaded  = "uploaded"
+	ImportStatusRunning   = "running"
+	ImportStatusValidated = "validated"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// ImportJob 台账批量导入任务，上传的表格和错误报告保存在对象存储
+type ImportJob struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ParkID    uint            `gorm:"not null;index" json:"park_id"`
+	DataType  string          `gorm:"type:varchar(30);not null" json:"data_type"` // external-vehicle, internal-vehicle, non-road
+	FileName  string          `gorm:"type:varchar(200)" json:"file_name"`
+	SourceKey string          `gorm:"type:varchar(512)" json:"-"`
+	Headers   json.RawMessage `gorm:"type:json" json:"headers"` // []string 表头
+	Mapping   json.RawMessage `gorm:"type:json" json:"mapping"` // map[字段]表头，上传后为按表头推荐的映射
+
+	Status     string     `gorm:"type:varchar(20);index" json:"status"`
+	DryRun     bool       `json:"dry_run"`   // 最近一次执行是否只校验不导入
+	Total      int        `json:"total"`     // 数据行数，不含表头和空行
+	Processed  int        `json:"processed"` // 已处理的行数，用于显示进度
+	Succeeded  int        `json:"succeeded"` // 导入（校验通过）的行数
+	Failed     int        `json:"failed"`
+	ReportKey  string     `gorm:"type:varchar(512)" json:"-"`
+	HasReport  bool       `gorm:"-" json:"has_report"` // 是否有错误报告可下载
+	Error      string     `gorm:"type:varchar(500)" json:"error"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
 // InternalVehicle 厂内运输车辆
 type InternalVehicle struct {
 	ID     uint `gorm:"primaryKey" json:"id"`
@@ -153,13 +555,13 @@ type InternalVehicle struct {
 	Address   string `gorm:"type:varchar(200)" json:"address"`
 	IssueDate string `gorm:"type:varchar(20)" json:"issue_date"`
 
-	// 照片
-	VehicleListPhoto    string `gorm:"type:varchar(500)" json:"vehicle_list_photo"`
-	DrivingLicensePhoto string `gorm:"type:varchar(500)" json:"driving_license_photo"`
-	VehiclePhoto        string `gorm:"type:varchar(500)" json:"vehicle_photo"`
+	// 照片：行驶证主页、副页、车头照片、随车清单
+	Attachments Attachments `gorm:"type:json" json:"attachments"`
+	// 照片的限时下载地址，同 ExternalVehicle.PhotoURLs
+	PhotoURLs map[string]string `gorm:"-" json:"photo_urls,omitempty"`
 
 	// 联网与下发
-	NetworkStatus  string     `gorm:"type:varchar(20)" json:"network_status"`
+	NetworkStatus  string     `gorm:"type:varchar(20)" json:"network_status"` // online, pending, failed，由下发确认结果得出
 	DispatchStatus string     `gorm:"type:varchar(20);default:'undispatched'" json:"dispatch_status"`
 	DispatchTime   *time.Time `json:"dispatch_time"`
 
@@ -198,11 +600,10 @@ type NonRoadMachinery struct {
 	LocalEnvironmentalCode  string `gorm:"type:varchar(50)" json:"local_environmental_code"`
 	EntryDate               string `gorm:"type:varchar(20)" json:"entry_date"`
 
-	// 照片
-	WholeMachinePhoto       string `gorm:"type:varchar(500)" json:"whole_machine_photo"`       // 整车(机)铭牌
-	EngineNameplatePhoto    string `gorm:"type:varchar(500)" json:"engine_nameplate_photo"`    // 发动机铭牌
-	EnvironmentalLabelPhoto string `gorm:"type:varchar(500)" json:"environmental_label_photo"` // 机械环保信息标
-	DevicePhoto             string `gorm:"type:varchar(500)" json:"device_photo"`              // 设备照片
+	// 照片：整车（机）铭牌、发动机铭牌、机械环保信息标、设备照片
+	Attachments Attachments `gorm:"type:json" json:"attachments"`
+	// 照片的限时下载地址，同 ExternalVehicle.PhotoURLs
+	PhotoURLs map[string]string `gorm:"-" json:"photo_urls,omitempty"`
 
 	// 下发
 	DispatchStatus string     `gorm:"type:varchar(20);default:'undispatched'" json:"dispatch_status"`
@@ -263,22 +664,298 @@ type Department struct {
 type PluginAuth struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	ParkID    uint      `gorm:"not null;index" json:"park_id"`
-	Token     string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"-"` // 令牌的 SHA-256 摘要，明文仅在签发时返回
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	// 验证时协商的协议版本和载荷加密方式，刷新令牌时沿用
+	ProtocolVersion int       `gorm:"default:1" json:"protocol_version"`
+	Encryption      string    `gorm:"type:varchar(20);default:'none'" json:"encryption"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// PluginNonce 插件请求使用过的随机数，有效期内重复出现即为重放请求
+type PluginNonce struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ParkID    uint      `gorm:"not null;uniqueIndex:idx_park_nonce" json:"park_id"`
+	Nonce     string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_park_nonce" json:"nonce"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// SignedRequest 插件请求的签名信息
+type SignedRequest struct {
+	ParkID    uint
+	Method    string
+	Path      string // 路径（含查询参数）
+	Timestamp int64
+	Nonce     string
+	BodyHash  string // 请求体 SHA-256 十六进制摘要
+	Signature string
+}
+
+// PluginSession 插件验证或刷新后签发的会话令牌
+type PluginSession struct {
+	Token           string         `json:"token"`
+	TokenType       string         `json:"token_type"` // 固定为 Bearer
+	ExpiresAt       time.Time      `json:"expires_at"`
+	ProtocolVersion int            `json:"protocol_version"`
+	Encryption      string         `json:"encryption"` // none, aes-256-gcm
+	Park            PluginParkInfo `json:"park"`
+}
+
+// PluginParkInfo 返回给插件的车场信息，不包含密钥和登录凭据
+type PluginParkInfo struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Code      string    `json:"code"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// PluginStatus 车场插件最近一次心跳上报的信息，每个车场一条
+type PluginStatus struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ParkID        uint       `gorm:"not null;uniqueIndex" json:"park_id"`
+	PluginVersion string     `gorm:"type:varchar(50)" json:"plugin_version"`
+	HostName      string     `gorm:"type:varchar(100)" json:"host_name"`
+	OS            string     `gorm:"type:varchar(100)" json:"os"`
+	ClientIP      string     `gorm:"type:varchar(50)" json:"client_ip"`
+	LocalCounts   string     `gorm:"type:text" json:"-"`        // 插件本地各类台账记录数（JSON）
+	LastSeenAt    time.Time  `gorm:"index" json:"last_seen_at"` // 最近一次心跳时间
+	OnlineSince   *time.Time `json:"online_since"`              // 本次连续在线的开始时间
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// PluginHeartbeat 插件心跳上报内容
+type PluginHeartbeat struct {
+	PluginVersion string           `json:"plugin_version"`
+	HostName      string           `json:"host_name"`
+	OS            string           `json:"os"`
+	LocalCounts   map[string]int64 `json:"local_counts"` // 按 data_type 统计的本地记录数
+}
+
+// PluginHeartbeatResult 心跳响应，附带服务端记录数供插件核对
+type PluginHeartbeatResult struct {
+	ServerTime      time.Time        `json:"server_time"`
+	NextHeartbeat   int              `json:"next_heartbeat"` // 建议的下次心跳间隔（秒）
+	ServerCounts    map[string]int64 `json:"server_counts"`
+	PendingDispatch int64            `json:"pending_dispatch"` // 待投递的下发项数
+}
+
+// PluginStatusView 管理端展示的车场插件状态
+type PluginStatusView struct {
+	ParkID        uint             `json:"park_id"`
+	ParkName      string           `json:"park_name"`
+	ParkCode      string           `json:"park_code"`
+	Online        bool             `json:"online"`
+	PluginVersion string           `json:"plugin_version"`
+	HostName      string           `json:"host_name"`
+	OS            string           `json:"os"`
+	ClientIP      string           `json:"client_ip"`
+	LocalCounts   map[string]int64 `json:"local_counts"`
+	LastSeenAt    *time.Time       `json:"last_seen_at"` // 心跳与实时连接中最近的一次活动，从未连接时为空
+	OnlineSince   *time.Time       `json:"online_since"`
+	SilentSeconds int64            `json:"silent_seconds"` // 距最近一次活动的秒数，从未连接时为 -1
+	Transport     string           `json:"transport"`      // 实时连接方式：websocket、long-poll
+	Connections   int              `json:"connections"`    // 当前 WebSocket 连接数
+}
+
+// 台账记录下发状态，插件确认接收后变为已下发
+const (
+	DispatchStatusDispatched   = "dispatched"
+	DispatchStatusUndispatched = "undispatched"
+)
+
+// 台账记录联网状态，由下发确认结果得出
+const (
+	NetworkOnline  = "online"  // 最近一次下发已被插件确认接收
+	NetworkPending = "pending" // 已下发，等待插件确认
+	NetworkFailed  = "failed"  // 下发多次未确认，已转入死信
+)
+
+// 同步变更操作
+const (
+	SyncOpUpsert = "upsert" // 新增或修改
+	SyncOpDelete = "delete" // 删除
+)
+
+// SyncChange 台账变更日志，PC端插件按 Seq 游标增量拉取
+// DataType 取值与二维码类型一致：external-vehicle, internal-vehicle, non-road
+type SyncChange struct {
+	Seq       uint64    `gorm:"primaryKey;autoIncrement;index:idx_park_seq,priority:2" json:"seq"`
+	ParkID    uint      `gorm:"not null;index:idx_park_seq,priority:1" json:"park_id"`
+	DataType  string    `gorm:"type:varchar(20);not null" json:"data_type"`
+	RecordID  uint      `gorm:"not null" json:"record_id"`
+	Op        string    `gorm:"type:varchar(10);not null" json:"op"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PC端插件协议版本：1 为明文 JSON，2 起支持验证时协商载荷加密
+const (
+	SyncProtocolVersion    = 2 // 当前版本
+	SyncMinProtocolVersion = 1 // 仍兼容的最低版本
+)
+
+// 插件上传的变更操作
+const (
+	SyncPushCreate = "create"
+	SyncPushUpdate = "update"
+	SyncPushDelete = "delete"
+)
+
+// 上传变更的处理结果
+const (
+	SyncStatusAccepted = "accepted" // 已接受
+	SyncStatusConflict = "conflict" // 版本冲突，服务端记录已被修改
+	SyncStatusRejected = "rejected" // 数据不合法或记录不存在
+)
+
+// SyncRecordChange 拉取结果中的单条变更
+type SyncRecordChange struct {
+	Seq      uint64      `json:"seq"`
+	DataType string      `json:"data_type"`
+	Op       string      `json:"op"` // upsert, delete
+	RecordID uint        `json:"record_id"`
+	Version  int         `json:"version"`
+	Data     interface{} `json:"data,omitempty"` // 记录当前完整数据，删除时为空
+}
+
+// SyncPullResult 增量拉取结果
+type SyncPullResult struct {
+	ProtocolVersion int                `json:"protocol_version"`
+	Cursor          uint64             `json:"cursor"`   // 下次拉取时携带的游标
+	HasMore         bool               `json:"has_more"` // 是否还有未拉取的变更
+	Changes         []SyncRecordChange `json:"changes"`
+}
+
+// SyncPushChange 插件上传的单条本地变更
+type SyncPushChange struct {
+	ClientRef   string          `json:"client_ref"` // 插件本地标识，原样返回用于对应处理结果
+	DataType    string          `json:"data_type"`
+	Op          string          `json:"op"`           // create, update, delete
+	RecordID    uint            `json:"record_id"`    // update、delete 时必填
+	BaseVersion int             `json:"base_version"` // update、delete 时为插件最后同步到的版本
+	Data        json.RawMessage `json:"data"`         // create、update 时为完整记录
+}
+
+// SyncPushResult 单条上传变更的处理结果
+type SyncPushResult struct {
+	ClientRef string      `json:"client_ref"`
+	DataType  string      `json:"data_type"`
+	RecordID  uint        `json:"record_id"`
+	Status    string      `json:"status"`
+	Version   int         `json:"version"`          // 处理后的服务端版本
+	Error     string      `json:"error,omitempty"`  // 拒绝或冲突的原因
+	Fields    interface{} `json:"fields,omitempty"` // 字段校验错误明细
+	Server    interface{} `json:"server,omitempty"` // 冲突时服务端的当前记录
+}
+
+// 下发队列状态
+const (
+	DispatchPending   = "pending"   // 待投递或等待重试
+	DispatchDelivered = "delivered" // 插件已确认接收
+	DispatchDead      = "dead"      // 超过最大投递次数或记录已删除，需人工处理
+)
+
+// DispatchItem 下发队列（发件箱），记录待投递到车场PC端的台账记录及版本
+// 同一记录未投递成功前再次下发只更新版本，不重复入队
+type DispatchItem struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ParkID        uint       `gorm:"not null;index:idx_dispatch_park_status,priority:1" json:"park_id"`
+	DataType      string     `gorm:"type:varchar(20);not null" json:"data_type"`
+	RecordID      uint       `gorm:"not null;index" json:"record_id"`
+	Version       int        `json:"version"` // 投递的记录版本
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index:idx_dispatch_park_status,priority:2" json:"status"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`                                        // 已投递次数
+	NextAttemptAt time.Time  `gorm:"index:idx_dispatch_park_status,priority:3" json:"next_attempt_at"` // 下次可投递时间，投递后未确认则到期重投
+	LastError     string     `gorm:"type:varchar(500)" json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// DispatchDelivery 投递给插件的下发项
+type DispatchDelivery struct {
+	ID       uint        `json:"id"` // 确认接收时回传
+	DataType string      `json:"data_type"`
+	RecordID uint        `json:"record_id"`
+	Version  int         `json:"version"`
+	Attempt  int         `json:"attempt"` // 第几次投递
+	Data     interface{} `json:"data"`    // 记录当前完整数据
+}
+
+// DispatchAck 插件对下发项的确认
+type DispatchAck struct {
+	ID      uint   `json:"id"`
+	Version int    `json:"version"` // 收到的记录版本，与下发项当前版本不一致时忽略
+	Success bool   `json:"success"`
+	Error   string `json:"error"` // 失败原因，失败的下发项将稍后重投
+}
+
+// DispatchAckResult 确认处理结果
+type DispatchAckResult struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"`          // 下发项处理后的状态：pending、delivered、dead
+	Error  string `json:"error,omitempty"` // 下发项不存在或版本已变化时的说明
+}
+
+// LedgerMeta 台账记录的公共字段
+type LedgerMeta struct {
+	ID        uint
+	ParkID    uint
+	Version   int
+	CreatedAt time.Time
+}
+
+// Ledger 参与PC端插件同步的台账记录
+type Ledger interface {
+	GetLedgerMeta() LedgerMeta
+	SetLedgerMeta(meta LedgerMeta)
+}
+
+func (v *ExternalVehicle) GetLedgerMeta() LedgerMeta {
+	return LedgerMeta{ID: v.ID, ParkID: v.ParkID, Version: v.Version, CreatedAt: v.CreatedAt}
+}
+
+func (v *ExternalVehicle) SetLedgerMeta(meta LedgerMeta) {
+	v.ID, v.ParkID, v.Version, v.CreatedAt = meta.ID, meta.ParkID, meta.Version, meta.CreatedAt
+}
+
+func (v *InternalVehicle) GetLedgerMeta() LedgerMeta {
+	return LedgerMeta{ID: v.ID, ParkID: v.ParkID, Version: v.Version, CreatedAt: v.CreatedAt}
+}
+
+func (v *InternalVehicle) SetLedgerMeta(meta LedgerMeta) {
+	v.ID, v.ParkID, v.Version, v.CreatedAt = meta.ID, meta.ParkID, meta.Version, meta.CreatedAt
+}
+
+func (m *NonRoadMachinery) GetLedgerMeta() LedgerMeta {
+	return LedgerMeta{ID: m.ID, ParkID: m.ParkID, Version: m.Version, CreatedAt: m.CreatedAt}
+}
+
+func (m *NonRoadMachinery) SetLedgerMeta(meta LedgerMeta) {
+	m.ID, m.ParkID, m.Version, m.CreatedAt = meta.ID, meta.ParkID, meta.Version, meta.CreatedAt
+}
+
 // ScanResult 扫码结果
 type ScanResult struct {
 	ParkID         uint      `json:"park_id"`
 	ParkName       string    `json:"park_name"`
+	QRCodeType     string    `json:"qrcode_type"` // external-vehicle, internal-vehicle, non-road，用于跳转对应登记表单
 	CompanyEnabled bool      `json:"company_enabled"`
 	Companies      []Company `json:"companies"`
+	Warning        string    `json:"warning,omitempty"` // 扫描宽限期内的旧二维码时提示
+
+	// 小程序上传照片时携带的令牌，与二维码绑定，二维码更换或停用后失效
+	UploadToken          string    `json:"upload_token"`
+	UploadTokenExpiresAt time.Time `json:"upload_token_expires_at"`
 }
 
 // ThirdPartyVehicleData 第三方随车清单数据
 type ThirdPartyVehicleData struct {
-	OSSURL             string `json:"oss_url"`
+	OSSURL             string `json:"oss_url"`            // 第三方签名地址，约15分钟后过期
+	VehicleListPhoto   string `json:"vehicle_list_photo"` // 随车清单图片转存后的对象键，下载失败时为空
+	VehicleListURL     string `json:"vehicle_list_url"`   // 随车清单图片的限时下载地址
 	EmissionStandard   string `json:"emission_standard"`
 	VIN                string `json:"vin"`
 	EngineManufacturer string `json:"engine_manufacturer"`
@@ -286,3 +963,50 @@ type ThirdPartyVehicleData struct {
 	PlateColor         string `json:"plate_color"`
 	FuelType           string `json:"fuel_type"`
 }
+
+// UploadedFile 上传结果，照片字段保存 key，展示时使用限时下载地址 url
+type UploadedFile struct {
+	Key          string    `json:"key"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"` // 缩略图的限时下载地址，没有缩略图时同 url
+	ExpiresAt    time.Time `json:"expires_at"`
+	ContentType  string    `json:"content_type"` // 处理后的类型，较大的 PNG 照片会转为 JPEG
+	Size         int64     `json:"size"`
+}
+
+// SignedURL 文件的限时下载地址，文件不属于请求的车场时 error 非空
+type SignedURL struct {
+	Key       string     `json:"key"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// OCRResult 证照识别结果，vehicle 中只填写识别出的字段
+type OCRResult struct {
+	RecognitionID uint              `json:"recognition_id"` // 提交车辆时放入 ocr_recognition_ids
+	Kind          string            `json:"kind"`
+	Vehicle       *ExternalVehicle  `json:"vehicle"`
+	Fields        []string          `json:"fields"`   // 识别出的字段
+	Warnings      map[string]string `json:"warnings"` // 识别值未通过校验的字段及原因，需车主核对
+}
+
+// ImportField 导入时可映射的字段
+type ImportField struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// ImportPreview 上传表格后返回的任务、可映射的字段和前几行数据，供确认列映射
+type ImportPreview struct {
+	Job    *ImportJob    `json:"job"`
+	Fields []ImportField `json:"fields"`
+	Rows   [][]string    `json:"rows"`
+}
+
+// ImportRunRequest 执行导入任务：mapping 为字段到表头的映射，未提交时使用任务保存的映射；dry_run 时只校验不导入
+type ImportRunRequest struct {
+	Mapping map[string]string `json:"mapping"`
+	DryRun  bool              `json:"dry_run"`
+}
@@ -0,0 +1,115 @@
+package payload
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 载荷加密方式
+const (
+	EncryptionNone      = "none"
+	EncryptionAES256GCM = "aes-256-gcm"
+)
+
+// EncryptedVersion 支持载荷加密的最低协议版本
+const EncryptedVersion = 2
+
+// hkdfSalt 密钥派生盐值，变更会导致已部署插件无法解密
+const hkdfSalt = "taizhang-plugin-payload"
+
+// Envelope 加密载荷信封，替代明文 JSON 作为请求体或响应体
+type Envelope struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Encryption      string `json:"encryption"`
+	Nonce           string `json:"nonce"`      // Base64 编码的 12 字节随机数
+	Ciphertext      string `json:"ciphertext"` // Base64 编码的密文（含认证标签）
+}
+
+// SupportedEncryption 是否为支持的加密方式
+func SupportedEncryption(encryption string) bool {
+	return encryption == EncryptionNone || encryption == EncryptionAES256GCM
+}
+
+// DeriveKey 由车场密钥经 HKDF-SHA256 派生 32 字节的载荷加密密钥
+func DeriveKey(secretKey string) []byte {
+	return hkdfSHA256([]byte(secretKey), []byte(hkdfSalt), []byte(EncryptionAES256GCM), 32)
+}
+
+// hkdfSHA256 按 RFC 5869 派生 length 字节的密钥
+func hkdfSHA256(secret, salt, info []byte, length int) []byte {
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		// 输出长度不超过 255 个摘要块时不会出错
+		panic(err)
+	}
+	return key
+}
+
+// Seal 加密明文，附加数据绑定车场ID，防止密文被挪用到其他车场
+func Seal(key []byte, parkID uint, plaintext []byte) (*Envelope, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := aead.Seal(nil, nonce, plaintext, additionalData(parkID))
+	return &Envelope{
+		ProtocolVersion: EncryptedVersion,
+		Encryption:      EncryptionAES256GCM,
+		Nonce:           base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:      base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Open 解密信封，返回明文
+func Open(key []byte, parkID uint, env *Envelope) ([]byte, error) {
+	if env.Encryption != EncryptionAES256GCM {
+		return nil, fmt.Errorf("unsupported encryption: %s", env.Encryption)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(parkID))
+	if err != nil {
+		return nil, errors.New("payload decryption failed")
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData 认证附加数据：协议标识与车场ID
+func additionalData(parkID uint) []byte {
+	return []byte(fmt.Sprintf("taizhang-plugin-v%d|%d", EncryptedVersion, parkID))
+}
@@ -0,0 +1,144 @@
+package plate
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 车牌颜色
+const (
+	ColorBlue            = "蓝牌"
+	ColorYellow          = "黄牌"
+	ColorWhite           = "白牌"
+	ColorBlack           = "黑牌"
+	ColorNewEnergyGreen  = "新能源绿牌"
+	ColorNewEnergyYellow = "新能源绿黄牌"
+)
+
+const (
+	standardLength  = 7 // 普通号牌字符数
+	newEnergyLength = 8 // 新能源号牌字符数
+)
+
+// provinces 省级行政区简称
+var provinces = map[rune]bool{
+	'京': true, '津': true, '沪': true, '渝': true, '冀': true, '豫': true,
+	'云': true, '辽': true, '黑': true, '湘': true, '皖': true, '鲁': true,
+	'新': true, '苏': true, '浙': true, '赣': true, '鄂': true, '桂': true,
+	'甘': true, '晋': true, '蒙': true, '陕': true, '吉': true, '闽': true,
+	'贵': true, '粤': true, '青': true, '藏': true, '川': true, '宁': true,
+	'琼': true,
+}
+
+// suffixColors 特殊号牌末位汉字及对应的号牌颜色
+var suffixColors = map[rune]string{
+	'挂': ColorYellow, // 挂车
+	'学': ColorYellow, // 教练车
+	'警': ColorWhite,  // 警车
+	'领': ColorBlack,  // 领馆
+	'港': ColorBlack,  // 粤港入出境
+	'澳': ColorBlack,  // 粤澳入出境
+}
+
+// Plate 解析后的车牌
+type Plate struct {
+	Number    string `json:"number"`     // 规范化后的完整车牌
+	Province  string `json:"province"`   // 省份简称，如"苏"
+	Authority string `json:"authority"`  // 发牌机关代号，如"F"
+	Serial    string `json:"serial"`     // 序号（不含特殊后缀）
+	Suffix    string `json:"suffix"`     // 特殊后缀：挂、学、警、领、港、澳
+	NewEnergy bool   `json:"new_energy"` // 是否新能源号牌
+}
+
+// Normalize 去除空白并将字母转为大写
+func Normalize(number string) string {
+	number = strings.Join(strings.Fields(number), "")
+	return strings.ToUpper(number)
+}
+
+// Parse 按字符（而非字节）解析车牌号码
+func Parse(number string) (*Plate, error) {
+	number = Normalize(number)
+	runes := []rune(number)
+
+	if len(runes) != standardLength && len(runes) != newEnergyLength {
+		return nil, fmt.Errorf("车牌号码位数不正确")
+	}
+	if !provinces[runes[0]] {
+		return nil, fmt.Errorf("车牌号码格式不正确，第一位必须是省份简称")
+	}
+	if !isLetter(runes[1]) {
+		return nil, fmt.Errorf("车牌号码格式不正确，第二位必须是A-Z的字母")
+	}
+
+	serial := runes[2:]
+	p := &Plate{
+		Number:    number,
+		Province:  string(runes[0]),
+		Authority: string(runes[1]),
+	}
+
+	last := serial[len(serial)-1]
+	if _, ok := suffixColors[last]; ok {
+		if len(runes) != standardLength {
+			return nil, fmt.Errorf("车牌号码格式不正确，特殊号牌应为7位")
+		}
+		p.Suffix = string(last)
+		serial = serial[:len(serial)-1]
+	}
+
+	for _, r := range serial {
+		if !isLetter(r) && !isDigit(r) {
+			return nil, fmt.Errorf("车牌号码格式不正确，序号只能是字母或数字")
+		}
+	}
+
+	p.Serial = string(serial)
+	p.NewEnergy = len(runes) == newEnergyLength
+	return p, nil
+}
+
+// Validate 校验车牌号码
+func Validate(number string) error {
+	_, err := Parse(number)
+	return err
+}
+
+// Color 根据车牌号码位数和车辆类型推断号牌颜色
+func (p *Plate) Color(vehicleType string) string {
+	if p.Suffix != "" {
+		return suffixColors[[]rune(p.Suffix)[0]]
+	}
+
+	if p.NewEnergy {
+		last, _ := utf8.DecodeLastRuneInString(p.Serial)
+		// 8位且第8位字符=A-Z，则车牌颜色=新能源绿黄牌
+		if isLetter(last) {
+			return ColorNewEnergyYellow
+		}
+		// 8位且第8位字符=0-9，则车牌颜色=新能源绿牌
+		return ColorNewEnergyGreen
+	}
+
+	// 7位且车辆类型包含：重型、中型，车牌颜色=黄牌
+	if strings.Contains(vehicleType, "重型") || strings.Contains(vehicleType, "中型") {
+		return ColorYellow
+	}
+
+	// 7位且车辆类型包含：轻型，或其他情况，车牌颜色=蓝牌
+	return ColorBlue
+}
+
+// String 返回规范化后的车牌号码
+func (p *Plate) String() string {
+	return p.Number
+}
+
+func isLetter(r rune) bool {
+	return r >= 'A' && r <= 'Z'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,100 @@
+package plate
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		number string
+		want   Plate
+	}{
+		{"京A12345", Plate{Number: "京A12345", Province: "京", Authority: "A", Serial: "12345"}},
+		{" 苏f a12 34 ", Plate{Number: "苏FA1234", Province: "苏", Authority: "F", Serial: "A1234"}},
+		{"琼EAB123", Plate{Number: "琼EAB123", Province: "琼", Authority: "E", Serial: "AB123"}},
+		{"粤BD12345", Plate{Number: "粤BD12345", Province: "粤", Authority: "B", Serial: "D12345", NewEnergy: true}},
+		{"沪A12345F", Plate{Number: "沪A12345F", Province: "沪", Authority: "A", Serial: "12345F", NewEnergy: true}},
+		{"鲁A1234挂", Plate{Number: "鲁A1234挂", Province: "鲁", Authority: "A", Serial: "1234", Suffix: "挂"}},
+		{"浙B1234学", Plate{Number: "浙B1234学", Province: "浙", Authority: "B", Serial: "1234", Suffix: "学"}},
+		{"川A1234警", Plate{Number: "川A1234警", Province: "川", Authority: "A", Serial: "1234", Suffix: "警"}},
+		{"沪A1234领", Plate{Number: "沪A1234领", Province: "沪", Authority: "A", Serial: "1234", Suffix: "领"}},
+		{"粤Z1234港", Plate{Number: "粤Z1234港", Province: "粤", Authority: "Z", Serial: "1234", Suffix: "港"}},
+		{"粤Z1234澳", Plate{Number: "粤Z1234澳", Province: "粤", Authority: "Z", Serial: "1234", Suffix: "澳"}},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.number)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.number, err)
+			continue
+		}
+		if *p != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.number, *p, tt.want)
+		}
+	}
+}
+
+func TestParseProvinces(t *testing.T) {
+	for _, province := range "京津沪渝冀豫云辽黑湘皖鲁新苏浙赣鄂桂甘晋蒙陕吉闽贵粤青藏川宁琼" {
+		number := string(province) + "A12345"
+		if err := Validate(number); err != nil {
+			t.Errorf("Validate(%q): %v", number, err)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+	}{
+		{"empty", ""},
+		{"too short", "京A1234"},
+		{"too long", "京A1234567"},
+		{"not a province", "港A12345"},
+		{"latin first", "AA12345"},
+		{"digit authority", "京112345"},
+		{"chinese in serial", "京A12京45"},
+		{"symbol in serial", "京A12-45"},
+		{"suffix on 8 characters", "京A12345挂"},
+		{"unknown suffix", "京A1234使"},
+	}
+	for _, tt := range tests {
+		if p, err := Parse(tt.number); err == nil {
+			t.Errorf("%s: Parse(%q) = %+v, want error", tt.name, tt.number, *p)
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	tests := []struct {
+		number      string
+		vehicleType string
+		want        string
+	}{
+		// 7位按车辆类型区分
+		{"京A12345", "重型半挂牵引车", ColorYellow},
+		{"京A12345", "中型普通货车", ColorYellow},
+		{"京A12345", "轻型厢式货车", ColorBlue},
+		{"京A12345", "小型普通客车", ColorBlue},
+		{"京A12345", "", ColorBlue},
+		// 8位按末位字符区分，与车辆类型无关
+		{"粤BD12345", "重型半挂牵引车", ColorNewEnergyGreen},
+		{"粤B12345D", "小型普通客车", ColorNewEnergyYellow},
+		{"粤B12345F", "重型半挂牵引车", ColorNewEnergyYellow},
+		// 特殊号牌按后缀区分，与车辆类型无关
+		{"鲁A1234挂", "重型半挂车", ColorYellow},
+		{"浙B1234学", "小型普通客车", ColorYellow},
+		{"川A1234警", "重型普通货车", ColorWhite},
+		{"沪A1234领", "小型普通客车", ColorBlack},
+		{"粤Z1234港", "中型普通货车", ColorBlack},
+		{"粤Z1234澳", "小型普通客车", ColorBlack},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.number)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.number, err)
+			continue
+		}
+		if got := p.Color(tt.vehicleType); got != tt.want {
+			t.Errorf("Parse(%q).Color(%q) = %s, want %s", tt.number, tt.vehicleType, got, tt.want)
+		}
+	}
+}
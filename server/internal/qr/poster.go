@@ -0,0 +1,110 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Poster 可打印的二维码海报文字内容
+type Poster struct {
+	Title    string // 二维码上方的主标题，如车场名称
+	Subtitle string // 副标题，如"厂外运输车辆登记"
+	Footer   string // 底部说明，如二维码创建时间
+}
+
+// A4 纸张尺寸（单位：pt）
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	pageMargin = 40.0
+)
+
+// PosterPDF 生成 A4 尺寸的 PDF 海报：标题、副标题、二维码、底部说明自上而下居中排列
+// 中文使用阅读器内置的 STSong-Light 字体，无需嵌入字体文件
+func (c *Code) PosterPDF(p Poster) []byte {
+	var content bytes.Buffer
+
+	writeCenteredText(&content, p.Title, 30, 740)
+	writeCenteredText(&content, p.Subtitle, 22, 690)
+
+	// 二维码（含空白区）
+	const qrWidth = 380.0
+	total := c.Size + QuietZone*2
+	module := qrWidth / float64(total)
+	left := (pageWidth - qrWidth) / 2
+	top := 650.0
+	content.WriteString("0 0 0 rg\n")
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n",
+				left+float64(x+QuietZone)*module,
+				top-float64(y+QuietZone+1)*module,
+				module, module)
+		}
+	}
+	content.WriteString("f\n")
+
+	writeCenteredText(&content, p.Footer, 14, top-qrWidth-40)
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [6 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 7 0 R /DW 1000 /W [1 95 500] >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// writeCenteredText 在给定基线高度水平居中输出文字，过长时缩小字号以适应页面宽度
+func writeCenteredText(w *bytes.Buffer, text string, fontSize, baseline float64) {
+	if text == "" {
+		return
+	}
+
+	em := textWidthEm(text)
+	if maxWidth := pageWidth - pageMargin*2; em*fontSize > maxWidth {
+		fontSize = maxWidth / em
+	}
+	x := (pageWidth - em*fontSize) / 2
+
+	fmt.Fprintf(w, "BT /F1 %.2f Tf %.2f %.2f Td <", fontSize, x, baseline)
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(w, "%04X", unit)
+	}
+	w.WriteString("> Tj ET\n")
+}
+
+// textWidthEm 估算文字宽度（单位：em），ASCII 字符为半角，其余为全角
+func textWidthEm(text string) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r < 0x80 {
+			width += 0.5
+		} else {
+			width += 1
+		}
+	}
+	return width
+}
@@ -0,0 +1,132 @@
+package qr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	scanURL     = "https://taizhang.example.com/scan?qrcode="
+	shortURL    = "https://example.com/q/abc"
+	nonRoadURL  = scanURL + "non-road-qwertyuiopasdfghjk"
+	externalURL = scanURL + "external-vehicle-abcdefghij"
+)
+
+var internalURL = scanURL + strings.Repeat("internal-vehicle-", 9) + "end"
+
+// testdata 中的模块矩阵由独立实现 github.com/skip2/go-qrcode 生成（不含静区），# 为深色模块
+// 用例覆盖四种纠错等级、单块与多块交织、版本信息（版本 7 起）和 16 位字符计数（版本 10 起）
+var encodeTests = []struct {
+	name    string
+	data    string
+	level   Level
+	mask    int // -1 表示自动选择掩码
+	version int
+}{
+	{"v1-L-mask0", "hello", LevelL, 0, 1},
+	{"v1-H-mask5", "hello", LevelH, 5, 1},
+	{"v2-M-mask3", shortURL, LevelM, 3, 2},
+	{"v6-Q-mask6", externalURL, LevelQ, 6, 6},
+	{"v8-H-mask1", nonRoadURL, LevelH, 1, 8},
+	{"v10-M-mask7", internalURL, LevelM, 7, 10},
+	{"v1-L-auto", "hello", LevelL, -1, 1},
+	{"v2-M-auto", shortURL, LevelM, -1, 2},
+	{"v8-H-auto", nonRoadURL, LevelH, -1, 8},
+	{"v10-M-auto", internalURL, LevelM, -1, 10},
+}
+
+func TestEncodeMatrix(t *testing.T) {
+	for _, tt := range encodeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := os.ReadFile(filepath.Join("testdata", tt.name+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var c *Code
+			if tt.mask < 0 {
+				c, err = Encode([]byte(tt.data), tt.level)
+			} else {
+				c, err = encode([]byte(tt.data), tt.level, tt.mask)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version != tt.version || c.Size != tt.version*4+17 {
+				t.Fatalf("version = %d, size = %d, want version %d", c.Version, c.Size, tt.version)
+			}
+
+			got := matrix(c)
+			if got == string(want) {
+				return
+			}
+			gotRows, wantRows := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+			for y := range wantRows {
+				if y >= len(gotRows) || gotRows[y] != wantRows[y] {
+					t.Fatalf("row %d:\n got %s\nwant %s", y, gotRows[y], wantRows[y])
+				}
+			}
+			t.Fatalf("matrix mismatch:\n%s", got)
+		})
+	}
+}
+
+func TestEncodeVersionBoundary(t *testing.T) {
+	tests := []struct {
+		size    int
+		level   Level
+		version int
+	}{
+		{17, LevelL, 1},
+		{18, LevelL, 2},
+		{7, LevelH, 1},
+		{8, LevelH, 2},
+		{2953, LevelL, 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode([]byte(strings.Repeat("a", tt.size)), tt.level)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tt.size, err)
+		}
+		if c.Version != tt.version {
+			t.Errorf("%d bytes at level %d: version = %d, want %d", tt.size, tt.level, c.Version, tt.version)
+		}
+	}
+
+	if _, err := Encode([]byte(strings.Repeat("a", 2954)), LevelL); err == nil {
+		t.Error("2954 bytes at level L: want error")
+	}
+}
+
+func TestDarkOutOfRange(t *testing.T) {
+	c, err := Encode([]byte("hello"), LevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 左上角定位图案的外框为深色，矩阵外为浅色
+	if !c.Dark(0, 0) || !c.Dark(c.Size-1, 0) || !c.Dark(0, c.Size-1) {
+		t.Error("finder pattern corners should be dark")
+	}
+	for _, p := range [][2]int{{-1, 0}, {0, -1}, {c.Size, 0}, {0, c.Size}} {
+		if c.Dark(p[0], p[1]) {
+			t.Errorf("Dark(%d, %d) = true outside the matrix", p[0], p[1])
+		}
+	}
+}
+
+func matrix(c *Code) string {
+	var sb strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,303 @@
+package realtime
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventReady         = "ready"          // 连接建立，data 含当前游标及是否需要全量补齐
+	EventDispatch      = "dispatch"       // 有新的下发项，插件应立即取出
+	EventRecordDeleted = "record_deleted" // 已下发的台账记录被删除，插件应删除本地数据
+	EventQRCodeRevoked = "qrcode_revoked" // 二维码已更换，旧码作废
+	EventConfigChanged = "config_changed" // 车场信息或字段配置已变更
+	EventTokenRevoked  = "token_revoked"  // 会话令牌已注销或刷新，连接随即关闭
+)
+
+// 连接方式
+const (
+	TransportWebSocket = "websocket"
+	TransportLongPoll  = "long-poll"
+)
+
+// Event 推送给车场插件的事件
+type Event struct {
+	Seq       uint64      `json:"seq"` // 车场内递增的事件序号，服务重启后从头计数
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Presence 车场插件的在线状态
+type Presence struct {
+	ParkID      uint       `json:"park_id"`
+	Online      bool       `json:"online"`
+	Transport   string     `json:"transport"`    // 最近一次使用的连接方式
+	Connections int        `json:"connections"`  // 当前 WebSocket 连接数
+	ConnectedAt *time.Time `json:"connected_at"` // 当前 WebSocket 连接建立时间
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+}
+
+const (
+	bufferSize      = 256              // 每个车场保留的最近事件数，供长轮询和断线重连补发
+	subscriberQueue = 64               // 单个连接待发送事件上限，写满时断开连接由插件重连补发
+	longPollGrace   = 30 * time.Second // 两次长轮询之间的空档在此范围内仍视为在线
+)
+
+// Subscriber 一个 WebSocket 连接的事件订阅
+type Subscriber struct {
+	ParkID    uint
+	ExpiresAt time.Time // 会话令牌过期时间，过期后连接应关闭
+
+	session string
+	events  chan Event
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Events 待发送的事件
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Done 订阅被服务端关闭（令牌注销、发送积压）时关闭
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+type parkState struct {
+	seq         uint64
+	events      []Event
+	subscribers map[*Subscriber]struct{}
+	waiters     []chan struct{}
+	transport   string
+	connectedAt *time.Time
+	lastSeen    time.Time
+}
+
+// since 返回序号大于 after 的缓存事件；after 超出缓存范围（事件已被淘汰或服务已重启）时 reset 为 true，
+// 插件应通过同步拉取和下发取出补齐数据
+func (p *parkState) since(after uint64) (events []Event, reset bool) {
+	if after > p.seq {
+		return append([]Event(nil), p.events...), true
+	}
+	if len(p.events) > 0 && after+1 < p.events[0].Seq {
+		reset = true
+	}
+	for i, ev := range p.events {
+		if ev.Seq > after {
+			return append([]Event(nil), p.events[i:]...), reset
+		}
+	}
+	return nil, reset
+}
+
+// Hub 按车场分发实时事件并记录插件连接状态，状态只保存在本进程内存中
+type Hub struct {
+	mu    sync.Mutex
+	parks map[uint]*parkState
+}
+
+func NewHub() *Hub {
+	return &Hub{parks: make(map[uint]*parkState)}
+}
+
+func (h *Hub) park(parkID uint) *parkState {
+	p, ok := h.parks[parkID]
+	if !ok {
+		p = &parkState{subscribers: make(map[*Subscriber]struct{})}
+		h.parks[parkID] = p
+	}
+	return p
+}
+
+// Publish 向车场发布事件，立即推送给在线连接并唤醒等待中的长轮询
+func (h *Hub) Publish(parkID uint, eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := h.park(parkID)
+	p.seq++
+	ev := Event{Seq: p.seq, Type: eventType, Data: data, CreatedAt: time.Now()}
+	p.events = append(p.events, ev)
+	if len(p.events) > bufferSize {
+		p.events = append(p.events[:0], p.events[len(p.events)-bufferSize:]...)
+	}
+
+	for sub := range p.subscribers {
+		select {
+		case sub.events <- ev:
+		default:
+			// 发送积压说明连接已不可用，断开后插件按游标重连补发
+			delete(p.subscribers, sub)
+			sub.close()
+		}
+	}
+	for _, w := range p.waiters {
+		close(w)
+	}
+	p.waiters = nil
+}
+
+// Subscribe 建立 WebSocket 订阅，返回游标之后的缓存事件及当前游标
+func (h *Hub) Subscribe(parkID uint, session string, expiresAt time.Time, after uint64) (*Subscriber, []Event, uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := h.park(parkID)
+	sub := &Subscriber{
+		ParkID:    parkID,
+		ExpiresAt: expiresAt,
+		session:   session,
+		events:    make(chan Event, subscriberQueue),
+		done:      make(chan struct{}),
+	}
+	now := time.Now()
+	if len(p.subscribers) == 0 {
+		p.connectedAt = &now
+	}
+	p.subscribers[sub] = struct{}{}
+	p.transport = TransportWebSocket
+	p.lastSeen = now
+
+	backlog, reset := p.since(after)
+	return sub, backlog, p.seq, reset
+}
+
+// Unsubscribe 连接断开时取消订阅
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub.close()
+	p := h.park(sub.ParkID)
+	if _, ok := p.subscribers[sub]; !ok {
+		return
+	}
+	delete(p.subscribers, sub)
+	p.lastSeen = time.Now()
+	if len(p.subscribers) == 0 {
+		p.connectedAt = nil
+	}
+}
+
+// Touch 记录车场插件的活动（如 WebSocket 心跳）
+func (h *Hub) Touch(parkID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.park(parkID).lastSeen = time.Now()
+}
+
+// CloseSession 向使用该会话的连接发送事件后关闭，用于令牌注销和刷新
+func (h *Hub) CloseSession(session string, eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, p := range h.parks {
+		for sub := range p.subscribers {
+			if sub.session != session {
+				continue
+			}
+			select {
+			case sub.events <- Event{Seq: p.seq, Type: eventType, Data: data, CreatedAt: time.Now()}:
+			default:
+			}
+			delete(p.subscribers, sub)
+			sub.close()
+			p.lastSeen = time.Now()
+		}
+		if len(p.subscribers) == 0 {
+			p.connectedAt = nil
+		}
+	}
+}
+
+// Wait 长轮询：等待游标之后的事件，超时或请求取消时返回空列表
+func (h *Hub) Wait(ctx context.Context, parkID uint, after uint64, timeout time.Duration) ([]Event, uint64, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	defer h.touchLongPoll(parkID)
+
+	for {
+		h.touchLongPoll(parkID)
+
+		h.mu.Lock()
+		p := h.park(parkID)
+		events, reset := p.since(after)
+		cursor := p.seq
+		if len(events) > 0 || reset {
+			h.mu.Unlock()
+			return events, cursor, reset
+		}
+		wake := make(chan struct{})
+		p.waiters = append(p.waiters, wake)
+		h.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil, cursor, false
+		case <-ctx.Done():
+			return nil, cursor, false
+		}
+	}
+}
+
+func (h *Hub) touchLongPoll(parkID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := h.park(parkID)
+	p.lastSeen = time.Now()
+	if len(p.subscribers) == 0 {
+		p.transport = TransportLongPoll
+	}
+}
+
+// Presence 车场插件的在线状态：有 WebSocket 连接，或最近一次长轮询在宽限期内
+func (h *Hub) Presence(parkID uint) Presence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.parks[parkID]
+	if !ok {
+		return Presence{ParkID: parkID}
+	}
+	return p.presence(parkID)
+}
+
+// Presences 所有有过连接记录的车场插件状态，按车场ID排序
+func (h *Hub) Presences() []Presence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]Presence, 0, len(h.parks))
+	for parkID, p := range h.parks {
+		if p.lastSeen.IsZero() {
+			continue
+		}
+		list = append(list, p.presence(parkID))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ParkID < list[j].ParkID })
+	return list
+}
+
+func (p *parkState) presence(parkID uint) Presence {
+	online := len(p.subscribers) > 0 ||
+		(p.transport == TransportLongPoll && time.Since(p.lastSeen) <= longPollGrace)
+	return Presence{
+		ParkID:      parkID,
+		Online:      online,
+		Transport:   p.transport,
+		Connections: len(p.subscribers),
+		ConnectedAt: p.connectedAt,
+		LastSeenAt:  p.lastSeen,
+	}
+}
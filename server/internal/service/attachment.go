@@ -0,0 +1,165 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+
+	"taizhang-server/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// migrateBatchSize 迁移照片字段时每批处理的记录数
+const migrateBatchSize = 500
+
+// MigrateLegacyPhotos 将各台账表改为照片附件前的照片字段复制到 attachments，返回迁移的记录数
+// 旧字段保留以便回退，由 DropLegacyPhotoColumns 删除；迁移只执行一次，完成后记录在 data_migrations 中，
+// 此后车主删除的照片不会因再次启动而从旧字段恢复
+func (s *FileService) MigrateLegacyPhotos() (int, error) {
+	done, err := dataMigrationDone(s.repo.DB, model.DataMigrationLegacyPhotos)
+	if err != nil || done {
+		return 0, err
+	}
+
+	migrated := 0
+	for dataType, table := range ledgerTables {
+		columns := legacyPhotoColumns(s.repo.DB, table)
+		if len(columns) == 0 {
+			continue
+		}
+		n, err := migrateLegacyPhotos(s.repo.DB, dataType, table, columns)
+		migrated += n
+		if err != nil {
+			return migrated, err
+		}
+	}
+	return migrated, s.repo.DB.Create(&model.DataMigration{Name: model.DataMigrationLegacyPhotos}).Error
+}
+
+// DropLegacyPhotoColumns 删除各台账表的旧版照片字段，返回删除的字段数；照片尚未迁移时不删除
+func (s *FileService) DropLegacyPhotoColumns() (int, error) {
+	done, err := dataMigrationDone(s.repo.DB, model.DataMigrationLegacyPhotos)
+	if err != nil {
+		return 0, err
+	}
+	if !done {
+		return 0, errors.New("legacy photos have not been migrated to attachments yet, start the server once first")
+	}
+
+	migrator := s.repo.DB.Migrator()
+	dropped := 0
+	for _, table := range ledgerTables {
+		for _, column := range legacyPhotoColumns(s.repo.DB, table) {
+			if err := migrator.DropColumn(table, column); err != nil {
+				return dropped, err
+			}
+			dropped++
+		}
+	}
+	return dropped, nil
+}
+
+// legacyPhotoColumns 返回台账表中仍存在的旧版照片字段，按字段名排序
+func legacyPhotoColumns(db *gorm.DB, table string) []string {
+	migrator := db.Migrator()
+	var columns []string
+	for column := range model.LegacyPhotoFields {
+		if migrator.HasColumn(table, column) {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// dataMigrationDone 一次性数据迁移是否已完成
+func dataMigrationDone(db *gorm.DB, name string) (bool, error) {
+	var count int64
+	err := db.Model(&model.DataMigration{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+// migrateLegacyPhotos 按 ID 分批迁移一张台账表，记录已有同类型附件时保留附件；迁移的记录版本号加一并写入同步变更日志
+func migrateLegacyPhotos(db *gorm.DB, dataType, table string, columns []string) (int, error) {
+	type pending struct {
+		id          uint
+		attachments model.Attachments
+	}
+
+	migrated := 0
+	var lastID uint
+	for {
+		rows, err := db.Table(table).
+			Select(append([]string{"id", "attachments"}, columns...)).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(migrateBatchSize).
+			Rows()
+		if err != nil {
+			return migrated, err
+		}
+
+		var updates []pending
+		count := 0
+		for rows.Next() {
+			var id uint
+			var attachments model.Attachments
+			values := make([]sql.NullString, len(columns))
+			dest := []interface{}{&id, &attachments}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return migrated, err
+			}
+			count++
+			lastID = id
+
+			changed := false
+			for i, column := range columns {
+				kind := model.LegacyPhotoFields[column]
+				key := strings.TrimSpace(values[i].String)
+				if key == "" || attachments.Get(kind) != "" {
+					continue
+				}
+				attachments = append(attachments, model.Attachment{Kind: kind, Key: key})
+				changed = true
+			}
+			if changed {
+				updates = append(updates, pending{id: id, attachments: attachments})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return migrated, err
+		}
+
+		if len(updates) > 0 {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				ids := make([]uint, 0, len(updates))
+				for _, u := range updates {
+					err := tx.Table(table).Where("id = ?", u.id).Updates(map[string]interface{}{
+						"attachments": u.attachments,
+						"version":     gorm.Expr("version + 1"),
+					}).Error
+					if err != nil {
+						return err
+					}
+					ids = append(ids, u.id)
+				}
+				return logChanges(tx, dataType, model.SyncOpUpsert, ids...)
+			})
+			if err != nil {
+				return migrated, err
+			}
+			migrated += len(updates)
+		}
+
+		if count < migrateBatchSize {
+			return migrated, nil
+		}
+	}
+}
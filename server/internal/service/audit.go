@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"taizhang-server/internal/audit"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/plate"
+	"taizhang-server/internal/realtime"
+	"taizhang-server/internal/repository"
+	"taizhang-server/internal/thirdparty"
+
+	"gorm.io/gorm"
+)
+
+// autoAuditTimeout 后台自动审核一辆车的最长时间，超时未完成的保持待审核
+const autoAuditTimeout = time.Minute
+
+// AuditService 车主提交的厂外运输车辆自动审核
+type AuditService struct {
+	repo         *repository.Repository
+	vehicleLists *thirdparty.Client
+	events       *realtime.Hub
+}
+
+func NewAuditService(repo *repository.Repository, vehicleLists *thirdparty.Client, events *realtime.Hub) *AuditService {
+	return &AuditService{
+		repo:         repo,
+		vehicleLists: vehicleLists,
+		events:       events,
+	}
+}
+
+// GetRules 获取车场的自动审核规则，未保存时返回默认规则
+func (s *AuditService) GetRules(parkID uint) (*model.AuditRulesConfig, error) {
+	return loadAuditRules(s.repo, parkID)
+}
+
+// UpdateRules 保存车场的自动审核规则
+func (s *AuditService) UpdateRules(parkID uint, rules *model.AuditRulesConfig) error {
+	if err := audit.NormalizeConfig(rules); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DB.Select("id").First(&model.Park{}, parkID).Error; err != nil {
+		return err
+	}
+
+	var policy model.AuditPolicy
+	err = s.repo.DB.Where("park_id = ?", parkID).First(&policy).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	policy.ParkID = parkID
+	policy.Rules = string(data)
+	return s.repo.DB.Save(&policy).Error
+}
+
+// loadAuditRules 读取车场的自动审核规则，未保存时返回默认规则
+func loadAuditRules(repo *repository.Repository, parkID uint) (*model.AuditRulesConfig, error) {
+	var policy model.AuditPolicy
+	err := repo.DB.Where("park_id = ?", parkID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && policy.Rules == "") {
+		return audit.DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules model.AuditRulesConfig
+	if err := json.Unmarshal([]byte(policy.Rules), &rules); err != nil {
+		return nil, fmt.Errorf("审核规则格式不正确: %v", err)
+	}
+	return &rules, nil
+}
+
+// AutoAudit 按车场规则审核新提交的车辆并记录决定：通过的车辆审核通过并自动下发，驳回的标记为已驳回，
+// 其余保持待审核等待人工处理；车场启用部门审核时，规则通过的车辆仍须各部门依次审核。完成后车辆重新读取为最新数据
+// ctx 用于查询第三方随车清单
+func (s *AuditService) AutoAudit(ctx context.Context, vehicle *model.ExternalVehicle) error {
+	rules, err := loadAuditRules(s.repo, vehicle.ParkID)
+	if err != nil {
+		return err
+	}
+
+	var facts audit.Facts
+	if audit.NeedsBlacklist(rules) {
+		facts.Blacklist, err = s.matchBlacklist(vehicle.ParkID, vehicle.LicensePlate, vehicle.VIN)
+		if err != nil {
+			return err
+		}
+	}
+	if audit.NeedsThirdParty(rules) {
+		facts.ThirdParty, facts.ThirdPartyErr = s.vehicleLists.Lookup(ctx, thirdparty.Query{
+			Plate:        vehicle.LicensePlate,
+			VIN:          vehicle.VIN,
+			EngineNumber: vehicle.EngineNumber,
+			VehicleType:  vehicle.VehicleType,
+		})
+	}
+
+	outcome := audit.Evaluate(rules, vehicle, facts)
+	results, err := json.Marshal(outcome.Results)
+	if err != nil {
+		return err
+	}
+	decision := &model.AuditDecision{
+		ParkID:    vehicle.ParkID,
+		VehicleID: vehicle.ID,
+		Decision:  outcome.Decision,
+		Rule:      outcome.Rule,
+		Reason:    outcome.Reason,
+		Results:   results,
+	}
+
+	departments, err := auditDepartments(s.repo, vehicle.ParkID)
+	if err != nil {
+		return err
+	}
+
+	var queued map[uint][]uint
+	err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(decision).Error; err != nil {
+			return err
+		}
+
+		record := &model.AuditRecord{Auto: true, Reason: outcome.Reason}
+		switch {
+		case outcome.Decision == model.AuditDecisionApprove && len(departments) == 0:
+			record.Action = model.AuditActionApprove
+		case outcome.Decision == model.AuditDecisionReject:
+			record.Action = model.AuditActionReject
+		default:
+			return nil
+		}
+		if err := applyAudit(tx, vehicle, record, nil); err != nil {
+			return err
+		}
+		if vehicle.AuditStatus != model.AuditStatusApproved {
+			return nil
+		}
+		var err error
+		queued, err = enqueueDispatch(tx, model.QRCodeTypeExternalVehicle, vehicle.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyDispatch(s.events, model.QRCodeTypeExternalVehicle, queued)
+	log.Printf("Auto audit of external vehicle %d: %s %s", vehicle.ID, outcome.Decision, outcome.Reason)
+	return s.repo.DB.First(vehicle, vehicle.ID).Error
+}
+
+// ListDecisions 查询自动审核决定，可按车辆和决定筛选
+func (s *AuditService) ListDecisions(parkID, vehicleID uint, decision string, page, pageSize int) ([]model.AuditDecision, int64, error) {
+	var decisions []model.AuditDecision
+	var total int64
+
+	query := s.repo.DB.Model(&model.AuditDecision{})
+	if parkID > 0 {
+		query = query.Where("park_id = ?", parkID)
+	}
+	if vehicleID > 0 {
+		query = query.Where("vehicle_id = ?", vehicleID)
+	}
+	if decision != "" {
+		query = query.Where("decision = ?", decision)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&decisions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return decisions, total, nil
+}
+
+// ListBlacklist 查询车场黑名单
+func (s *AuditService) ListBlacklist(parkID uint, page, pageSize int) ([]model.VehicleBlacklist, int64, error) {
+	var entries []model.VehicleBlacklist
+	var total int64
+
+	query := s.repo.DB.Model(&model.VehicleBlacklist{})
+	if parkID > 0 {
+		query = query.Where("park_id = ?", parkID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// CreateBlacklist 添加黑名单，车牌和 VIN 至少填写一项
+func (s *AuditService) CreateBlacklist(entry *model.VehicleBlacklist) error {
+	entry.LicensePlate = plate.Normalize(entry.LicensePlate)
+	entry.VIN = plate.Normalize(entry.VIN)
+	if entry.LicensePlate == "" && entry.VIN == "" {
+		return fmt.Errorf("车牌号码和VIN至少填写一项")
+	}
+	if err := s.repo.DB.Select("id").First(&model.Park{}, entry.ParkID).Error; err != nil {
+		return err
+	}
+	return s.repo.DB.Create(entry).Error
+}
+
+func (s *AuditService) DeleteBlacklist(id uint) error {
+	return s.repo.DB.Delete(&model.VehicleBlacklist{}, id).Error
+}
+
+// matchBlacklist 按车牌或 VIN 查找车场黑名单，未命中时返回 nil
+func (s *AuditService) matchBlacklist(parkID uint, licensePlate, vin string) (*model.VehicleBlacklist, error) {
+	licensePlate = plate.Normalize(licensePlate)
+	vin = plate.Normalize(vin)
+	if licensePlate == "" && vin == "" {
+		return nil, nil
+	}
+
+	query := s.repo.DB.Where("park_id = ?", parkID)
+	switch {
+	case licensePlate != "" && vin != "":
+		query = query.Where("license_plate = ? OR vin = ?", licensePlate, vin)
+	case licensePlate != "":
+		query = query.Where("license_plate = ?", licensePlate)
+	default:
+		query = query.Where("vin = ?", vin)
+	}
+
+	var entry model.VehicleBlacklist
+	err := query.First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/repository"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditNotAllowed 当前审核状态或审核人不允许该操作
+var ErrAuditNotAllowed = errors.New("audit not allowed")
+
+// auditActions 目标状态对应的审核操作
+var auditActions = map[string]string{
+	model.AuditStatusApproved:    model.AuditActionApprove,
+	model.AuditStatusRejected:    model.AuditActionReject,
+	model.AuditStatusResubmitted: model.AuditActionResubmit,
+}
+
+var auditStatusLabels = map[string]string{
+	model.AuditStatusPending:     "待审核",
+	model.AuditStatusApproved:    "已通过",
+	model.AuditStatusRejected:    "已驳回",
+	model.AuditStatusResubmitted: "重新提交",
+}
+
+// legacyAuditStatuses 旧版审核状态与新状态的对应关系
+var legacyAuditStatuses = map[string]string{
+	"audited":   model.AuditStatusApproved,
+	"unaudited": model.AuditStatusPending,
+}
+
+// nextAuditState 审核状态机：返回操作后的状态和本轮已通过的部门数
+// 启用部门审核时，审核通过须由各部门依次完成，最后一个部门通过后才变为已通过
+func nextAuditState(status string, step int, action string, departments int) (string, int, error) {
+	reviewable := status == model.AuditStatusPending || status == model.AuditStatusResubmitted
+	switch action {
+	case model.AuditActionApprove:
+		if reviewable {
+			if departments == 0 {
+				return model.AuditStatusApproved, 0, nil
+			}
+			if step+1 >= departments {
+				return model.AuditStatusApproved, step + 1, nil
+			}
+			return status, step + 1, nil
+		}
+	case model.AuditActionReject:
+		if reviewable {
+			return model.AuditStatusRejected, 0, nil
+		}
+	case model.AuditActionResubmit:
+		if status == model.AuditStatusRejected {
+			return model.AuditStatusResubmitted, 0, nil
+		}
+	default:
+		return "", 0, fmt.Errorf("%w: 无效的审核操作 %s", ErrAuditNotAllowed, action)
+	}
+	return "", 0, fmt.Errorf("%w: 车辆当前%s，不能执行该操作", ErrAuditNotAllowed, auditStatusLabels[status])
+}
+
+// applyAudit 在事务内执行审核操作：更新车辆审核状态并写入审核记录
+// 车辆在事务外读取，更新时须仍处于读取时的审核状态和步骤，否则说明已被并发的审核操作修改，返回 ErrAuditNotAllowed
+func applyAudit(tx *gorm.DB, vehicle *model.ExternalVehicle, record *model.AuditRecord, departments []uint) error {
+	status, step, err := nextAuditState(vehicle.AuditStatus, vehicle.AuditStep, record.Action, len(departments))
+	if err != nil {
+		return err
+	}
+	if len(departments) > 0 && record.Action != model.AuditActionResubmit {
+		record.Step = vehicle.AuditStep + 1
+	}
+	record.ParkID = vehicle.ParkID
+	record.VehicleID = vehicle.ID
+	record.FromStatus = vehicle.AuditStatus
+	record.ToStatus = status
+
+	result := tx.Model(&model.ExternalVehicle{}).
+		Where("id = ? AND audit_status = ? AND audit_step = ?", vehicle.ID, vehicle.AuditStatus, vehicle.AuditStep).
+		Updates(map[string]interface{}{
+			"audit_status": status,
+			"audit_step":   step,
+			"version":      gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: 车辆审核状态已变更，请刷新后重试", ErrAuditNotAllowed)
+	}
+	if err := logChanges(tx, model.QRCodeTypeExternalVehicle, model.SyncOpUpsert, vehicle.ID); err != nil {
+		return err
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	vehicle.AuditStatus = status
+	vehicle.AuditStep = step
+	return nil
+}
+
+// auditDepartments 车场启用部门审核时须依次审核通过的部门，未启用时为空
+func auditDepartments(repo *repository.Repository, parkID uint) ([]uint, error) {
+	config, err := loadFieldsConfig(repo, parkID, model.QRCodeTypeExternalVehicle)
+	if err != nil {
+		return nil, err
+	}
+	feature, _ := config.Feature(model.FeatureDepartmentAudit)
+	if !feature.Enabled {
+		return nil, nil
+	}
+	return feature.Departments, nil
+}
+
+// checkParkDepartments 部门审核指定的部门须属于本车场
+func checkParkDepartments(repo *repository.Repository, parkID uint, config *model.FieldsConfig) error {
+	feature, ok := config.Feature(model.FeatureDepartmentAudit)
+	if !ok || len(feature.Departments) == 0 {
+		return nil
+	}
+	var count int64
+	err := repo.DB.Model(&model.Department{}).
+		Where("park_id = ? AND id IN ?", parkID, feature.Departments).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if int(count) != len(feature.Departments) {
+		return validation.Errors{{Field: feature.Key, Label: feature.Label, Message: "审核部门不存在或不属于本车场"}}
+	}
+	return nil
+}
+
+// Audit 执行审核操作。启用部门审核时，审核通过和驳回须由当前步骤所属部门的用户执行；重新提交不要求审核人
+// 最终审核通过后车辆才可下发
+func (s *ExternalVehicleService) Audit(req *model.AuditRequest) (*model.ExternalVehicle, error) {
+	a, err := s.newAuditor(req.Status, req.Reason, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var vehicle model.ExternalVehicle
+	if err := s.repo.DB.First(&vehicle, req.ID).Error; err != nil {
+		return nil, err
+	}
+	record, departments, err := a.prepare(&vehicle)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		return applyAudit(tx, &vehicle, record, departments)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// BatchAudit 批量审核，每辆车单独提交，逐条返回结果；试运行时只检查能否执行并给出操作后的状态
+func (s *ExternalVehicleService) BatchAudit(req *model.BatchAuditRequest) (*model.BatchResult, error) {
+	a, err := s.newAuditor(req.Status, req.Reason, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	rows, missing, err := batchTargets(s.repo.DB, model.QRCodeTypeExternalVehicle, &req.BatchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	var vehicles []model.ExternalVehicle
+	if len(ids) > 0 {
+		if err := s.repo.DB.Where("id IN ?", ids).Find(&vehicles).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]*model.ExternalVehicle, len(vehicles))
+	for i := range vehicles {
+		byID[vehicles[i].ID] = &vehicles[i]
+	}
+
+	result := &model.BatchResult{DryRun: req.DryRun, Results: []model.BatchItemResult{}}
+	for _, row := range rows {
+		item := model.BatchItemResult{ID: row.ID, LicensePlate: row.LicensePlate}
+		vehicle, ok := byID[row.ID]
+		if !ok {
+			item.Error = "记录不存在"
+			result.Add(item)
+			continue
+		}
+
+		record, departments, err := a.prepare(vehicle)
+		if err == nil && req.DryRun {
+			item.Status, _, _ = nextAuditState(vehicle.AuditStatus, vehicle.AuditStep, record.Action, len(departments))
+		} else if err == nil {
+			err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+				return applyAudit(tx, vehicle, record, departments)
+			})
+			item.Status = vehicle.AuditStatus
+		}
+		if err != nil {
+			item.Status = ""
+			item.Error = err.Error()
+		} else {
+			item.Success = true
+		}
+		result.Add(item)
+	}
+	for _, id := range missing {
+		result.Add(model.BatchItemResult{ID: id, Error: "记录不存在"})
+	}
+	return result, nil
+}
+
+// auditor 一次（批量）审核操作的参数及按车场缓存的部门审核设置和审核人信息
+type auditor struct {
+	s           *ExternalVehicleService
+	action      string
+	reason      string
+	userID      *uint
+	departments map[uint][]uint
+	reviewers   map[uint]model.AuditRecord
+}
+
+func (s *ExternalVehicleService) newAuditor(status, reason string, userID *uint) (*auditor, error) {
+	action, ok := auditActions[status]
+	if !ok {
+		return nil, fmt.Errorf("%w: 无效的审核状态 %s", ErrAuditNotAllowed, status)
+	}
+	return &auditor{
+		s:           s,
+		action:      action,
+		reason:      reason,
+		userID:      userID,
+		departments: make(map[uint][]uint),
+		reviewers:   make(map[uint]model.AuditRecord),
+	}, nil
+}
+
+// prepare 生成审核记录并检查审核人和当前状态是否允许该操作，不修改数据
+func (a *auditor) prepare(vehicle *model.ExternalVehicle) (*model.AuditRecord, []uint, error) {
+	departments, ok := a.departments[vehicle.ParkID]
+	if !ok {
+		var err error
+		if departments, err = auditDepartments(a.s.repo, vehicle.ParkID); err != nil {
+			return nil, nil, err
+		}
+		a.departments[vehicle.ParkID] = departments
+	}
+
+	record := model.AuditRecord{Action: a.action, Reason: a.reason}
+	if a.userID != nil {
+		reviewer, ok := a.reviewers[vehicle.ParkID]
+		if !ok {
+			if err := a.s.setReviewer(&reviewer, *a.userID, vehicle.ParkID); err != nil {
+				return nil, nil, err
+			}
+			a.reviewers[vehicle.ParkID] = reviewer
+		}
+		record.UserID, record.UserName = reviewer.UserID, reviewer.UserName
+		record.DepartmentID, record.DepartmentName = reviewer.DepartmentID, reviewer.DepartmentName
+	}
+	if len(departments) > 0 && a.action != model.AuditActionResubmit && vehicle.AuditStep < len(departments) {
+		if err := a.s.checkReviewDepartment(&record, departments[vehicle.AuditStep]); err != nil {
+			return nil, nil, err
+		}
+	}
+	if _, _, err := nextAuditState(vehicle.AuditStatus, vehicle.AuditStep, a.action, len(departments)); err != nil {
+		return nil, nil, err
+	}
+	return &record, departments, nil
+}
+
+// setReviewer 记录审核人及其所属部门，审核人须属于车辆所在车场
+func (s *ExternalVehicleService) setReviewer(record *model.AuditRecord, userID, parkID uint) error {
+	var user model.User
+	err := s.repo.DB.Preload("Department").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.ParkID != parkID) {
+		return fmt.Errorf("%w: 审核人不存在", ErrAuditNotAllowed)
+	}
+	if err != nil {
+		return err
+	}
+
+	record.UserID = &user.ID
+	record.UserName = user.Name
+	if record.UserName == "" {
+		record.UserName = user.Username
+	}
+	if user.Department != nil {
+		record.DepartmentID = &user.Department.ID
+		record.DepartmentName = user.Department.Name
+	}
+	return nil
+}
+
+// checkReviewDepartment 部门审核时，审核人须属于当前步骤的部门
+func (s *ExternalVehicleService) checkReviewDepartment(record *model.AuditRecord, departmentID uint) error {
+	if record.DepartmentID != nil && *record.DepartmentID == departmentID {
+		return nil
+	}
+	var department model.Department
+	err := s.repo.DB.First(&department, departmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: 当前审核部门不存在，请检查部门审核配置", ErrAuditNotAllowed)
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: 当前须由%s审核", ErrAuditNotAllowed, department.Name)
+}
+
+// AuditRecords 查询车辆的审核记录，按时间先后排列
+func (s *ExternalVehicleService) AuditRecords(vehicleID uint) ([]model.AuditRecord, error) {
+	var records []model.AuditRecord
+	err := s.repo.DB.Where("vehicle_id = ?", vehicleID).Order("id").Find(&records).Error
+	return records, err
+}
+
+// MigrateAuditStatuses 将旧版审核状态（audited、unaudited）迁移为新状态，返回迁移的记录数
+func (s *ExternalVehicleService) MigrateAuditStatuses() (int, error) {
+	migrated := 0
+	for legacy, status := range legacyAuditStatuses {
+		var ids []uint
+		err := s.repo.DB.Model(&model.ExternalVehicle{}).Where("audit_status = ?", legacy).Pluck("id", &ids).Error
+		if err != nil {
+			return migrated, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		err = updateLedgers(s.repo, model.QRCodeTypeExternalVehicle, &model.ExternalVehicle{}, ids, map[string]interface{}{
+			"audit_status": status,
+		})
+		if err != nil {
+			return migrated, err
+		}
+		migrated += len(ids)
+	}
+	return migrated, nil
+}
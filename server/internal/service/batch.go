@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"taizhang-server/internal/audit"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
+	"taizhang-server/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// maxBatchSize 单次批量操作的记录数上限
+const maxBatchSize = 1000
+
+// ErrInvalidBatch 批量操作的目标不合法
+var ErrInvalidBatch = errors.New("invalid batch request")
+
+// batchRow 批量操作目标记录的摘要
+type batchRow struct {
+	ID               uint
+	LicensePlate     string
+	EmissionStandard string
+	AuditStatus      string
+}
+
+// batchTargets 查询批量操作的目标记录，返回按请求顺序排列的记录；指定的ID不存在时记入 missing
+func batchTargets(db *gorm.DB, dataType string, req *model.BatchRequest) ([]batchRow, []uint, error) {
+	table, ok := ledgerTables[dataType]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+	columns := "id, license_plate, emission_standard"
+	if dataType == model.QRCodeTypeExternalVehicle {
+		columns += ", audit_status"
+	}
+	query := db.Table(table).Select(columns)
+
+	if len(req.IDs) > 0 {
+		if len(req.IDs) > maxBatchSize {
+			return nil, nil, fmt.Errorf("%w: 单次最多处理%d条记录", ErrInvalidBatch, maxBatchSize)
+		}
+		var rows []batchRow
+		if err := query.Where("id IN ?", req.IDs).Scan(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+		byID := make(map[uint]batchRow, len(rows))
+		for _, row := range rows {
+			byID[row.ID] = row
+		}
+
+		ordered := make([]batchRow, 0, len(rows))
+		var missing []uint
+		seen := make(map[uint]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if row, ok := byID[id]; ok {
+				ordered = append(ordered, row)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+		return ordered, missing, nil
+	}
+
+	filter := req.Filter
+	if filter == nil {
+		return nil, nil, fmt.Errorf("%w: 须指定 ids 或 filter", ErrInvalidBatch)
+	}
+	if filter.ParkID == 0 {
+		return nil, nil, fmt.Errorf("%w: 按条件筛选时须指定车场", ErrInvalidBatch)
+	}
+	query = query.Where("park_id = ?", filter.ParkID)
+	if filter.LicensePlate != "" {
+		query = query.Where("license_plate LIKE ?", "%"+filter.LicensePlate+"%")
+	}
+	if filter.DispatchStatus != "" {
+		query = query.Where("dispatch_status = ?", filter.DispatchStatus)
+	}
+	if filter.AuditStatus != "" && dataType == model.QRCodeTypeExternalVehicle {
+		if filter.AuditStatus == "unaudited" {
+			query = query.Where("audit_status IN ?", []string{model.AuditStatusPending, model.AuditStatusResubmitted})
+		} else {
+			query = query.Where("audit_status = ?", filter.AuditStatus)
+		}
+	}
+	if filter.EnvironmentalCode != "" && dataType == model.QRCodeTypeNonRoad {
+		query = query.Where("environmental_code = ?", filter.EnvironmentalCode)
+	}
+	if filter.EmissionStandard != "" {
+		spellings, err := emissionSpellings(db, table, filter.ParkID, filter.EmissionStandard)
+		if err != nil {
+			return nil, nil, err
+		}
+		query = query.Where("emission_standard IN ?", spellings)
+	}
+
+	// 多取一条用于判断是否超出上限
+	var rows []batchRow
+	if err := query.Order("id").Limit(maxBatchSize + 1).Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(rows) > maxBatchSize {
+		return nil, nil, fmt.Errorf("%w: 筛选出的记录超过%d条，请缩小筛选范围", ErrInvalidBatch, maxBatchSize)
+	}
+	return rows, nil, nil
+}
+
+// emissionSpellings 返回车场记录中统一后与 standard 相同的排放标准写法（国6、国VI 等），用于在查询中按排放标准筛选
+func emissionSpellings(db *gorm.DB, table string, parkID uint, standard string) ([]string, error) {
+	var values []string
+	err := db.Table(table).Where("park_id = ?", parkID).Distinct().Pluck("emission_standard", &values).Error
+	if err != nil {
+		return nil, err
+	}
+	standard = audit.NormalizeEmission(standard)
+	spellings := []string{}
+	for _, value := range values {
+		if audit.NormalizeEmission(value) == standard {
+			spellings = append(spellings, value)
+		}
+	}
+	return spellings, nil
+}
+
+// batchDispatch 逐条检查后将可下发的记录一并加入下发队列，check 返回记录不可下发的原因
+func batchDispatch(repo *repository.Repository, events *realtime.Hub, dataType string, req *model.BatchRequest, check func(row batchRow) error) (*model.BatchResult, error) {
+	rows, missing, err := batchTargets(repo.DB, dataType, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.BatchResult{DryRun: req.DryRun, Results: []model.BatchItemResult{}}
+	var ids []uint
+	var items []model.BatchItemResult
+	for _, row := range rows {
+		item := model.BatchItemResult{ID: row.ID, LicensePlate: row.LicensePlate, Success: true}
+		if check != nil {
+			if err := check(row); err != nil {
+				item.Success = false
+				item.Error = err.Error()
+			}
+		}
+		if item.Success {
+			ids = append(ids, row.ID)
+		}
+		items = append(items, item)
+	}
+
+	if len(ids) > 0 && !req.DryRun {
+		if err := dispatchLedgers(repo, events, dataType, ids); err != nil {
+			for i := range items {
+				if items[i].Success {
+					items[i].Success = false
+					items[i].Error = err.Error()
+				}
+			}
+		}
+	}
+
+	for _, item := range items {
+		result.Add(item)
+	}
+	for _, id := range missing {
+		result.Add(model.BatchItemResult{ID: id, Error: "记录不存在"})
+	}
+	return result, nil
+}
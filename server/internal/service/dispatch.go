@@ -0,0 +1,448 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
+	"taizhang-server/internal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 下发投递参数
+const (
+	dispatchFetchDefaultLimit = 50
+	dispatchFetchMaxLimit     = 200
+	dispatchMaxAttempts       = 8                // 超过后转入死信，需人工重试
+	dispatchRetryBase         = 30 * time.Second // 投递后未确认的重投间隔，按次数指数增长
+	dispatchRetryMax          = time.Hour
+	dispatchErrorMaxLen       = 500
+)
+
+// ErrDispatchItemNotFound 下发项不存在
+var ErrDispatchItemNotFound = errors.New("dispatch item not found")
+
+type DispatchService struct {
+	repo   *repository.Repository
+	events *realtime.Hub
+}
+
+func NewDispatchService(repo *repository.Repository, events *realtime.Hub) *DispatchService {
+	return &DispatchService{
+		repo:   repo,
+		events: events,
+	}
+}
+
+// enqueueDispatch 将台账记录加入所属车场的下发队列，返回各车场入队的记录ID
+// 记录已有待投递的下发项时只更新版本并立即重投，不重复入队
+func enqueueDispatch(tx *gorm.DB, dataType string, ids ...uint) (map[uint][]uint, error) {
+	table, ok := ledgerTables[dataType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+
+	if err := setNetworkStatus(tx, dataType, ids, model.NetworkPending); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID      uint
+		ParkID  uint
+		Version int
+	}
+	if err := tx.Table(table).Select("id, park_id, version").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	queued := make(map[uint][]uint)
+	for _, row := range rows {
+		queued[row.ParkID] = append(queued[row.ParkID], row.ID)
+
+		var item model.DispatchItem
+		err := tx.Where("park_id = ? AND data_type = ? AND record_id = ? AND status = ?",
+			row.ParkID, dataType, row.ID, model.DispatchPending).First(&item).Error
+		if err == nil {
+			err = tx.Model(&item).Updates(map[string]interface{}{
+				"version":         row.Version,
+				"attempts":        0,
+				"next_attempt_at": now,
+				"last_error":      "",
+			}).Error
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		item = model.DispatchItem{
+			ParkID:        row.ParkID,
+			DataType:      dataType,
+			RecordID:      row.ID,
+			Version:       row.Version,
+			Status:        model.DispatchPending,
+			NextAttemptAt: now,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return nil, err
+		}
+	}
+	return queued, nil
+}
+
+// setNetworkStatus 更新台账记录的联网状态，非道路移动机械没有联网状态，直接跳过
+// 联网状态由服务端维护，不属于同步数据，不增加版本号也不写入变更日志
+func setNetworkStatus(tx *gorm.DB, dataType string, ids []uint, status string) error {
+	if len(ids) == 0 || dataType == model.QRCodeTypeNonRoad {
+		return nil
+	}
+	m, err := newLedger(dataType)
+	if err != nil {
+		return err
+	}
+	return tx.Model(m).Where("id IN ?", ids).UpdateColumn("network_status", status).Error
+}
+
+// dispatchLedgers 在事务中将台账记录加入下发队列，提交后通知在线的车场插件取出
+// 下发状态待插件确认接收后更新
+func dispatchLedgers(repo *repository.Repository, events *realtime.Hub, dataType string, ids []uint) error {
+	var queued map[uint][]uint
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		queued, err = enqueueDispatch(tx, dataType, ids...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyDispatch(events, dataType, queued)
+	return nil
+}
+
+// storeLedger 在一个事务内保存台账记录（store 为 createLedgerTx 或 saveLedgerTx），dispatch 为 true 时一并加入下发队列，
+// 提交后通知车场插件；保存和入队要么都成功要么都不生效
+func storeLedger(repo *repository.Repository, events *realtime.Hub, dataType string, record model.Ledger,
+	store func(tx *gorm.DB, dataType string, record model.Ledger) error, dispatch bool) error {
+	var queued map[uint][]uint
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := store(tx, dataType, record); err != nil {
+			return err
+		}
+		if !dispatch {
+			return nil
+		}
+		var err error
+		queued, err = enqueueDispatch(tx, dataType, record.GetLedgerMeta().ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyDispatch(events, dataType, queued)
+	return nil
+}
+
+// autoDispatchEnabled 车场是否为该类型台账启用了自动下发
+func autoDispatchEnabled(repo *repository.Repository, parkID uint, dataType string) (bool, error) {
+	config, err := loadFieldsConfig(repo, parkID, dataType)
+	if err != nil {
+		return false, err
+	}
+	feature, _ := config.Feature(model.FeatureAutoDispatch)
+	return feature.Enabled, nil
+}
+
+// notifyDispatch 通知车场插件取出已入队的下发项，须在事务提交后调用
+func notifyDispatch(events *realtime.Hub, dataType string, queued map[uint][]uint) {
+	for parkID, recordIDs := range queued {
+		events.Publish(parkID, realtime.EventDispatch, map[string]interface{}{
+			"data_type":  dataType,
+			"record_ids": recordIDs,
+		})
+	}
+}
+
+// dispatchBackoff 第 attempts 次投递后等待确认的时长
+func dispatchBackoff(attempts int) time.Duration {
+	delay := dispatchRetryBase
+	for i := 1; i < attempts && delay < dispatchRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > dispatchRetryMax {
+		delay = dispatchRetryMax
+	}
+	return delay
+}
+
+// Fetch 取出车场到期的下发项并返回记录当前数据
+// 取出即计一次投递，在重投间隔内未确认的下发项到期后再次返回；超过最大投递次数或记录已删除的转入死信
+func (s *DispatchService) Fetch(parkID uint, limit int) ([]model.DispatchDelivery, error) {
+	if limit <= 0 {
+		limit = dispatchFetchDefaultLimit
+	}
+	if limit > dispatchFetchMaxLimit {
+		limit = dispatchFetchMaxLimit
+	}
+
+	deliveries := make([]model.DispatchDelivery, 0)
+	err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var items []model.DispatchItem
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("park_id = ? AND status = ? AND next_attempt_at <= ?", parkID, model.DispatchPending, now).
+			Order("id").Limit(limit).Find(&items).Error
+		if err != nil {
+			return err
+		}
+
+		ids := make(map[string][]uint)
+		for _, item := range items {
+			ids[item.DataType] = append(ids[item.DataType], item.RecordID)
+		}
+		records := make(map[string]map[uint]model.Ledger, len(ids))
+		for dataType, list := range ids {
+			found, err := findLedgers(tx, dataType, parkID, list)
+			if err != nil {
+				return err
+			}
+			records[dataType] = found
+		}
+
+		dead := make(map[string][]uint)
+		for _, item := range items {
+			updates := map[string]interface{}{}
+			record, ok := records[item.DataType][item.RecordID]
+			switch {
+			case !ok:
+				updates["status"] = model.DispatchDead
+				updates["last_error"] = "记录已删除"
+			case item.Attempts >= dispatchMaxAttempts:
+				updates["status"] = model.DispatchDead
+				if item.LastError == "" {
+					updates["last_error"] = "超过最大投递次数，插件未确认接收"
+				}
+				dead[item.DataType] = append(dead[item.DataType], item.RecordID)
+			default:
+				item.Attempts++
+				item.Version = record.GetLedgerMeta().Version
+				updates["attempts"] = item.Attempts
+				updates["version"] = item.Version
+				updates["next_attempt_at"] = now.Add(dispatchBackoff(item.Attempts))
+				deliveries = append(deliveries, model.DispatchDelivery{
+					ID:       item.ID,
+					DataType: item.DataType,
+					RecordID: item.RecordID,
+					Version:  item.Version,
+					Attempt:  item.Attempts,
+					Data:     record,
+				})
+			}
+			if err := tx.Model(&model.DispatchItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		for dataType, recordIDs := range dead {
+			if err := setNetworkStatus(tx, dataType, recordIDs, model.NetworkFailed); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Ack 处理插件的确认，确认接收的记录才更新下发状态和下发时间（厂外运输车辆同时累计下发次数）
+// 重复确认已投递的下发项不会重复计数；版本已变化的确认被忽略，下发项按新版本重投
+func (s *DispatchService) Ack(parkID uint, acks []model.DispatchAck) ([]model.DispatchAckResult, error) {
+	if len(acks) > dispatchFetchMaxLimit {
+		return nil, fmt.Errorf("too many acks, at most %d per request", dispatchFetchMaxLimit)
+	}
+
+	results := make([]model.DispatchAckResult, 0, len(acks))
+	err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		ids := make([]uint, 0, len(acks))
+		for _, ack := range acks {
+			ids = append(ids, ack.ID)
+		}
+		var items []model.DispatchItem
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("park_id = ? AND id IN ?", parkID, ids).Find(&items).Error
+		if err != nil {
+			return err
+		}
+		byID := make(map[uint]*model.DispatchItem, len(items))
+		for i := range items {
+			byID[items[i].ID] = &items[i]
+		}
+
+		now := time.Now()
+		delivered := make(map[string][]uint)
+		dead := make(map[string][]uint)
+		for _, ack := range acks {
+			item, ok := byID[ack.ID]
+			if !ok {
+				results = append(results, model.DispatchAckResult{ID: ack.ID, Error: ErrDispatchItemNotFound.Error()})
+				continue
+			}
+			if item.Status != model.DispatchPending {
+				results = append(results, model.DispatchAckResult{ID: item.ID, Status: item.Status})
+				continue
+			}
+			if ack.Version != item.Version {
+				results = append(results, model.DispatchAckResult{ID: item.ID, Status: item.Status, Error: "record version changed, will be redelivered"})
+				continue
+			}
+
+			updates := map[string]interface{}{}
+			if ack.Success {
+				item.Status = model.DispatchDelivered
+				updates["delivered_at"] = &now
+				updates["last_error"] = ""
+				delivered[item.DataType] = append(delivered[item.DataType], item.RecordID)
+			} else {
+				if item.Attempts >= dispatchMaxAttempts {
+					item.Status = model.DispatchDead
+					dead[item.DataType] = append(dead[item.DataType], item.RecordID)
+				}
+				lastError := ack.Error
+				if lastError == "" {
+					lastError = "插件接收失败"
+				}
+				if runes := []rune(lastError); len(runes) > dispatchErrorMaxLen {
+					lastError = string(runes[:dispatchErrorMaxLen])
+				}
+				updates["last_error"] = lastError
+			}
+			updates["status"] = item.Status
+			if err := tx.Model(&model.DispatchItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			results = append(results, model.DispatchAckResult{ID: item.ID, Status: item.Status})
+		}
+
+		// 下发状态同联网状态由服务端维护，不增加版本号也不写入变更日志，见 setNetworkStatus
+		for dataType, recordIDs := range delivered {
+			m, err := newLedger(dataType)
+			if err != nil {
+				return err
+			}
+			updates := map[string]interface{}{
+				"dispatch_status": model.DispatchStatusDispatched,
+				"dispatch_time":   &now,
+			}
+			if dataType == model.QRCodeTypeExternalVehicle {
+				updates["dispatch_count"] = gorm.Expr("dispatch_count + 1")
+			}
+			if dataType != model.QRCodeTypeNonRoad {
+				updates["network_status"] = model.NetworkOnline
+			}
+			if err := tx.Model(m).Where("id IN ?", recordIDs).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+		}
+		for dataType, recordIDs := range dead {
+			if err := setNetworkStatus(tx, dataType, recordIDs, model.NetworkFailed); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// List 查询下发队列，用于查看投递失败和死信
+func (s *DispatchService) List(parkID uint, status, dataType string, page, pageSize int) ([]model.DispatchItem, int64, error) {
+	var items []model.DispatchItem
+	var total int64
+
+	query := s.repo.DB.Model(&model.DispatchItem{})
+	if parkID > 0 {
+		query = query.Where("park_id = ?", parkID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if dataType != "" {
+		query = query.Where("data_type = ?", dataType)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// Retry 将死信或待投递的下发项重置为立即投递，投递次数清零
+func (s *DispatchService) Retry(id uint) (*model.DispatchItem, error) {
+	var item model.DispatchItem
+	err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDispatchItemNotFound
+			}
+			return err
+		}
+		if item.Status == model.DispatchDelivered {
+			return fmt.Errorf("下发项已投递，请重新下发记录")
+		}
+
+		// 同一记录已有新的待投递项时无需重试死信
+		if item.Status == model.DispatchDead {
+			var count int64
+			err := tx.Model(&model.DispatchItem{}).
+				Where("park_id = ? AND data_type = ? AND record_id = ? AND status = ?",
+					item.ParkID, item.DataType, item.RecordID, model.DispatchPending).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("该记录已有待投递的下发项")
+			}
+		}
+
+		item.Status = model.DispatchPending
+		item.Attempts = 0
+		item.NextAttemptAt = time.Now()
+		item.LastError = ""
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		return setNetworkStatus(tx, item.DataType, []uint{item.RecordID}, model.NetworkPending)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(item.ParkID, realtime.EventDispatch, map[string]interface{}{
+		"data_type":  item.DataType,
+		"record_ids": []uint{item.RecordID},
+	})
+	return &item, nil
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/spreadsheet"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+// exportChunkSize 导出时每批从数据库读取的记录数
+const exportChunkSize = 1000
+
+// ErrInvalidExport 导出格式不支持，或记录数超出 XLSX 工作表的行数上限
+var ErrInvalidExport = errors.New("invalid export")
+
+// ExportOptions 台账导出选项
+type ExportOptions struct {
+	Format string // xlsx 或 csv
+	Photos bool   // 在规格列之后附加照片列，内容为照片原图的下载地址
+	Origin string // 下载地址为相对路径时拼接的协议和主机，如 https://example.com
+}
+
+// ledgerExport 台账导出表格：表头与规格中列表的列顺序一致，第一列为序号
+type ledgerExport[T model.Ledger] struct {
+	dataType    string
+	sheet       string
+	headers     []string
+	row         func(record T) []spreadsheet.Cell // 序号之后各列的单元格
+	attachments func(record T) model.Attachments
+}
+
+var externalVehicleExport = ledgerExport[*model.ExternalVehicle]{
+	dataType: model.QRCodeTypeExternalVehicle,
+	sheet:    "厂外运输车辆",
+	headers: []string{
+		"序号", "车牌号码", "号牌颜色", "车辆类型", "车辆识别代码(VIN)", "注册登记日期", "车辆品牌型号", "燃料类型", "排放标准", "联网状态",
+		"使用性质", "登记时间", "修改时间", "下发时间", "审核状态", "下发状态", "次数",
+		"发动机号码", "发动机型号", "发动机制造商", "核定载质量(kg)", "准牵引质量/kg", "手机号码", "是否安装",
+		"车队名称", "进厂运输货物名称", "进厂运输量/吨", "出厂运输货物名称", "出厂运输量/吨", "住址", "发证日期",
+	},
+	row: func(v *model.ExternalVehicle) []spreadsheet.Cell {
+		return []spreadsheet.Cell{
+			textCell(v.LicensePlate), textCell(v.PlateColor), textCell(v.VehicleType), textCell(v.VIN), textCell(v.RegisterDate),
+			textCell(v.BrandModel), textCell(v.FuelType), textCell(v.EmissionStandard), textCell(networkStatusLabel(v.NetworkStatus)),
+			textCell(v.UsageNature), textCell(exportTime(&v.CreatedAt)), textCell(exportTime(&v.UpdatedAt)), textCell(exportTime(v.DispatchTime)),
+			textCell(auditStatusLabels[v.AuditStatus]), textCell(dispatchStatusLabel(v.DispatchStatus)), numberCell(float64(v.DispatchCount)),
+			textCell(v.EngineNumber), textCell(v.EngineModel), textCell(v.EngineManufacturer),
+			optionalNumber(v.ApprovedLoadMass), optionalNumber(v.MaxTowingMass), textCell(v.Phone), textCell(yesNo(v.IsOBDEnabled)),
+			textCell(v.FleetName), textCell(v.InboundCargoName), optionalNumber(v.InboundCargoWeight),
+			textCell(v.OutboundCargoName), optionalNumber(v.OutboundCargoWeight), textCell(v.Address), textCell(v.IssueDate),
+		}
+	},
+	attachments: func(v *model.ExternalVehicle) model.Attachments { return v.Attachments },
+}
+
+var internalVehicleExport = ledgerExport[*model.InternalVehicle]{
+	dataType: model.QRCodeTypeInternalVehicle,
+	sheet:    "厂内运输车辆",
+	headers: []string{
+		"序号", "环保登记编码", "车辆识别代码（VIN）", "生产日期", "车牌号码", "注册登记日期", "车辆品牌型号", "燃料类型", "排放标准", "联网状态",
+		"车辆所有人（单位）", "车辆类型", "车牌颜色", "发动机号码", "地标环保登记编码", "核定载质量(kg)", "准牵引质量/kg", "住址", "发证日期",
+	},
+	row: func(v *model.InternalVehicle) []spreadsheet.Cell {
+		return []spreadsheet.Cell{
+			textCell(v.EnvironmentalCode), textCell(v.VIN), textCell(v.ProductionDate), textCell(v.LicensePlate), textCell(v.RegisterDate),
+			textCell(v.BrandModel), textCell(v.FuelType), textCell(v.EmissionStandard), textCell(networkStatusLabel(v.NetworkStatus)),
+			textCell(v.Owner), textCell(v.VehicleType), textCell(v.PlateColor), textCell(v.EngineNumber), textCell(v.LocalEnvironmentalCode),
+			optionalNumber(v.ApprovedLoadMass), optionalNumber(v.MaxTowingMass), textCell(v.Address), textCell(v.IssueDate),
+		}
+	},
+	attachments: func(v *model.InternalVehicle) model.Attachments { return v.Attachments },
+}
+
+var nonRoadExport = ledgerExport[*model.NonRoadMachinery]{
+	dataType: model.QRCodeTypeNonRoad,
+	sheet:    "非道路移动机械",
+	headers: []string{
+		"序号", "环保登记编码", "机械生产日期", "车牌号码", "排放标准", "燃料类型", "机械种类", "机械环保代码/产品识别码（PIN）", "机械型号",
+		"发动机型号", "发动机生产厂", "发动机编号", "所属人（单位）", "环保信息公开编号", "登记日期", "机械制造厂", "发动机额定净功率/kw", "地标环保登记编码", "入场日期",
+	},
+	row: func(m *model.NonRoadMachinery) []spreadsheet.Cell {
+		return []spreadsheet.Cell{
+			textCell(m.EnvironmentalCode), textCell(m.ProductionDate), textCell(m.LicensePlate), textCell(m.EmissionStandard), textCell(m.FuelType),
+			textCell(m.MachineryType), textCell(m.PIN), textCell(m.MachineryModel),
+			textCell(m.EngineModel), textCell(m.EngineManufacturer), textCell(m.EngineNumber), textCell(m.Owner), textCell(m.EnvironmentalInfoNumber),
+			textCell(m.RegisterDate), textCell(m.MachineryManufacturer), optionalNumber(m.EnginePower), textCell(m.LocalEnvironmentalCode), textCell(m.EntryDate),
+		}
+	},
+	attachments: func(m *model.NonRoadMachinery) model.Attachments { return m.Attachments },
+}
+
+// Export 按列表的筛选条件流式导出车场的厂外运输车辆
+func (s *ExternalVehicleService) Export(w io.Writer, parkID uint, licensePlate, auditStatus, dispatchStatus, emissionStandard string, opts ExportOptions) error {
+	query := func() *gorm.DB {
+		return s.filter(parkID, licensePlate, auditStatus, dispatchStatus, emissionStandard)
+	}
+	return exportLedger(w, s.files, parkID, query, externalVehicleExport, opts)
+}
+
+// Export 按列表的筛选条件流式导出车场的厂内运输车辆
+func (s *InternalVehicleService) Export(w io.Writer, parkID uint, licensePlate, dispatchStatus, emissionStandard string, opts ExportOptions) error {
+	query := func() *gorm.DB {
+		return s.filter(parkID, licensePlate, dispatchStatus, emissionStandard)
+	}
+	return exportLedger(w, s.files, parkID, query, internalVehicleExport, opts)
+}
+
+// Export 按列表的筛选条件流式导出车场的非道路移动机械
+func (s *NonRoadService) Export(w io.Writer, parkID uint, environmentalCode, licensePlate, dispatchStatus, emissionStandard string, opts ExportOptions) error {
+	query := func() *gorm.DB {
+		return s.filter(parkID, environmentalCode, licensePlate, dispatchStatus, emissionStandard)
+	}
+	return exportLedger(w, s.files, parkID, query, nonRoadExport, opts)
+}
+
+// exportLedger 按 ID 分批读取 query 筛选的记录并逐行写出，内存占用与记录总数无关
+// 第一批记录读取成功后才开始写出，此前的错误（包括格式不支持、超出行数上限）可由调用方返回错误响应
+func exportLedger[T model.Ledger](w io.Writer, files *FileService, parkID uint, query func() *gorm.DB, export ledgerExport[T], opts ExportOptions) error {
+	if opts.Format != spreadsheet.FormatXLSX && opts.Format != spreadsheet.FormatCSV {
+		return fmt.Errorf("%w: 导出格式只支持 xlsx、csv", ErrInvalidExport)
+	}
+	if opts.Format == spreadsheet.FormatXLSX {
+		var total int64
+		if err := query().Count(&total).Error; err != nil {
+			return err
+		}
+		if total >= spreadsheet.MaxXLSXRows {
+			return fmt.Errorf("%w: 共%d条记录，超出 Excel 工作表的行数上限，请缩小筛选范围或导出 CSV", ErrInvalidExport, total)
+		}
+	}
+
+	var photos []model.FieldSetting
+	if opts.Photos {
+		var err error
+		if photos, err = exportPhotoFields(files, parkID, export.dataType); err != nil {
+			return err
+		}
+	}
+
+	var writer spreadsheet.Writer
+	seq := 0
+	var lastID uint
+	for {
+		var batch []T
+		err := query().Where("id > ?", lastID).Order("id").Limit(exportChunkSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+
+		if writer == nil {
+			if writer, err = spreadsheet.NewWriter(w, opts.Format, export.sheet); err != nil {
+				return err
+			}
+			header := make([]spreadsheet.Cell, 0, len(export.headers)+len(photos))
+			for _, h := range export.headers {
+				header = append(header, textCell(h))
+			}
+			for _, f := range photos {
+				header = append(header, textCell(f.Label))
+			}
+			if err := writer.WriteRow(header); err != nil {
+				return err
+			}
+		}
+
+		for _, record := range batch {
+			seq++
+			row := append([]spreadsheet.Cell{numberCell(float64(seq))}, export.row(record)...)
+			if len(photos) > 0 {
+				urls := files.ExportPhotoURLs(parkID, export.attachments(record))
+				for _, f := range photos {
+					link := urls[f.Key]
+					if strings.HasPrefix(link, "/") {
+						link = opts.Origin + link
+					}
+					row = append(row, spreadsheet.Cell{Value: link, Link: true})
+				}
+			}
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportChunkSize {
+			break
+		}
+		lastID = batch[len(batch)-1].GetLedgerMeta().ID
+	}
+	return writer.Close()
+}
+
+// exportPhotoFields 返回导出的照片列，按字段定义的顺序，不包括车场字段配置中隐藏的照片
+func exportPhotoFields(files *FileService, parkID uint, dataType string) ([]model.FieldSetting, error) {
+	config, err := loadFieldsConfig(files.repo, parkID, dataType)
+	if err != nil {
+		return nil, err
+	}
+	rules := validation.RulesFromConfig(dataType, config)
+	defaults, err := validation.DefaultFieldsConfig(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	var photos []model.FieldSetting
+	for _, f := range defaults.Fields {
+		if validation.IsAttachment(dataType, f.Key) && rules[f.Key].Visible {
+			photos = append(photos, f)
+		}
+	}
+	return photos, nil
+}
+
+func dispatchStatusLabel(status string) string {
+	if status == model.DispatchStatusDispatched {
+		return "已下发"
+	}
+	return "未下发"
+}
+
+func networkStatusLabel(status string) string {
+	switch status {
+	case model.NetworkOnline:
+		return "已联网"
+	case model.NetworkPending:
+		return "下发中"
+	case model.NetworkFailed:
+		return "下发失败"
+	}
+	return "未联网"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "是"
+	}
+	return "否"
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func textCell(value string) spreadsheet.Cell {
+	return spreadsheet.Text(value)
+}
+
+func numberCell(v float64) spreadsheet.Cell {
+	return spreadsheet.Cell{Value: strconv.FormatFloat(v, 'f', -1, 64), Number: true}
+}
+
+// optionalNumber 未填写的数值导出为空单元格
+func optionalNumber(v *float64) spreadsheet.Cell {
+	if v == nil {
+		return spreadsheet.Cell{}
+	}
+	return numberCell(*v)
+}
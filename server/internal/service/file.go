@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/imaging"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/repository"
+	"taizhang-server/internal/storage"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+// FileDownloadPath 文件下载接口路径，签名地址为 FileDownloadPath + 对象键 + 签名参数
+const FileDownloadPath = "/api/v1/files/"
+
+var (
+	// ErrInvalidUpload 上传的文件类型或大小不符合要求
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrFileForbidden 文件不属于请求的车场，或下载地址无效、已过期
+	ErrFileForbidden = errors.New("file access denied")
+	// ErrInvalidUploadToken 小程序上传令牌无效、已过期，或对应的二维码已更换、停用
+	ErrInvalidUploadToken = errors.New("invalid upload token")
+)
+
+// uploadTokenPrefix 上传令牌签名所用的键前缀，与文件对象键区分
+const uploadTokenPrefix = "upload-token/"
+
+// FileService 照片上传与限时下载
+type FileService struct {
+	repo    *repository.Repository
+	store   storage.Storage
+	images  *imaging.Processor
+	signer  *storage.Signer
+	maxSize int64
+
+	exportTTL      time.Duration // 导出表格中照片下载地址的有效期
+	uploadTokenTTL time.Duration // 小程序上传令牌的有效期
+}
+
+func NewFileService(repo *repository.Repository, cfg *config.Config, store storage.Storage, images *imaging.Processor) *FileService {
+	secret := cfg.Storage.URLSecret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("Failed to generate storage url secret: %v", err)
+		}
+		secret = hex.EncodeToString(buf)
+		log.Printf("Warning: storage.url_secret is not set, signed file urls will be invalid after restart")
+	}
+	return &FileService{
+		repo:    repo,
+		store:   store,
+		images:  images,
+		signer:  storage.NewSigner(secret, cfg.Storage.URLTTL),
+		maxSize: cfg.Storage.MaxSize,
+
+		exportTTL:      cfg.Storage.ExportURLTTL,
+		uploadTokenTTL: cfg.Storage.UploadTokenTTL,
+	}
+}
+
+// MaxSize 单个文件大小上限
+func (s *FileService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Upload 处理并保存车场照片：去除 EXIF 等元数据、压缩较大的原图并生成缩略图
+// 对象键由车场和处理后的内容决定，同一文件重复上传得到相同的键
+func (s *FileService) Upload(ctx context.Context, parkID uint, data []byte) (*model.UploadedFile, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: 请选择要上传的文件", ErrInvalidUpload)
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, fmt.Errorf("%w: 文件不能超过%dMB", ErrInvalidUpload, s.maxSize>>20)
+	}
+	if err := s.repo.DB.Select("id").First(&model.Park{}, parkID).Error; err != nil {
+		return nil, err
+	}
+
+	saved, err := s.images.Save(ctx, s.store, storage.ParkKey(parkID, ""), data)
+	if errors.Is(err, imaging.ErrUnsupported) {
+		return nil, fmt.Errorf("%w: 只支持 JPEG、PNG、WebP 图片", ErrInvalidUpload)
+	}
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	link, expiresAt := s.sign(saved.Key, parkID)
+	thumbnail := link
+	if saved.Thumbnail {
+		thumbnail, _ = s.sign(storage.ThumbnailKey(saved.Key), parkID)
+	}
+	return &model.UploadedFile{
+		Key:          saved.Key,
+		URL:          link,
+		ThumbnailURL: thumbnail,
+		ExpiresAt:    expiresAt,
+		ContentType:  saved.ContentType,
+		Size:         saved.Size,
+	}, nil
+}
+
+// PhotoURLs 为车场记录的照片附件生成限时下载地址，按照片类型索引，thumbnails 为 true 时使用缩略图
+// 无权访问的照片不返回，已是完整地址的历史数据原样返回
+func (s *FileService) PhotoURLs(parkID uint, attachments model.Attachments, thumbnails bool) map[string]string {
+	return s.photoURLs(parkID, attachments, thumbnails, 0)
+}
+
+// ExportPhotoURLs 为导出的表格生成照片原图的下载地址，有效期为 storage.export_url_ttl，以便表格发出后一段时间内仍可查看
+func (s *FileService) ExportPhotoURLs(parkID uint, attachments model.Attachments) map[string]string {
+	return s.photoURLs(parkID, attachments, false, s.exportTTL)
+}
+
+// photoURLs ttl 为 0 时使用 storage.url_ttl
+func (s *FileService) photoURLs(parkID uint, attachments model.Attachments, thumbnails bool, ttl time.Duration) map[string]string {
+	urls := make(map[string]string, len(attachments))
+	for _, attachment := range attachments {
+		key := attachment.Key
+		switch {
+		case key == "":
+		case strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") || strings.HasPrefix(key, "/"):
+			urls[attachment.Kind] = key
+		case checkFileAccess(key, parkID) == nil:
+			if thumbnails {
+				key = storage.ThumbnailKey(key)
+			}
+			if ttl > 0 {
+				query, _ := s.signer.SignTTL(key, parkID, time.Now(), ttl)
+				urls[attachment.Kind] = FileDownloadPath + key + "?" + query.Encode()
+			} else {
+				urls[attachment.Kind], _ = s.sign(key, parkID)
+			}
+		}
+	}
+	return urls
+}
+
+// SignURLs 为车场的文件生成限时下载地址，不属于该车场的文件逐条返回错误
+func (s *FileService) SignURLs(parkID uint, keys []string) []model.SignedURL {
+	results := make([]model.SignedURL, 0, len(keys))
+	for _, key := range keys {
+		result := model.SignedURL{Key: key}
+		if err := checkFileAccess(key, parkID); err != nil {
+			result.Error = err.Error()
+		} else {
+			var expiresAt time.Time
+			result.URL, expiresAt = s.sign(key, parkID)
+			result.ExpiresAt = &expiresAt
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// SignURL 为单个文件生成限时下载地址，key 为空时返回空字符串
+func (s *FileService) SignURL(parkID uint, key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	if err := checkFileAccess(key, parkID); err != nil {
+		return "", err
+	}
+	link, _ := s.sign(key, parkID)
+	return link, nil
+}
+
+// Open 校验下载地址后读取文件，使用完毕须关闭 Body
+func (s *FileService) Open(ctx context.Context, key string, query url.Values) (*storage.Object, error) {
+	parkID, err := s.signer.Verify(key, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFileForbidden, err)
+	}
+	if err := checkFileAccess(key, parkID); err != nil {
+		return nil, err
+	}
+	object, err := s.store.Get(ctx, key)
+	// 早期上传的 WebP 图片没有缩略图，返回原图
+	if original, ok := storage.OriginalKey(key); ok && errors.Is(err, storage.ErrNotFound) {
+		return s.store.Get(ctx, original)
+	}
+	return object, err
+}
+
+// CheckAttachments 校验记录保存的照片附件：新提交的对象键须属于该车场且文件已上传
+// 与 previous（更新前的附件）相同的键不再检查，迁移前保存的完整地址因此只能原样保留，不能新提交
+func (s *FileService) CheckAttachments(ctx context.Context, dataType string, parkID uint, attachments, previous model.Attachments) error {
+	var errs validation.Errors
+	for _, attachment := range attachments {
+		if attachment.Key == "" || attachment.Key == previous.Get(attachment.Kind) {
+			continue
+		}
+		label := validation.FieldLabel(dataType, attachment.Kind)
+		if checkFileAccess(attachment.Key, parkID) != nil {
+			errs = append(errs, validation.FieldError{Field: attachment.Kind, Label: label, Message: label + "不是本车场上传的文件"})
+			continue
+		}
+		exists, err := s.store.Exists(ctx, attachment.Key)
+		if err != nil {
+			return fmt.Errorf("check attachment %s: %w", attachment.Key, err)
+		}
+		if !exists {
+			errs = append(errs, validation.FieldError{Field: attachment.Kind, Label: label, Message: label + "文件不存在，请重新上传"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// IssueUploadToken 扫码时为小程序签发上传令牌，格式为 二维码ID.过期时间.签名
+// 签名覆盖二维码当前的内容令牌，二维码重新生成后已签发的上传令牌随之失效
+func (s *FileService) IssueUploadToken(qrcode *model.QRCode) (string, time.Time) {
+	query, expiresAt := s.signer.SignTTL(uploadTokenPrefix+qrcode.Content, qrcode.ParkID, time.Now(), s.uploadTokenTTL)
+	return fmt.Sprintf("%d.%s.%s", qrcode.ID, query.Get("expires"), query.Get("sig")), expiresAt
+}
+
+// VerifyUploadToken 校验小程序上传令牌，返回令牌所属的车场
+func (s *FileService) VerifyUploadToken(token string) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%w: 令牌格式错误", ErrInvalidUploadToken)
+	}
+	var qrcode model.QRCode
+	err := s.repo.DB.Where("id = ? AND is_enabled = ?", parts[0], true).First(&qrcode).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("%w: 二维码不存在或已停用", ErrInvalidUploadToken)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return s.checkUploadToken(&qrcode, parts[1], parts[2])
+}
+
+// checkUploadToken 按二维码当前的内容令牌校验上传令牌的过期时间和签名
+func (s *FileService) checkUploadToken(qrcode *model.QRCode, expires, sig string) (uint, error) {
+	query := url.Values{
+		"park_id": {strconv.FormatUint(uint64(qrcode.ParkID), 10)},
+		"expires": {expires},
+		"sig":     {sig},
+	}
+	parkID, err := s.signer.Verify(uploadTokenPrefix+qrcode.Content, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidUploadToken, err)
+	}
+	return parkID, nil
+}
+
+func (s *FileService) sign(key string, parkID uint) (string, time.Time) {
+	query, expiresAt := s.signer.Sign(key, parkID, time.Now())
+	return FileDownloadPath + key + "?" + query.Encode(), expiresAt
+}
+
+// checkFileAccess 车场只能访问本车场的文件和共享文件
+func checkFileAccess(key string, parkID uint) error {
+	if err := storage.ValidateKey(key); err != nil {
+		return fmt.Errorf("%w: %v", ErrFileForbidden, err)
+	}
+	owner, ok := storage.KeyParkID(key)
+	if !ok || (owner != 0 && owner != parkID) {
+		return fmt.Errorf("%w: 文件不属于该车场", ErrFileForbidden)
+	}
+	return nil
+}
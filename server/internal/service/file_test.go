@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/storage"
+	"taizhang-server/internal/validation"
+)
+
+func TestCheckAttachments(t *testing.T) {
+	store := storage.NewLocal(t.TempDir())
+	ctx := context.Background()
+	for _, key := range []string{"parks/1/front.jpg", "parks/2/front.jpg", storage.SharedPrefix + "list.jpg"} {
+		if err := store.Put(ctx, key, pngHeader, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &FileService{store: store}
+	legacy := "https://cdn.example.com/old/front.jpg"
+	previous := model.Attachments{{Kind: model.AttachmentVehicleFront, Key: legacy}}
+
+	tests := []struct {
+		name      string
+		key       string
+		previous  model.Attachments
+		wantError bool
+	}{
+		{"own park", "parks/1/front.jpg", nil, false},
+		{"shared", storage.SharedPrefix + "list.jpg", nil, false},
+		{"unchanged legacy url", legacy, previous, false},
+		{"other park", "parks/2/front.jpg", nil, true},
+		{"not uploaded", "parks/1/missing.jpg", nil, true},
+		{"new raw url", "https://cdn.example.com/new.jpg", previous, true},
+		{"path traversal", "parks/1/../2/front.jpg", nil, true},
+	}
+	for _, tt := range tests {
+		attachments := model.Attachments{{Kind: model.AttachmentVehicleFront, Key: tt.key}}
+		err := s.CheckAttachments(ctx, model.QRCodeTypeExternalVehicle, 1, attachments, tt.previous)
+		if !tt.wantError {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var errs validation.Errors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != model.AttachmentVehicleFront || errs[0].Label != "车头照片" {
+			t.Errorf("%s: err = %#v, want one validation error on %s", tt.name, err, model.AttachmentVehicleFront)
+		}
+	}
+}
+
+func TestUploadToken(t *testing.T) {
+	s := &FileService{signer: storage.NewSigner("secret", time.Hour), uploadTokenTTL: time.Hour}
+	qrcode := &model.QRCode{ID: 7, ParkID: 3, Content: "qr-token"}
+
+	token, expiresAt := s.IssueUploadToken(qrcode)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != "7" || time.Until(expiresAt) <= 0 {
+		t.Fatalf("token = %s, expires at %v", token, expiresAt)
+	}
+	if parkID, err := s.checkUploadToken(qrcode, parts[1], parts[2]); err != nil || parkID != 3 {
+		t.Errorf("checkUploadToken = %d, %v, want 3", parkID, err)
+	}
+
+	tests := []struct {
+		name   string
+		qrcode *model.QRCode
+		sig    string
+	}{
+		{"regenerated qrcode", &model.QRCode{ID: 7, ParkID: 3, Content: "new-token"}, parts[2]},
+		{"other park", &model.QRCode{ID: 7, ParkID: 4, Content: "qr-token"}, parts[2]},
+		{"tampered signature", qrcode, strings.Repeat("0", len(parts[2]))},
+	}
+	for _, tt := range tests {
+		if _, err := s.checkUploadToken(tt.qrcode, parts[1], tt.sig); !errors.Is(err, ErrInvalidUploadToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidUploadToken", tt.name, err)
+		}
+	}
+
+	s.uploadTokenTTL = -time.Minute
+	token, _ = s.IssueUploadToken(qrcode)
+	parts = strings.Split(token, ".")
+	if _, err := s.checkUploadToken(qrcode, parts[1], parts[2]); !errors.Is(err, ErrInvalidUploadToken) {
+		t.Errorf("expired: err = %v, want ErrInvalidUploadToken", err)
+	}
+
+	for _, token := range []string{"", "7", "7.123", "7.123.sig.extra"} {
+		if _, err := s.VerifyUploadToken(token); !errors.Is(err, ErrInvalidUploadToken) {
+			t.Errorf("VerifyUploadToken(%q): err = %v, want ErrInvalidUploadToken", token, err)
+		}
+	}
+}
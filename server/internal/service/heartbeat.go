@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
+
+	"gorm.io/gorm"
+)
+
+// minHeartbeatInterval 建议心跳间隔的下限
+const minHeartbeatInterval = 10 * time.Second
+
+// Heartbeat 记录插件心跳：版本、主机信息和本地记录数，返回服务端记录数供插件核对
+func (s *PluginService) Heartbeat(parkID uint, clientIP string, hb *model.PluginHeartbeat) (*model.PluginHeartbeatResult, error) {
+	for dataType := range hb.LocalCounts {
+		if _, ok := ledgerTables[dataType]; !ok {
+			return nil, fmt.Errorf("unsupported data type: %s", dataType)
+		}
+	}
+	counts, err := json.Marshal(hb.LocalCounts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var status model.PluginStatus
+	err = s.repo.DB.Where("park_id = ?", parkID).First(&status).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	// 从离线恢复时重新计算连续在线时间
+	if status.OnlineSince == nil || now.Sub(status.LastSeenAt) > s.cfg.Plugin.OfflineAfter {
+		status.OnlineSince = &now
+	}
+	status.ParkID = parkID
+	status.PluginVersion = hb.PluginVersion
+	status.HostName = hb.HostName
+	status.OS = hb.OS
+	status.ClientIP = clientIP
+	status.LocalCounts = string(counts)
+	status.LastSeenAt = now
+	if err := s.repo.DB.Save(&status).Error; err != nil {
+		return nil, err
+	}
+
+	result := &model.PluginHeartbeatResult{
+		ServerTime:    now,
+		NextHeartbeat: int(s.heartbeatInterval() / time.Second),
+		ServerCounts:  make(map[string]int64, len(ledgerTables)),
+	}
+	for dataType, table := range ledgerTables {
+		var count int64
+		if err := s.repo.DB.Table(table).Where("park_id = ?", parkID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		result.ServerCounts[dataType] = count
+	}
+	err = s.repo.DB.Model(&model.DispatchItem{}).
+		Where("park_id = ? AND status = ?", parkID, model.DispatchPending).
+		Count(&result.PendingDispatch).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// heartbeatInterval 建议的心跳间隔，离线判定时间内至少上报三次
+func (s *PluginService) heartbeatInterval() time.Duration {
+	interval := s.cfg.Plugin.OfflineAfter / 3
+	if interval < minHeartbeatInterval {
+		interval = minHeartbeatInterval
+	}
+	return interval
+}
+
+// PluginStatuses 查询车场插件状态，parkID 为 0 时返回全部车场
+func (s *PluginService) PluginStatuses(parkID uint) ([]model.PluginStatusView, error) {
+	query := s.repo.DB.Order("id")
+	if parkID > 0 {
+		query = query.Where("id = ?", parkID)
+	}
+	var parks []model.Park
+	if err := query.Find(&parks).Error; err != nil {
+		return nil, err
+	}
+	return s.statusViews(parks)
+}
+
+// SilentParks 列出有效期内、插件超过 threshold 没有心跳或实时连接的车场，从未连接过的排在最前
+func (s *PluginService) SilentParks(threshold time.Duration) ([]model.PluginStatusView, error) {
+	if threshold <= 0 {
+		threshold = s.cfg.Plugin.SilentThreshold
+	}
+
+	now := time.Now()
+	var parks []model.Park
+	if err := s.repo.DB.Where("start_time <= ? AND end_time >= ?", now, now).Find(&parks).Error; err != nil {
+		return nil, err
+	}
+	views, err := s.statusViews(parks)
+	if err != nil {
+		return nil, err
+	}
+
+	silent := make([]model.PluginStatusView, 0)
+	for _, view := range views {
+		if view.LastSeenAt == nil || time.Duration(view.SilentSeconds)*time.Second > threshold {
+			silent = append(silent, view)
+		}
+	}
+	sort.SliceStable(silent, func(i, j int) bool {
+		if silent[i].LastSeenAt == nil || silent[j].LastSeenAt == nil {
+			return silent[i].LastSeenAt == nil && silent[j].LastSeenAt != nil
+		}
+		return silent[i].LastSeenAt.Before(*silent[j].LastSeenAt)
+	})
+	return silent, nil
+}
+
+// statusViews 合并心跳记录与实时连接状态
+func (s *PluginService) statusViews(parks []model.Park) ([]model.PluginStatusView, error) {
+	ids := make([]uint, 0, len(parks))
+	for _, park := range parks {
+		ids = append(ids, park.ID)
+	}
+	var statuses []model.PluginStatus
+	if len(ids) > 0 {
+		if err := s.repo.DB.Where("park_id IN ?", ids).Find(&statuses).Error; err != nil {
+			return nil, err
+		}
+	}
+	byPark := make(map[uint]*model.PluginStatus, len(statuses))
+	for i := range statuses {
+		byPark[statuses[i].ParkID] = &statuses[i]
+	}
+
+	now := time.Now()
+	views := make([]model.PluginStatusView, 0, len(parks))
+	for _, park := range parks {
+		views = append(views, s.statusView(&park, byPark[park.ID], s.events.Presence(park.ID), now))
+	}
+	return views, nil
+}
+
+func (s *PluginService) statusView(park *model.Park, status *model.PluginStatus, presence realtime.Presence, now time.Time) model.PluginStatusView {
+	view := model.PluginStatusView{
+		ParkID:        park.ID,
+		ParkName:      park.Name,
+		ParkCode:      park.Code,
+		Online:        presence.Online,
+		OnlineSince:   presence.ConnectedAt,
+		SilentSeconds: -1,
+		Transport:     presence.Transport,
+		Connections:   presence.Connections,
+	}
+	if !presence.LastSeenAt.IsZero() {
+		lastSeen := presence.LastSeenAt
+		view.LastSeenAt = &lastSeen
+	}
+
+	if status != nil {
+		view.PluginVersion = status.PluginVersion
+		view.HostName = status.HostName
+		view.OS = status.OS
+		view.ClientIP = status.ClientIP
+		json.Unmarshal([]byte(status.LocalCounts), &view.LocalCounts)
+		if view.LastSeenAt == nil || status.LastSeenAt.After(*view.LastSeenAt) {
+			lastSeen := status.LastSeenAt
+			view.LastSeenAt = &lastSeen
+		}
+		if now.Sub(status.LastSeenAt) <= s.cfg.Plugin.OfflineAfter {
+			view.Online = true
+			view.OnlineSince = status.OnlineSince
+		}
+	}
+
+	if view.LastSeenAt != nil {
+		view.SilentSeconds = int64(now.Sub(*view.LastSeenAt) / time.Second)
+	}
+	return view
+}
@@ -0,0 +1,853 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
+	"taizhang-server/internal/repository"
+	"taizhang-server/internal/spreadsheet"
+	"taizhang-server/internal/storage"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// importBatchSize 每批校验和写入的行数，每批更新一次进度
+	importBatchSize = 200
+	// importWorkers 同时在后台执行的导入任务数，其余任务排队等待
+	importWorkers = 2
+	// importPreviewRows 上传后返回的数据行数
+	importPreviewRows = 5
+)
+
+var (
+	// ErrInvalidImport 导入文件或列映射不符合要求
+	ErrInvalidImport = errors.New("invalid import")
+	// ErrImportNotAllowed 导入任务正在执行或已导入完成
+	ErrImportNotAllowed = errors.New("import job cannot be run")
+)
+
+// importAliases 常见的表头写法，表头与字段中文名或字段名一致时无需列出
+var importAliases = map[string]string{
+	"车牌号":   "license_plate",
+	"车牌":    "license_plate",
+	"号牌号码":  "license_plate",
+	"车架号":   "vin",
+	"车辆识别码": "vin",
+	"发动机号":  "engine_number",
+	"手机号":   "phone",
+	"联系电话":  "phone",
+	"公司名称":  "company_id",
+	"所属公司":  "company_id",
+
+	// 导出表格的表头（已按 normalizeHeader 处理），导出的文件可直接导入
+	"车辆识别代码（vin）":       "vin",
+	"注册登记日期":            "register_date",
+	"车辆品牌型号":            "brand_model",
+	"排放标准":              "emission_standard",
+	"核定载质量（kg）":         "approved_load_mass",
+	"准牵引质量/kg":          "max_towing_mass",
+	"是否安装":              "is_obd_enabled",
+	"进厂运输量/吨":           "inbound_cargo_weight",
+	"出厂运输量/吨":           "outbound_cargo_weight",
+	"机械环保代码/产品识别码（pin）": "pin",
+	"发动机额定净功率/kw":       "engine_power",
+}
+
+// ImportService 台账批量导入：上传 XLSX 或 CSV 表格，确认列映射后校验（dry_run）或导入，
+// 校验规则与逐条新增相同，未通过的行写入错误报告；数据行较多时在后台执行，通过任务进度查询结果
+type ImportService struct {
+	repo    *repository.Repository
+	store   storage.Storage
+	events  *realtime.Hub
+	cfg     config.ImportConfig
+	workers chan struct{}
+}
+
+func NewImportService(repo *repository.Repository, cfg *config.Config, store storage.Storage, events *realtime.Hub) *ImportService {
+	return &ImportService{
+		repo:    repo,
+		store:   store,
+		events:  events,
+		cfg:     cfg.Import,
+		workers: make(chan struct{}, importWorkers),
+	}
+}
+
+// MaxSize 导入文件大小上限
+func (s *ImportService) MaxSize() int64 {
+	return s.cfg.MaxSize
+}
+
+// Upload 解析并保存导入文件，第一个非空行为表头；返回按表头推荐列映射的任务，确认映射后调用 Run 执行
+func (s *ImportService) Upload(ctx context.Context, parkID uint, dataType, fileName string, data []byte) (*model.ImportPreview, error) {
+	if _, ok := ledgerTables[dataType]; !ok {
+		return nil, fmt.Errorf("%w: 不支持的台账类型: %s", ErrInvalidImport, dataType)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: 请选择要导入的文件", ErrInvalidImport)
+	}
+	if int64(len(data)) > s.cfg.MaxSize {
+		return nil, fmt.Errorf("%w: 文件不能超过%dMB", ErrInvalidImport, s.cfg.MaxSize>>20)
+	}
+	if err := s.repo.DB.Select("id").First(&model.Park{}, parkID).Error; err != nil {
+		return nil, err
+	}
+
+	rows, err := s.readRows(data)
+	if err != nil {
+		return nil, err
+	}
+	header := headerRow(rows)
+	if header < 0 {
+		return nil, fmt.Errorf("%w: 表格中没有数据", ErrInvalidImport)
+	}
+	headers := rows[header]
+	seen := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		if h != "" && seen[h] {
+			return nil, fmt.Errorf("%w: 表头重复: %s", ErrInvalidImport, h)
+		}
+		seen[h] = true
+	}
+
+	var preview [][]string
+	total := 0
+	for _, row := range rows[header+1:] {
+		if len(row) == 0 {
+			continue
+		}
+		total++
+		if len(preview) < importPreviewRows {
+			preview = append(preview, row)
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: 表格中没有数据", ErrInvalidImport)
+	}
+
+	fields, _, err := s.fields(parkID, dataType)
+	if err != nil {
+		return nil, err
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	mappingJSON, err := json.Marshal(suggestMapping(fields, headers))
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.ImportJob{
+		ParkID:   parkID,
+		DataType: dataType,
+		FileName: fileName,
+		Headers:  headersJSON,
+		Mapping:  mappingJSON,
+		Status:   model.ImportStatusUploaded,
+		Total:    total,
+	}
+	if err := s.repo.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	ext, contentType := ".csv", "text/csv"
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		ext, contentType = ".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	job.SourceKey = importKey(job, "source"+ext)
+	if err := s.store.Put(ctx, job.SourceKey, data, contentType); err != nil {
+		s.repo.DB.Delete(job)
+		return nil, err
+	}
+	if err := s.repo.DB.Model(job).Update("source_key", job.SourceKey).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.ImportPreview{Job: job, Fields: fields, Rows: preview}, nil
+}
+
+// Get 查询导入任务，执行中的任务据此轮询进度
+func (s *ImportService) Get(id uint) (*model.ImportJob, error) {
+	var job model.ImportJob
+	if err := s.repo.DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	job.HasReport = job.ReportKey != ""
+	return &job, nil
+}
+
+// List 查询车场的导入任务，dataType 为空时返回全部类型，按创建时间倒序
+func (s *ImportService) List(parkID uint, dataType string, page, pageSize int) ([]model.ImportJob, int64, error) {
+	var jobs []model.ImportJob
+	var total int64
+
+	query := s.repo.DB.Model(&model.ImportJob{}).Where("park_id = ?", parkID)
+	if dataType != "" {
+		query = query.Where("data_type = ?", dataType)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	for i := range jobs {
+		jobs[i].HasReport = jobs[i].ReportKey != ""
+	}
+	return jobs, total, nil
+}
+
+// Run 按列映射执行导入任务：dry_run 时只校验并生成错误报告，否则导入校验通过的行
+// 数据行数不超过 sync_rows 时在请求内执行完毕后返回，否则在后台执行，返回执行中的任务
+func (s *ImportService) Run(id uint, req *model.ImportRunRequest) (*model.ImportJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == model.ImportStatusRunning || job.Status == model.ImportStatusCompleted {
+		return nil, fmt.Errorf("%w: 导入任务正在执行或已导入完成", ErrImportNotAllowed)
+	}
+
+	fields, rules, err := s.fields(job.ParkID, job.DataType)
+	if err != nil {
+		return nil, err
+	}
+	mapping := req.Mapping
+	if mapping == nil {
+		if err := json.Unmarshal(job.Mapping, &mapping); err != nil {
+			return nil, err
+		}
+	}
+	var headers []string
+	if err := json.Unmarshal(job.Headers, &headers); err != nil {
+		return nil, err
+	}
+	columns, err := resolveMapping(fields, headers, mapping)
+	if err != nil {
+		return nil, err
+	}
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按状态条件更新，同一任务不会被同时执行
+	previousReport := job.ReportKey
+	result := s.repo.DB.Model(&model.ImportJob{}).
+		Where("id = ? AND status IN ?", id, []string{model.ImportStatusUploaded, model.ImportStatusValidated, model.ImportStatusFailed}).
+		Updates(map[string]interface{}{
+			"status":      model.ImportStatusRunning,
+			"dry_run":     req.DryRun,
+			"mapping":     string(mappingJSON),
+			"processed":   0,
+			"succeeded":   0,
+			"failed":      0,
+			"report_key":  "",
+			"error":       "",
+			"started_at":  time.Now(),
+			"finished_at": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: 导入任务正在执行或已导入完成", ErrImportNotAllowed)
+	}
+	if previousReport != "" {
+		if err := s.store.Delete(context.Background(), previousReport); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete import report %s: %v", previousReport, err)
+		}
+	}
+	if job, err = s.Get(id); err != nil {
+		return nil, err
+	}
+
+	run := &importRun{job: job, fields: fields, rules: rules, columns: columns}
+	if job.Total <= s.cfg.SyncRows {
+		s.execute(run)
+		return s.Get(id)
+	}
+	go func() {
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+		s.execute(run)
+	}()
+	return job, nil
+}
+
+// Report 读取导入任务的错误报告（CSV），使用完毕须关闭 Body；没有错误报告时返回 storage.ErrNotFound
+func (s *ImportService) Report(ctx context.Context, id uint) (*model.ImportJob, *storage.Object, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.ReportKey == "" {
+		return nil, nil, storage.ErrNotFound
+	}
+	object, err := s.store.Get(ctx, job.ReportKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, object, nil
+}
+
+// RecoverJobs 将服务停止时仍在执行的导入任务标记为失败，返回任务数；已提交的批次保留，重新执行时按车牌号码跳过
+func (s *ImportService) RecoverJobs() (int, error) {
+	result := s.repo.DB.Model(&model.ImportJob{}).
+		Where("status = ?", model.ImportStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      model.ImportStatusFailed,
+			"error":       "服务重启，导入中断，可重新执行",
+			"finished_at": time.Now(),
+		})
+	return int(result.RowsAffected), result.Error
+}
+
+// readRows 读取表格，解析错误转换为 ErrInvalidImport
+func (s *ImportService) readRows(data []byte) ([][]string, error) {
+	// 行数上限不含表头
+	rows, err := spreadsheet.Read(data, s.cfg.MaxRows+1)
+	switch {
+	case errors.Is(err, spreadsheet.ErrUnsupported):
+		return nil, fmt.Errorf("%w: 只支持 XLSX 和 CSV 文件，Excel 97-2003 工作簿请另存为 .xlsx", ErrInvalidImport)
+	case errors.Is(err, spreadsheet.ErrTooManyRows):
+		return nil, fmt.Errorf("%w: 单次最多导入%d行", ErrInvalidImport, s.cfg.MaxRows)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	return rows, nil
+}
+
+// fields 读取车场字段配置，返回可映射的字段和校验规则
+func (s *ImportService) fields(parkID uint, dataType string) ([]model.ImportField, validation.Rules, error) {
+	config, err := loadFieldsConfig(s.repo, parkID, dataType)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := validation.RulesFromConfig(dataType, config)
+	defaults, err := validation.DefaultFieldsConfig(dataType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fields []model.ImportField
+	for _, f := range defaults.Fields {
+		rule := rules[f.Key]
+		if !rule.Visible || validation.IsAttachment(dataType, f.Key) {
+			continue
+		}
+		fields = append(fields, model.ImportField{Key: f.Key, Label: f.Label, Required: rule.Required})
+	}
+	return fields, rules, nil
+}
+
+// execute 执行导入并保存结果，出错时任务标记为失败
+func (s *ImportService) execute(run *importRun) {
+	job := run.job
+	updates := map[string]interface{}{"finished_at": time.Now()}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import job %d panicked: %v", job.ID, r)
+			updates["status"] = model.ImportStatusFailed
+			updates["error"] = "导入出错，请重新执行"
+		}
+		if err := s.repo.DB.Model(&model.ImportJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update import job %d: %v", job.ID, err)
+		}
+	}()
+
+	err := s.process(run)
+	if err == nil && len(run.report) > 0 {
+		key := importKey(job, "report.csv")
+		if err = s.store.Put(context.Background(), key, run.reportCSV(), "text/csv"); err == nil {
+			updates["report_key"] = key
+		}
+	}
+
+	updates["processed"] = run.processed
+	updates["succeeded"] = run.succeeded
+	updates["failed"] = run.failed
+	updates["finished_at"] = time.Now()
+	switch {
+	case err != nil:
+		log.Printf("Import job %d failed: %v", job.ID, err)
+		updates["status"] = model.ImportStatusFailed
+		updates["error"] = truncate(err.Error(), 500)
+	case job.DryRun:
+		updates["status"] = model.ImportStatusValidated
+	default:
+		updates["status"] = model.ImportStatusCompleted
+	}
+}
+
+// process 逐批校验并导入，每批更新一次进度
+func (s *ImportService) process(run *importRun) error {
+	job := run.job
+	object, err := s.store.Get(context.Background(), job.SourceKey)
+	if err != nil {
+		return err
+	}
+	data, err := readAll(object)
+	if err != nil {
+		return err
+	}
+	rows, err := s.readRows(data)
+	if err != nil {
+		return err
+	}
+	header := headerRow(rows)
+	if header < 0 {
+		return fmt.Errorf("%w: 表格中没有数据", ErrInvalidImport)
+	}
+	run.headers = rows[header]
+
+	if _, ok := run.columns["company_id"]; ok {
+		if err := run.loadCompanies(s.repo.DB); err != nil {
+			return err
+		}
+	}
+	if !job.DryRun && job.DataType != model.QRCodeTypeExternalVehicle {
+		if run.dispatch, err = autoDispatchEnabled(s.repo, job.ParkID, job.DataType); err != nil {
+			return err
+		}
+	}
+	run.seen = make(map[string]int)
+
+	flush := func(batch []importRow) error {
+		if err := s.processBatch(run, batch); err != nil {
+			return err
+		}
+		return s.repo.DB.Model(&model.ImportJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"processed": run.processed,
+			"succeeded": run.succeeded,
+			"failed":    run.failed,
+		}).Error
+	}
+	var batch []importRow
+	for i := header + 1; i < len(rows); i++ {
+		if len(rows[i]) == 0 {
+			continue
+		}
+		batch = append(batch, importRow{number: i + 1, cells: rows[i]})
+		if len(batch) == importBatchSize {
+			if err := flush(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		return flush(batch)
+	}
+	return nil
+}
+
+// processBatch 校验一批数据行，导入时在同一事务内写入校验通过的记录，与逐条新增一样写入同步变更日志并按车场设置自动下发
+func (s *ImportService) processBatch(run *importRun, batch []importRow) error {
+	job := run.job
+	records := make([]model.Ledger, len(batch))
+	messages := make([]string, len(batch))
+	var plates []string
+	for i, row := range batch {
+		records[i], messages[i] = run.record(row)
+		if messages[i] != "" {
+			continue
+		}
+		plate := ledgerPlate(records[i])
+		if plate == "" {
+			continue
+		}
+		if first, dup := run.seen[plate]; dup {
+			messages[i] = fmt.Sprintf("车牌号码与第%d行重复", first)
+			continue
+		}
+		run.seen[plate] = row.number
+		plates = append(plates, plate)
+	}
+
+	// 已登记的车辆不重复导入，中断的任务重新执行时据此跳过已导入的行
+	if len(plates) > 0 {
+		var existing []string
+		err := s.repo.DB.Table(ledgerTables[job.DataType]).
+			Where("park_id = ? AND license_plate IN ?", job.ParkID, plates).
+			Pluck("license_plate", &existing).Error
+		if err != nil {
+			return err
+		}
+		registered := make(map[string]bool, len(existing))
+		for _, plate := range existing {
+			registered[plate] = true
+		}
+		for i := range batch {
+			if messages[i] == "" && registered[ledgerPlate(records[i])] {
+				messages[i] = "车牌号码已登记"
+			}
+		}
+	}
+
+	var valid []model.Ledger
+	for i := range batch {
+		if messages[i] == "" {
+			valid = append(valid, records[i])
+		}
+	}
+	if len(valid) > 0 && !job.DryRun {
+		var queued map[uint][]uint
+		err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			ids := make([]uint, 0, len(valid))
+			for _, record := range valid {
+				if err := createLedgerTx(tx, job.DataType, record); err != nil {
+					return err
+				}
+				ids = append(ids, record.GetLedgerMeta().ID)
+			}
+			if !run.dispatch {
+				return nil
+			}
+			var err error
+			queued, err = enqueueDispatch(tx, job.DataType, ids...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		notifyDispatch(s.events, job.DataType, queued)
+	}
+
+	for i, row := range batch {
+		run.processed++
+		if messages[i] == "" {
+			run.succeeded++
+			continue
+		}
+		run.failed++
+		run.report = append(run.report, importFailure{importRow: row, message: messages[i]})
+	}
+	return nil
+}
+
+// importRow 表格中的一个数据行，number 为表格中的行号
+type importRow struct {
+	number int
+	cells  []string
+}
+
+// importFailure 未通过校验的数据行
+type importFailure struct {
+	importRow
+	message string
+}
+
+// importRun 一次导入任务的执行状态
+type importRun struct {
+	job       *model.ImportJob
+	fields    []model.ImportField
+	rules     validation.Rules
+	columns   map[string]int // 字段 → 列序号
+	headers   []string
+	dispatch  bool            // 导入后是否自动下发
+	companies map[string]uint // 公司名称 → ID，多个公司同名时为 0
+	seen      map[string]int  // 车牌号码 → 首次出现的行号
+
+	processed, succeeded, failed int
+	report                       []importFailure
+}
+
+// loadCompanies 读取公司名称，公司列按名称匹配
+func (r *importRun) loadCompanies(db *gorm.DB) error {
+	var companies []model.Company
+	if err := db.Select("id, name").Find(&companies).Error; err != nil {
+		return err
+	}
+	r.companies = companiesByName(companies)
+	return nil
+}
+
+// companiesByName 按名称索引公司，同名的公司无法按名称区分，ID 记为 0
+func companiesByName(companies []model.Company) map[string]uint {
+	byName := make(map[string]uint, len(companies))
+	for _, c := range companies {
+		name := strings.TrimSpace(c.Name)
+		if _, dup := byName[name]; dup {
+			byName[name] = 0
+			continue
+		}
+		byName[name] = c.ID
+	}
+	return byName
+}
+
+// record 将数据行转换为台账记录并校验，返回未通过校验的原因
+func (r *importRun) record(row importRow) (model.Ledger, string) {
+	record, err := newLedger(r.job.DataType)
+	if err != nil {
+		return nil, err.Error()
+	}
+	record.SetLedgerMeta(model.LedgerMeta{ParkID: r.job.ParkID})
+	if vehicle, ok := record.(*model.ExternalVehicle); ok {
+		// 与管理端新增一致，导入的车辆待审核
+		vehicle.AuditStatus = model.AuditStatusPending
+	}
+
+	var errs validation.Errors
+	invalid := make(map[string]bool)
+	for _, f := range r.fields {
+		col, ok := r.columns[f.Key]
+		if !ok || col >= len(row.cells) || row.cells[col] == "" {
+			continue
+		}
+		if err := r.setField(record, f.Key, row.cells[col]); err != nil {
+			errs = append(errs, validation.FieldError{Field: f.Key, Label: f.Label, Message: f.Label + "：" + err.Error()})
+			invalid[f.Key] = true
+		}
+	}
+
+	// 已报告格式错误的字段不再报告为空
+	err = checkLedger(record, r.rules)
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			if !invalid[fe.Field] {
+				errs = append(errs, fe)
+			}
+		}
+	} else if err != nil {
+		errs = append(errs, validation.FieldError{Field: "license_plate", Label: "车牌号码", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		return record, errs.Error()
+	}
+	return record, ""
+}
+
+// importDatePattern 表格中常见的日期写法：2020-01-02、2020/1/2、2020.1.2、2020年1月2日
+var importDatePattern = regexp.MustCompile(`^(\d{4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,2})\s*日?$`)
+
+// setField 按字段类型转换单元格文本后设置记录字段
+func (r *importRun) setField(record model.Ledger, key, text string) error {
+	if key == "company_id" {
+		id, ok := r.companies[text]
+		if !ok {
+			return fmt.Errorf("公司不存在: %s", text)
+		}
+		if id == 0 {
+			return fmt.Errorf("存在多个名为 %s 的公司，请先修改公司名称", text)
+		}
+		return setLedgerField(record, key, &id)
+	}
+	if strings.HasSuffix(key, "_date") {
+		if m := importDatePattern.FindStringSubmatch(text); m != nil {
+			month, _ := strconv.Atoi(m[2])
+			day, _ := strconv.Atoi(m[3])
+			text = fmt.Sprintf("%s-%02d-%02d", m[1], month, day)
+		}
+	}
+
+	switch ledgerFieldType(record, key) {
+	case reflect.TypeOf(""):
+		return setLedgerField(record, key, text)
+	case reflect.TypeOf((*float64)(nil)):
+		f, err := strconv.ParseFloat(strings.ReplaceAll(text, ",", ""), 64)
+		if err != nil {
+			return fmt.Errorf("须为数字")
+		}
+		return setLedgerField(record, key, &f)
+	case reflect.TypeOf(false):
+		switch strings.ToLower(text) {
+		case "是", "有", "true", "yes", "y", "1":
+			return setLedgerField(record, key, true)
+		case "否", "无", "false", "no", "n", "0":
+			return setLedgerField(record, key, false)
+		}
+		return fmt.Errorf("须为“是”或“否”")
+	}
+	return fmt.Errorf("不支持导入该字段")
+}
+
+// reportCSV 生成错误报告：行号、原表格各列和错误原因，修改后可直接重新导入
+func (r *importRun) reportCSV() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF") // Excel 据此按 UTF-8 打开
+	w := csv.NewWriter(&buf)
+	w.UseCRLF = true
+	_ = w.Write(append(append([]string{"行号"}, r.headers...), "错误原因"))
+	for _, failure := range r.report {
+		record := make([]string, len(r.headers)+2)
+		record[0] = strconv.Itoa(failure.number)
+		copy(record[1:len(r.headers)+1], failure.cells)
+		record[len(record)-1] = failure.message
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// ledgerFieldType 按 JSON 字段名返回台账记录字段的类型，不存在时返回 nil
+func ledgerFieldType(record model.Ledger, key string) reflect.Type {
+	if field, ok := ledgerField(record, key); ok {
+		return field.Type()
+	}
+	return nil
+}
+
+// setLedgerField 按 JSON 字段名设置台账记录字段
+func setLedgerField(record model.Ledger, key string, value interface{}) error {
+	field, ok := ledgerField(record, key)
+	if !ok {
+		return fmt.Errorf("不支持导入该字段")
+	}
+	field.Set(reflect.ValueOf(value))
+	return nil
+}
+
+func ledgerField(record model.Ledger, key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(record).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// ledgerPlate 返回台账记录的车牌号码
+func ledgerPlate(record model.Ledger) string {
+	switch r := record.(type) {
+	case *model.ExternalVehicle:
+		return r.LicensePlate
+	case *model.InternalVehicle:
+		return r.LicensePlate
+	case *model.NonRoadMachinery:
+		return r.LicensePlate
+	}
+	return ""
+}
+
+// headerRow 返回第一个非空行（表头）的序号，没有数据时返回 -1
+func headerRow(rows [][]string) int {
+	for i, row := range rows {
+		if len(row) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// suggestMapping 按字段中文名、字段名和常见写法匹配表头，返回字段到表头的映射
+func suggestMapping(fields []model.ImportField, headers []string) map[string]string {
+	byName := make(map[string]string, len(fields)*2)
+	for _, f := range fields {
+		byName[normalizeHeader(f.Label)] = f.Key
+		byName[normalizeHeader(f.Key)] = f.Key
+	}
+	for alias, key := range importAliases {
+		if _, ok := byName[alias]; !ok {
+			byName[alias] = key
+		}
+	}
+	available := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		available[f.Key] = true
+	}
+
+	mapping := make(map[string]string)
+	for _, h := range headers {
+		key, ok := byName[normalizeHeader(h)]
+		if !ok || !available[key] {
+			continue
+		}
+		if _, mapped := mapping[key]; !mapped {
+			mapping[key] = h
+		}
+	}
+	return mapping
+}
+
+// normalizeHeader 去除表头中的空白和必填标记“*”，括号统一为全角
+func normalizeHeader(h string) string {
+	h = strings.NewReplacer(" ", "", "　", "", "*", "", "(", "（", ")", "）").Replace(h)
+	return strings.ToLower(h)
+}
+
+// resolveMapping 校验列映射，返回字段到列序号的映射；表头为空的字段不导入，必填字段须映射
+func resolveMapping(fields []model.ImportField, headers []string, mapping map[string]string) (map[string]int, error) {
+	byKey := make(map[string]model.ImportField, len(fields))
+	for _, f := range fields {
+		byKey[f.Key] = f
+	}
+	index := make(map[string]int, len(headers))
+	for i, h := range headers {
+		if h != "" {
+			index[h] = i
+		}
+	}
+
+	columns := make(map[string]int, len(mapping))
+	for key, header := range mapping {
+		if header == "" {
+			continue
+		}
+		if _, ok := byKey[key]; !ok {
+			return nil, fmt.Errorf("%w: 不支持导入的字段: %s", ErrInvalidImport, key)
+		}
+		col, ok := index[header]
+		if !ok {
+			return nil, fmt.Errorf("%w: 表头不存在: %s", ErrInvalidImport, header)
+		}
+		columns[key] = col
+	}
+
+	var missing []string
+	for _, f := range fields {
+		if _, ok := columns[f.Key]; f.Required && !ok {
+			missing = append(missing, f.Label)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: 必填字段未映射: %s", ErrInvalidImport, strings.Join(missing, "、"))
+	}
+	return columns, nil
+}
+
+// importKey 返回导入任务文件的对象键
+func importKey(job *model.ImportJob, name string) string {
+	return storage.ParkKey(job.ParkID, fmt.Sprintf("imports/%d/%s", job.ID, name))
+}
+
+func readAll(object *storage.Object) ([]byte, error) {
+	defer object.Body.Close()
+	var buf bytes.Buffer
+	if object.Size > 0 {
+		buf.Grow(int(object.Size))
+	}
+	_, err := buf.ReadFrom(object.Body)
+	return buf.Bytes(), err
+}
+
+// truncate 按字符截断文本
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"taizhang-server/internal/model"
+)
+
+func TestImportCompanyColumn(t *testing.T) {
+	r := &importRun{
+		job: &model.ImportJob{DataType: model.QRCodeTypeExternalVehicle, ParkID: 1},
+		companies: companiesByName([]model.Company{
+			{ID: 1, Name: "北京示例物流"},
+			{ID: 2, Name: " 天津运输 "},
+			{ID: 3, Name: "天津运输"},
+			{ID: 4, Name: "河北货运"},
+		}),
+	}
+
+	vehicle := &model.ExternalVehicle{}
+	if err := r.setField(vehicle, "company_id", "北京示例物流"); err != nil {
+		t.Fatal(err)
+	}
+	if vehicle.CompanyID == nil || *vehicle.CompanyID != 1 {
+		t.Errorf("company id = %v, want 1", vehicle.CompanyID)
+	}
+
+	// 同名的公司无法确定，报告为该行的错误而不是任选一个
+	vehicle = &model.ExternalVehicle{}
+	err := r.setField(vehicle, "company_id", "天津运输")
+	if err == nil || !strings.Contains(err.Error(), "多个") || vehicle.CompanyID != nil {
+		t.Errorf("duplicate name: err = %v, company id = %v", err, vehicle.CompanyID)
+	}
+
+	if err := r.setField(&model.ExternalVehicle{}, "company_id", "上海物流"); err == nil {
+		t.Error("unknown company: want error")
+	}
+}
@@ -2,22 +2,39 @@ package service
 
 import (
 	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
-	"time"
+
+	"gorm.io/gorm"
 )
 
 type InternalVehicleService struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	files  *FileService
+	events *realtime.Hub
 }
 
-func NewInternalVehicleService(repo *repository.Repository) *InternalVehicleService {
+func NewInternalVehicleService(repo *repository.Repository, files *FileService, events *realtime.Hub) *InternalVehicleService {
 	return &InternalVehicleService{
-		repo: repo,
+		repo:   repo,
+		files:  files,
+		events: events,
 	}
 }
 
 func (s *InternalVehicleService) Create(vehicle *model.InternalVehicle) error {
-	return s.repo.DB.Create(vehicle).Error
+	keepServerFields(vehicle, nil)
+	if err := validateInternalVehicle(s.repo, vehicle, nil); err != nil {
+		return err
+	}
+	if err := checkLedgerAttachments(s.files, model.QRCodeTypeInternalVehicle, vehicle, nil); err != nil {
+		return err
+	}
+	dispatch, err := autoDispatchEnabled(s.repo, vehicle.ParkID, model.QRCodeTypeInternalVehicle)
+	if err != nil {
+		return err
+	}
+	return storeLedger(s.repo, s.events, model.QRCodeTypeInternalVehicle, vehicle, createLedgerTx, dispatch)
 }
 
 func (s *InternalVehicleService) GetByID(id uint) (*model.InternalVehicle, error) {
@@ -26,6 +43,7 @@ func (s *InternalVehicleService) GetByID(id uint) (*model.InternalVehicle, error
 	if err != nil {
 		return nil, err
 	}
+	vehicle.PhotoURLs = s.files.PhotoURLs(vehicle.ParkID, vehicle.Attachments, false)
 	return &vehicle, nil
 }
 
@@ -33,6 +51,27 @@ func (s *InternalVehicleService) List(parkID uint, licensePlate, dispatchStatus,
 	var vehicles []model.InternalVehicle
 	var total int64
 
+	query := s.filter(parkID, licensePlate, dispatchStatus, emissionStandard)
+
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err = query.Offset(offset).Limit(pageSize).Find(&vehicles).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range vehicles {
+		vehicles[i].PhotoURLs = s.files.PhotoURLs(parkID, vehicles[i].Attachments, true)
+	}
+
+	return vehicles, total, nil
+}
+
+// filter 按列表条件筛选车场的车辆，列表与导出共用
+func (s *InternalVehicleService) filter(parkID uint, licensePlate, dispatchStatus, emissionStandard string) *gorm.DB {
 	query := s.repo.DB.Model(&model.InternalVehicle{}).Where("park_id = ?", parkID)
 
 	if licensePlate != "" {
@@ -44,43 +83,44 @@ func (s *InternalVehicleService) List(parkID uint, licensePlate, dispatchStatus,
 	if emissionStandard != "" {
 		query = query.Where("emission_standard = ?", emissionStandard)
 	}
+	return query
+}
 
-	err := query.Count(&total).Error
+func (s *InternalVehicleService) Update(vehicle *model.InternalVehicle) error {
+	existing, err := s.GetByID(vehicle.ID)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
+	vehicle.ParkID = existing.ParkID
+	keepServerFields(vehicle, existing)
 
-	offset := (page - 1) * pageSize
-	err = query.Offset(offset).Limit(pageSize).Find(&vehicles).Error
-	if err != nil {
-		return nil, 0, err
+	if err := validateInternalVehicle(s.repo, vehicle, existing); err != nil {
+		return err
 	}
+	if err := checkLedgerAttachments(s.files, model.QRCodeTypeInternalVehicle, vehicle, existing); err != nil {
+		return err
+	}
+	vehicle.Version = existing.Version + 1
 
-	return vehicles, total, nil
-}
-
-func (s *InternalVehicleService) Update(vehicle *model.InternalVehicle) error {
-	return s.repo.DB.Save(vehicle).Error
+	// 已下发的记录修改后重新下发，插件据此更新本地数据
+	dispatch := existing.DispatchStatus == model.DispatchStatusDispatched
+	if !dispatch {
+		if dispatch, err = autoDispatchEnabled(s.repo, vehicle.ParkID, model.QRCodeTypeInternalVehicle); err != nil {
+			return err
+		}
+	}
+	return storeLedger(s.repo, s.events, model.QRCodeTypeInternalVehicle, vehicle, saveLedgerTx, dispatch)
 }
 
 func (s *InternalVehicleService) Delete(id uint) error {
-	return s.repo.DB.Delete(&model.InternalVehicle{}, id).Error
+	return deleteLedger(s.repo, s.events, model.QRCodeTypeInternalVehicle, &model.InternalVehicle{}, id)
 }
 
 func (s *InternalVehicleService) Dispatch(id uint) error {
-	now := time.Now()
-	return s.repo.DB.Model(&model.InternalVehicle{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"dispatch_status": "dispatched",
-		"dispatch_time":   &now,
-	}).Error
+	return dispatchLedgers(s.repo, s.events, model.QRCodeTypeInternalVehicle, []uint{id})
 }
 
-func (s *InternalVehicleService) BatchDispatch(ids []uint) error {
-	now := time.Now()
-	return s.repo.DB.Model(&model.InternalVehicle{}).
-		Where("id IN ?", ids).
-		Updates(map[string]interface{}{
-			"dispatch_status": "dispatched",
-			"dispatch_time":   &now,
-		}).Error
+// BatchDispatch 批量下发，逐条返回结果
+func (s *InternalVehicleService) BatchDispatch(req *model.BatchRequest) (*model.BatchResult, error) {
+	return batchDispatch(s.repo, s.events, model.QRCodeTypeInternalVehicle, req, nil)
 }
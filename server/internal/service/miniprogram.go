@@ -1,43 +1,54 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"regexp"
+	"log"
+	"net/url"
 	"strings"
 	"time"
 
 	"taizhang-server/internal/config"
 	"taizhang-server/internal/model"
 	"taizhang-server/internal/repository"
+	"taizhang-server/internal/thirdparty"
+
+	"gorm.io/gorm"
 )
 
 type MiniProgramService struct {
-	repo *repository.Repository
-	cfg  *config.Config
+	repo  *repository.Repository
+	cfg   *config.Config
+	audit *AuditService
+	ocr   OCRProvider // 未配置证照识别时为 nil
+
+	vehicleLists *thirdparty.Client
+	files        *FileService
 }
 
-func NewMiniProgramService(repo *repository.Repository, cfg *config.Config) *MiniProgramService {
+func NewMiniProgramService(repo *repository.Repository, cfg *config.Config, audit *AuditService, ocr OCRProvider, vehicleLists *thirdparty.Client, files *FileService) *MiniProgramService {
 	return &MiniProgramService{
-		repo: repo,
-		cfg:  cfg,
+		repo:         repo,
+		cfg:          cfg,
+		audit:        audit,
+		ocr:          ocr,
+		vehicleLists: vehicleLists,
+		files:        files,
 	}
 }
 
 // Scan 扫码处理
-func (s *MiniProgramService) Scan(qrcode string) (*model.ScanResult, error) {
-	// 解析二维码获取车场ID
-	parkID, err := s.parseQRCode(qrcode)
+func (s *MiniProgramService) Scan(content, clientIP string) (*model.ScanResult, error) {
+	// 根据二维码内容令牌定位车场和二维码类型
+	qrcode, warning, err := s.resolveQRCode(content, clientIP)
 	if err != nil {
 		return nil, err
 	}
 
 	// 检查车场有效期
 	var park model.Park
-	err = s.repo.DB.First(&park, parkID).Error
+	err = s.repo.DB.First(&park, qrcode.ParkID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +59,7 @@ func (s *MiniProgramService) Scan(qrcode string) (*model.ScanResult, error) {
 	}
 
 	// 检查是否启用公司管理
-	companyEnabled := s.isCompanyEnabled(parkID)
+	companyEnabled := s.isCompanyEnabled(park.ID, qrcode.Type)
 
 	// 获取公司列表
 	var companies []model.Company
@@ -60,239 +71,189 @@ func (s *MiniProgramService) Scan(qrcode string) (*model.ScanResult, error) {
 		}
 	}
 
+	uploadToken, uploadTokenExpiresAt := s.files.IssueUploadToken(qrcode)
 	return &model.ScanResult{
-		ParkID:         parkID,
-		ParkName:       park.Name,
-		CompanyEnabled: companyEnabled,
-		Companies:      companies,
+		ParkID:               park.ID,
+		ParkName:             park.Name,
+		QRCodeType:           qrcode.Type,
+		CompanyEnabled:       companyEnabled,
+		Companies:            companies,
+		Warning:              warning,
+		UploadToken:          uploadToken,
+		UploadTokenExpiresAt: uploadTokenExpiresAt,
 	}, nil
 }
 
-// GetCarData 获取第三方随车清单数据
-func (s *MiniProgramService) GetCarData(plate, vin, engineNumber, vehicleType string) (*model.ThirdPartyVehicleData, error) {
-	url := fmt.Sprintf("%s/get_car_data", s.cfg.ThirdParty.BaseURL)
-
-	reqBody := map[string]interface{}{
-		"park_id":     s.cfg.ThirdParty.ParkID,
-		"car_number":  plate,
-		"vin":         vin,
-		"motor":       engineNumber,
-		"VehicleType": vehicleType,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+// GetCarData 获取第三方随车清单数据，随车清单图片返回转存后的对象键及限时下载地址
+func (s *MiniProgramService) GetCarData(ctx context.Context, plate, vin, engineNumber, vehicleType string) (*model.ThirdPartyVehicleData, error) {
+	data, err := s.vehicleLists.Lookup(ctx, thirdparty.Query{Plate: plate, VIN: vin, EngineNumber: engineNumber, VehicleType: vehicleType})
 	if err != nil {
 		return nil, err
 	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	// 随车清单图片为共享文件，不限定车场
+	data.VehicleListURL, err = s.files.SignURL(0, data.VehicleListPhoto)
 	if err != nil {
 		return nil, err
 	}
-
-	var result struct {
-		State int `json:"state"`
-		Data  struct {
-			OSS          string `json:"oss"`
-			PFJD         string `json:"pfjd"` // 排放阶段
-			VIN          string `json:"vin"`
-			Type         int    `json:"type"`
-			MotorCompany string `json:"motor_company"` // 发动机生产厂
-			MotorXH      string `json:"motor_xh"`      // 发动机型号
-			CPYS         string `json:"cpys"`          // 车牌颜色
-			RLLX         string `json:"rllx"`          // 燃油类型
-		} `json:"data"`
-		Errmsg string `json:"errmsg"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	if result.State != 1 {
-		return nil, fmt.Errorf(result.Errmsg)
-	}
-
-	return &model.ThirdPartyVehicleData{
-		OSSURL:             result.Data.OSS,
-		EmissionStandard:   result.Data.PFJD,
-		VIN:                result.Data.VIN,
-		EngineManufacturer: result.Data.MotorCompany,
-		EngineModel:        result.Data.MotorXH,
-		PlateColor:         result.Data.CPYS,
-		FuelType:           result.Data.RLLX,
-	}, nil
+	return data, nil
 }
 
 // 辅助函数
-func (s *MiniProgramService) parseQRCode(qrcode string) (uint, error) {
-	// 解析二维码获取车场ID
-	// 这里需要根据实际的二维码格式进行解析
-	// 示例: qrcode = "park:12345"
-	var parkID uint
-	_, err := fmt.Sscanf(qrcode, "park:%d", &parkID)
-	if err != nil {
-		return 0, fmt.Errorf("invalid qrcode format")
+// resolveQRCode 根据扫码内容查找当前有效的二维码
+// 内容可以是二维码令牌本身，也可以是携带 qrcode 参数的小程序链接
+// 宽限期内的旧令牌按对应车场和类型的当前二维码处理，并返回提示信息
+func (s *MiniProgramService) resolveQRCode(content, clientIP string) (*model.QRCode, string, error) {
+	token := strings.TrimSpace(content)
+	if u, err := url.Parse(token); err == nil && u.Query().Get("qrcode") != "" {
+		token = u.Query().Get("qrcode")
 	}
-	return parkID, nil
-}
-
-func (s *MiniProgramService) isCompanyEnabled(parkID uint) bool {
-	// 检查车场是否启用公司管理
-	// 这里需要根据实际业务逻辑实现
-	// 示例: 检查车场配置
-	return false
-}
-
-// SubmitVehicle 提交车辆信息
-func (s *MiniProgramService) SubmitVehicle(vehicle *model.ExternalVehicle) error {
-	// 校验车牌
-	if err := s.validateLicensePlate(vehicle.LicensePlate); err != nil {
-		return err
+	if token == "" {
+		return nil, "", fmt.Errorf("invalid qrcode format")
 	}
 
-	// 确定车牌颜色
-	vehicle.PlateColor = s.determinePlateColor(vehicle.LicensePlate, vehicle.VehicleType)
-
-	// 校验VIN
-	if err := s.validateVIN(vehicle.VIN); err != nil {
-		return err
+	var qrcode model.QRCode
+	err := s.repo.DB.Where("content = ?", token).First(&qrcode).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.resolveRevokedQRCode(token, clientIP)
 	}
-
-	// 校验车辆类型
-	if err := s.validateVehicleType(vehicle.VehicleType); err != nil {
-		return err
-	}
-
-	// 校验日期
-	if err := s.validateDate(vehicle.RegisterDate); err != nil {
-		return err
-	}
-	if err := s.validateDate(vehicle.IssueDate); err != nil {
-		return err
+	if err != nil {
+		return nil, "", err
 	}
 
-	// 校验必填字段
-	if err := s.validateRequiredFields(vehicle); err != nil {
-		return err
+	if !qrcode.IsEnabled {
+		return nil, "", fmt.Errorf("二维码已停用")
 	}
-
-	return s.repo.DB.Create(vehicle).Error
+	return &qrcode, "", nil
 }
 
-// 辅助函数
-func (s *MiniProgramService) validateLicensePlate(plate string) error {
-	// 校验车牌位数在7位、8位且第二位字符必须是A-Z的字母
-	if len(plate) != 7 && len(plate) != 8 {
-		return fmt.Errorf("车牌号码位数不正确")
+// resolveRevokedQRCode 处理已更换的旧令牌：记录扫码，宽限期内仍可使用
+func (s *MiniProgramService) resolveRevokedQRCode(token, clientIP string) (*model.QRCode, string, error) {
+	var history model.QRCodeHistory
+	err := s.repo.DB.Where("content = ? AND revoked_at IS NOT NULL", token).First(&history).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", fmt.Errorf("二维码已失效，请扫描车场最新二维码")
 	}
-
-	// 第二位字符必须是A-Z的字母
-	if len(plate) < 2 || !isLetter(plate[1]) {
-		return fmt.Errorf("车牌号码格式不正确，第二位必须是A-Z的字母")
+	if err != nil {
+		return nil, "", err
 	}
 
-	return nil
-}
-
-func (s *MiniProgramService) determinePlateColor(plate string, vehicleType string) string {
-	plateLen := len(plate)
+	grace := s.cfg.QRCode.GracePeriod
+	accepted := grace > 0 && time.Since(*history.RevokedAt) < grace
 
-	// 4.1 ocr车牌号码位数=8且第8位字符=A-Z，则车牌颜色=新能源绿黄牌
-	if plateLen == 8 && isLetter(plate[7]) {
-		return "新能源绿黄牌"
+	// 记录旧二维码的扫码，便于车场找出仍在张贴的旧海报
+	scanLog := &model.QRCodeScanLog{
+		HistoryID: history.ID,
+		ParkID:    history.ParkID,
+		Type:      history.Type,
+		Content:   history.Content,
+		Accepted:  accepted,
+		ClientIP:  clientIP,
 	}
-
-	// 4.2 ocr车牌号码位数=8且第8位字符=0-9，则车牌颜色=新能源绿牌
-	if plateLen == 8 && isDigit(plate[7]) {
-		return "新能源绿牌"
+	if err := s.repo.DB.Create(scanLog).Error; err != nil {
+		log.Printf("Failed to log scan of revoked qrcode %d: %v", history.ID, err)
 	}
 
-	// 4.3 ocr车牌号码位数=7，且车辆类型包含：重型、中型，车牌颜色=黄牌
-	if plateLen == 7 && (contains(vehicleType, "重型") || contains(vehicleType, "中型")) {
-		return "黄牌"
+	if !accepted {
+		return nil, "", fmt.Errorf("二维码已更换，请扫描车场最新二维码")
 	}
 
-	// 4.4 ocr车牌号码位数=7，且车辆类型包含：轻型，车牌颜色=蓝牌
-	if plateLen == 7 && contains(vehicleType, "轻型") {
-		return "蓝牌"
+	var qrcode model.QRCode
+	if err := s.repo.DB.First(&qrcode, history.QRCodeID).Error; err != nil {
+		return nil, "", err
 	}
-
-	// 4.5 else 车牌颜色=蓝牌
-	return "蓝牌"
-}
-
-func (s *MiniProgramService) validateVIN(vin string) error {
-	if len(vin) != 17 {
-		return fmt.Errorf("车辆识别代号必须是17位")
+	if !qrcode.IsEnabled {
+		return nil, "", fmt.Errorf("二维码已停用")
 	}
-	return nil
+	return &qrcode, "该二维码已更换，请尽快扫描车场张贴的最新二维码", nil
 }
 
-func (s *MiniProgramService) validateVehicleType(vehicleType string) error {
-	// 车辆类型最后一位字符必须是"车"
-	if len(vehicleType) == 0 || vehicleType[len(vehicleType)-1:] != "车" {
-		return fmt.Errorf("车辆类型错误，最后一位必须是'车'")
+func (s *MiniProgramService) isCompanyEnabled(parkID uint, qrcodeType string) bool {
+	// 检查车场是否在该类型二维码的字段配置中启用公司管理
+	config, err := loadFieldsConfig(s.repo, parkID, qrcodeType)
+	if err != nil {
+		return false
 	}
-	return nil
+	feature, _ := config.Feature(model.FeatureCompany)
+	return feature.Enabled
 }
 
-func (s *MiniProgramService) validateDate(dateStr string) error {
-	// 校验格式YYYY-MM-DD
-	matched, err := regexp.MatchString(`^\d{4}-\d{2}-\d{2}$`, dateStr)
-	if err != nil {
+// SubmitVehicle 提交车辆信息
+// 同一车场已被驳回的同车牌车辆视为重新提交：更新原记录并转为重新提交状态，审核记录保留在原车辆下
+// 携带证照识别记录时，对照识别结果记录各字段来源
+func (s *MiniProgramService) SubmitVehicle(vehicle *model.ExternalVehicle) error {
+	// 车牌颜色由车牌号码和车辆类型决定，不采用提交值；审核状态只能通过审核操作变更
+	vehicle.PlateColor = ""
+	vehicle.AuditStatus = model.AuditStatusPending
+	vehicle.AuditStep = 0
+	if err := validateExternalVehicle(s.repo, vehicle, nil); err != nil {
 		return err
 	}
-	if !matched {
-		return fmt.Errorf("日期格式不正确，应为YYYY-MM-DD")
+	if err := checkLedgerAttachments(s.files, model.QRCodeTypeExternalVehicle, vehicle, nil); err != nil {
+		return err
 	}
 
-	// 验证日期是否有效
-	_, err = time.Parse("2006-01-02", dateStr)
+	recognitions, err := s.loadRecognitions(vehicle)
 	if err != nil {
-		return fmt.Errorf("日期不正确")
-	}
-
-	return nil
-}
-
-func (s *MiniProgramService) validateRequiredFields(vehicle *model.ExternalVehicle) error {
-	if vehicle.BrandModel == "" {
-		return fmt.Errorf("品牌型号不能为空")
+		return err
 	}
-	if vehicle.UsageNature == "" {
-		return fmt.Errorf("使用性质不能为空")
+	vehicle.FieldSources, err = fieldSources(vehicle, recognitions)
+	if err != nil {
+		return err
 	}
-	if vehicle.Owner == "" {
-		return fmt.Errorf("所有人不能为空")
+
+	var rejected model.ExternalVehicle
+	err = s.repo.DB.Where("park_id = ? AND license_plate = ? AND audit_status = ?",
+		vehicle.ParkID, vehicle.LicensePlate, model.AuditStatusRejected).
+		Order("id DESC").First(&rejected).Error
+	switch {
+	case err == nil:
+		err = s.resubmitVehicle(vehicle, &rejected)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = createLedger(s.repo, model.QRCodeTypeExternalVehicle, vehicle)
 	}
-	if vehicle.Address == "" {
-		return fmt.Errorf("住址不能为空")
+	if err != nil {
+		return err
 	}
 
-	// 核定载质量、准牵引总质量其中一个数据不为空则符合要求；都为空，默认核定载质量40000KG
-	if vehicle.ApprovedLoadMass == nil && vehicle.MaxTowingMass == nil {
-		defaultMass := 40000.0
-		vehicle.ApprovedLoadMass = &defaultMass
+	if len(recognitions) > 0 {
+		ids := make([]uint, 0, len(recognitions))
+		for _, recognition := range recognitions {
+			ids = append(ids, recognition.ID)
+		}
+		if err := s.repo.DB.Model(&model.OCRRecognition{}).Where("id IN ?", ids).Update("vehicle_id", vehicle.ID).Error; err != nil {
+			log.Printf("Failed to link ocr recognitions to external vehicle %d: %v", vehicle.ID, err)
+		}
 	}
 
+	// 按车场规则在后台自动审核，提交保存后即返回（查询第三方随车清单可能较慢）；
+	// 审核失败时保留待审核状态由人工处理，不影响提交结果
+	submitted := *vehicle
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autoAuditTimeout)
+		defer cancel()
+		if err := s.audit.AutoAudit(ctx, &submitted); err != nil {
+			log.Printf("Failed to auto audit external vehicle %d: %v", submitted.ID, err)
+		}
+	}()
 	return nil
 }
 
-func isLetter(c byte) bool {
-	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
-}
-
-func isDigit(c byte) bool {
-	return c >= '0' && c <= '9'
-}
-
-func contains(s, substr string) bool {
-	return strings.Contains(s, substr)
+// resubmitVehicle 用提交的数据覆盖被驳回的车辆，下发相关状态沿用原记录
+func (s *MiniProgramService) resubmitVehicle(vehicle, rejected *model.ExternalVehicle) error {
+	vehicle.ID = rejected.ID
+	vehicle.CreatedAt = rejected.CreatedAt
+	vehicle.AuditStatus = rejected.AuditStatus
+	vehicle.DispatchStatus = rejected.DispatchStatus
+	vehicle.NetworkStatus = rejected.NetworkStatus
+	vehicle.DispatchCount = rejected.DispatchCount
+	vehicle.DispatchTime = rejected.DispatchTime
+	vehicle.Version = rejected.Version + 1
+
+	return s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveLedgerTx(tx, model.QRCodeTypeExternalVehicle, vehicle); err != nil {
+			return err
+		}
+		record := &model.AuditRecord{Action: model.AuditActionResubmit, Reason: "车主重新提交"}
+		return applyAudit(tx, vehicle, record, nil)
+	})
 }
@@ -2,24 +2,40 @@
 package service
 
 import (
-	"time"
-
 	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
+
+	"gorm.io/gorm"
 )
 
 type NonRoadService struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	files  *FileService
+	events *realtime.Hub
 }
 
-func NewNonRoadService(repo *repository.Repository) *NonRoadService {
+func NewNonRoadService(repo *repository.Repository, files *FileService, events *realtime.Hub) *NonRoadService {
 	return &NonRoadService{
-		repo: repo,
+		repo:   repo,
+		files:  files,
+		events: events,
 	}
 }
 
 func (s *NonRoadService) Create(machinery *model.NonRoadMachinery) error {
-	return s.repo.DB.Create(machinery).Error
+	keepServerFields(machinery, nil)
+	if err := validateNonRoadMachinery(s.repo, machinery, nil); err != nil {
+		return err
+	}
+	if err := checkLedgerAttachments(s.files, model.QRCodeTypeNonRoad, machinery, nil); err != nil {
+		return err
+	}
+	dispatch, err := autoDispatchEnabled(s.repo, machinery.ParkID, model.QRCodeTypeNonRoad)
+	if err != nil {
+		return err
+	}
+	return storeLedger(s.repo, s.events, model.QRCodeTypeNonRoad, machinery, createLedgerTx, dispatch)
 }
 
 func (s *NonRoadService) GetByID(id uint) (*model.NonRoadMachinery, error) {
@@ -28,6 +44,7 @@ func (s *NonRoadService) GetByID(id uint) (*model.NonRoadMachinery, error) {
 	if err != nil {
 		return nil, err
 	}
+	machinery.PhotoURLs = s.files.PhotoURLs(machinery.ParkID, machinery.Attachments, false)
 	return &machinery, nil
 }
 
@@ -35,6 +52,27 @@ func (s *NonRoadService) List(parkID uint, environmentalCode, licensePlate, disp
 	var machineryList []model.NonRoadMachinery
 	var total int64
 
+	query := s.filter(parkID, environmentalCode, licensePlate, dispatchStatus, emissionStandard)
+
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err = query.Offset(offset).Limit(pageSize).Find(&machineryList).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range machineryList {
+		machineryList[i].PhotoURLs = s.files.PhotoURLs(parkID, machineryList[i].Attachments, true)
+	}
+
+	return machineryList, total, nil
+}
+
+// filter 按列表条件筛选车场的机械，列表与导出共用
+func (s *NonRoadService) filter(parkID uint, environmentalCode, licensePlate, dispatchStatus, emissionStandard string) *gorm.DB {
 	query := s.repo.DB.Model(&model.NonRoadMachinery{}).Where("park_id = ?", parkID)
 
 	if environmentalCode != "" {
@@ -49,43 +87,44 @@ func (s *NonRoadService) List(parkID uint, environmentalCode, licensePlate, disp
 	if emissionStandard != "" {
 		query = query.Where("emission_standard = ?", emissionStandard)
 	}
+	return query
+}
 
-	err := query.Count(&total).Error
+func (s *NonRoadService) Update(machinery *model.NonRoadMachinery) error {
+	existing, err := s.GetByID(machinery.ID)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
+	machinery.ParkID = existing.ParkID
+	keepServerFields(machinery, existing)
 
-	offset := (page - 1) * pageSize
-	err = query.Offset(offset).Limit(pageSize).Find(&machineryList).Error
-	if err != nil {
-		return nil, 0, err
+	if err := validateNonRoadMachinery(s.repo, machinery, existing); err != nil {
+		return err
 	}
-
-	return machineryList, total, nil
-}
-
-func (s *NonRoadService) Update(machinery *model.NonRoadMachinery) error {
-	return s.repo.DB.Save(machinery).Error
+	if err := checkLedgerAttachments(s.files, model.QRCodeTypeNonRoad, machinery, existing); err != nil {
+		return err
+	}
+	machinery.Version = existing.Version + 1
+
+	// 已下发的记录修改后重新下发，插件据此更新本地数据
+	dispatch := existing.DispatchStatus == model.DispatchStatusDispatched
+	if !dispatch {
+		if dispatch, err = autoDispatchEnabled(s.repo, machinery.ParkID, model.QRCodeTypeNonRoad); err != nil {
+			return err
+		}
+	}
+	return storeLedger(s.repo, s.events, model.QRCodeTypeNonRoad, machinery, saveLedgerTx, dispatch)
 }
 
 func (s *NonRoadService) Delete(id uint) error {
-	return s.repo.DB.Delete(&model.NonRoadMachinery{}, id).Error
+	return deleteLedger(s.repo, s.events, model.QRCodeTypeNonRoad, &model.NonRoadMachinery{}, id)
 }
 
 func (s *NonRoadService) Dispatch(id uint) error {
-	now := time.Now()
-	return s.repo.DB.Model(&model.NonRoadMachinery{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"dispatch_status": "dispatched",
-		"dispatch_time":   &now,
-	}).Error
+	return dispatchLedgers(s.repo, s.events, model.QRCodeTypeNonRoad, []uint{id})
 }
 
-func (s *NonRoadService) BatchDispatch(ids []uint) error {
-	now := time.Now()
-	return s.repo.DB.Model(&model.NonRoadMachinery{}).
-		Where("id IN ?", ids).
-		Updates(map[string]interface{}{
-			"dispatch_status": "dispatched",
-			"dispatch_time":   &now,
-		}).Error
+// BatchDispatch 批量下发，逐条返回结果
+func (s *NonRoadService) BatchDispatch(req *model.BatchRequest) (*model.BatchResult, error) {
+	return batchDispatch(s.repo, s.events, model.QRCodeTypeNonRoad, req, nil)
 }
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/plate"
+	"taizhang-server/internal/validation"
+)
+
+// MaxOCRImageSize 证照照片大小上限
+const MaxOCRImageSize = 4 << 20
+
+var (
+	// ErrOCRUnavailable 未配置证照识别服务
+	ErrOCRUnavailable = errors.New("未启用证照识别服务")
+	// ErrInvalidOCRRequest 证照类型或照片不合法
+	ErrInvalidOCRRequest = errors.New("invalid ocr request")
+	// ErrOCRFailed 识别服务调用失败
+	ErrOCRFailed = errors.New("证照识别失败")
+)
+
+// OCRProvider 证照识别服务，返回证照上的原始文字，键为证照上的栏目名（如“号牌号码”）
+type OCRProvider interface {
+	Name() string
+	Recognize(ctx context.Context, kind string, image []byte) (map[string]string, error)
+}
+
+// NewOCRProvider 按配置创建证照识别服务，未配置时返回 nil
+func NewOCRProvider(cfg config.OCRConfig) (OCRProvider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "fake":
+		return NewFakeOCRProvider(), nil
+	case "baidu":
+		if cfg.APIKey == "" || cfg.SecretKey == "" {
+			return nil, fmt.Errorf("百度证照识别须配置 api_key 和 secret_key")
+		}
+		return newBaiduOCRProvider(cfg), nil
+	}
+	return nil, fmt.Errorf("unsupported ocr provider: %s", cfg.Provider)
+}
+
+// FakeOCRProvider 本地证照识别实现，按证照类型返回固定结果，用于测试和联调
+type FakeOCRProvider struct {
+	Results map[string]map[string]string
+	Err     error // 非空时每次识别都返回该错误
+}
+
+// NewFakeOCRProvider 返回预置样例数据的本地识别实现
+func NewFakeOCRProvider() *FakeOCRProvider {
+	return &FakeOCRProvider{
+		Results: map[string]map[string]string{
+			model.OCRKindDrivingLicense: {
+				"号牌号码":   "京A12345",
+				"车辆类型":   "重型半挂牵引车",
+				"所有人":    "北京示例物流有限公司",
+				"住址":     "北京市朝阳区示例路1号",
+				"使用性质":   "货运",
+				"品牌型号":   "解放牌CA4250P66K24T1A1E5",
+				"车辆识别代号": "LFWSRXSJ5J1A12345",
+				"发动机号码":  "12345678",
+				"注册日期":   "20180506",
+				"发证日期":   "20180506",
+			},
+			model.OCRKindDrivingLicenseBack: {
+				"号牌号码":   "京A12345",
+				"总质量":    "25000kg",
+				"整备质量":   "8800kg",
+				"核定载质量":  "--",
+				"准牵引总质量": "40000kg",
+			},
+			model.OCRKindNameplate: {
+				"车辆识别代号":  "LFWSRXSJ5J1A12345",
+				"发动机型号":   "CA6DM2-42E51",
+				"最大允许总质量": "25000kg",
+			},
+		},
+	}
+}
+
+func (p *FakeOCRProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeOCRProvider) Recognize(ctx context.Context, kind string, image []byte) (map[string]string, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	words, ok := p.Results[kind]
+	if !ok {
+		return nil, fmt.Errorf("未识别到%s", ocrKindLabels[kind])
+	}
+	result := make(map[string]string, len(words))
+	for label, value := range words {
+		result[label] = value
+	}
+	return result, nil
+}
+
+// ocrKindLabels 证照类型名称
+var ocrKindLabels = map[string]string{
+	model.OCRKindDrivingLicense:     "行驶证主页",
+	model.OCRKindDrivingLicenseBack: "行驶证副页",
+	model.OCRKindNameplate:          "车辆铭牌",
+}
+
+// ocrFieldLabels 各类证照栏目对应的车辆字段
+var ocrFieldLabels = map[string]map[string]string{
+	model.OCRKindDrivingLicense: {
+		"号牌号码":   "license_plate",
+		"车辆类型":   "vehicle_type",
+		"所有人":    "owner",
+		"住址":     "address",
+		"使用性质":   "usage_nature",
+		"品牌型号":   "brand_model",
+		"车辆识别代号": "vin",
+		"发动机号码":  "engine_number",
+		"注册日期":   "register_date",
+		"发证日期":   "issue_date",
+	},
+	model.OCRKindDrivingLicenseBack: {
+		"号牌号码":   "license_plate",
+		"总质量":    "total_mass",
+		"整备质量":   "curb_mass",
+		"核定载质量":  "approved_load_mass",
+		"准牵引总质量": "max_towing_mass",
+	},
+	model.OCRKindNameplate: {
+		"车辆识别代号":  "vin",
+		"发动机型号":   "engine_model",
+		"最大允许总质量": "total_mass",
+	},
+}
+
+// ocrFieldKeys 可由证照识别填写的字段，按表单顺序排列
+var ocrFieldKeys = []string{
+	"license_plate", "vehicle_type", "vin", "register_date", "brand_model", "usage_nature",
+	"engine_number", "engine_model", "total_mass", "curb_mass", "approved_load_mass", "max_towing_mass",
+	"address", "issue_date", "owner",
+}
+
+// ocrField 返回车辆中可由证照识别填写的字段，文字字段返回 text，质量字段返回 mass
+func ocrField(vehicle *model.ExternalVehicle, key string) (text *string, mass **float64) {
+	switch key {
+	case "license_plate":
+		return &vehicle.LicensePlate, nil
+	case "vehicle_type":
+		return &vehicle.VehicleType, nil
+	case "vin":
+		return &vehicle.VIN, nil
+	case "register_date":
+		return &vehicle.RegisterDate, nil
+	case "brand_model":
+		return &vehicle.BrandModel, nil
+	case "usage_nature":
+		return &vehicle.UsageNature, nil
+	case "engine_number":
+		return &vehicle.EngineNumber, nil
+	case "engine_model":
+		return &vehicle.EngineModel, nil
+	case "address":
+		return &vehicle.Address, nil
+	case "issue_date":
+		return &vehicle.IssueDate, nil
+	case "owner":
+		return &vehicle.Owner, nil
+	case "total_mass":
+		return nil, &vehicle.TotalMass
+	case "curb_mass":
+		return nil, &vehicle.CurbMass
+	case "approved_load_mass":
+		return nil, &vehicle.ApprovedLoadMass
+	case "max_towing_mass":
+		return nil, &vehicle.MaxTowingMass
+	}
+	return nil, nil
+}
+
+// ocrValue 以字符串形式返回字段值，用于与识别结果比较
+func ocrValue(vehicle *model.ExternalVehicle, key string) string {
+	text, mass := ocrField(vehicle, key)
+	switch {
+	case text != nil:
+		return strings.TrimSpace(*text)
+	case mass != nil && *mass != nil:
+		return strconv.FormatFloat(**mass, 'f', -1, 64)
+	}
+	return ""
+}
+
+var (
+	ocrDatePattern = regexp.MustCompile(`^(\d{4})\D{0,2}?(\d{1,2})\D{0,2}?(\d{1,2})\D?$`)
+	ocrMassPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(kg|KG|Kg|公斤|t|T|吨)?$`)
+)
+
+// normalizeOCRValue 规范化识别出的文字：日期统一为 YYYY-MM-DD，质量统一为千克，VIN 纠正易混淆字符
+// 无法规范化时返回错误，“--”等空白栏目返回空字符串
+func normalizeOCRValue(key, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.Trim(value, "-—/ ") == "" {
+		return "", nil
+	}
+
+	switch key {
+	case "register_date", "issue_date":
+		m := ocrDatePattern.FindStringSubmatch(value)
+		if m == nil {
+			return "", fmt.Errorf("无法识别日期“%s”", value)
+		}
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		date := fmt.Sprintf("%s-%02d-%02d", m[1], month, day)
+		// 识别错误可能得到 2 月 30 日、13 月等不存在的日期
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return "", fmt.Errorf("日期“%s”不存在", value)
+		}
+		return date, nil
+	case "total_mass", "curb_mass", "approved_load_mass", "max_towing_mass":
+		m := ocrMassPattern.FindStringSubmatch(strings.ReplaceAll(value, " ", ""))
+		if m == nil {
+			return "", fmt.Errorf("无法识别质量“%s”", value)
+		}
+		mass, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return "", fmt.Errorf("无法识别质量“%s”", value)
+		}
+		switch m[2] {
+		case "t", "T", "吨":
+			mass *= 1000
+		}
+		return strconv.FormatFloat(mass, 'f', -1, 64), nil
+	case "vin":
+		// VIN 不使用 I、O、Q，识别结果中出现时按形近数字纠正
+		return strings.NewReplacer("I", "1", "O", "0", "Q", "0").Replace(plate.Normalize(value)), nil
+	case "license_plate", "engine_number", "engine_model":
+		return plate.Normalize(value), nil
+	}
+	return value, nil
+}
+
+// setOCRValue 将规范化后的识别值写入车辆字段
+func setOCRValue(vehicle *model.ExternalVehicle, key, value string) {
+	text, mass := ocrField(vehicle, key)
+	switch {
+	case text != nil:
+		*text = value
+	case mass != nil:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			*mass = &f
+		}
+	}
+}
+
+// Recognize 识别证照照片，返回规范化并经格式校验的车辆字段，同时保存识别记录，车主提交车辆时据此标记字段来源
+// 识别值未通过校验时仍然返回，由车主核对修改
+func (s *MiniProgramService) Recognize(ctx context.Context, parkID uint, kind string, image []byte) (*model.OCRResult, error) {
+	if s.ocr == nil {
+		return nil, ErrOCRUnavailable
+	}
+	labels, ok := ocrFieldLabels[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持的证照类型 %s", ErrInvalidOCRRequest, kind)
+	}
+	if len(image) == 0 {
+		return nil, fmt.Errorf("%w: 请上传证照照片", ErrInvalidOCRRequest)
+	}
+	if len(image) > MaxOCRImageSize {
+		return nil, fmt.Errorf("%w: 照片不能超过%dMB", ErrInvalidOCRRequest, MaxOCRImageSize>>20)
+	}
+	if !strings.HasPrefix(http.DetectContentType(image), "image/") {
+		return nil, fmt.Errorf("%w: 上传的文件不是图片", ErrInvalidOCRRequest)
+	}
+
+	words, err := s.ocr.Recognize(ctx, kind, image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOCRFailed, err)
+	}
+
+	vehicle := &model.ExternalVehicle{ParkID: parkID}
+	result := &model.OCRResult{Kind: kind, Vehicle: vehicle, Fields: []string{}, Warnings: map[string]string{}}
+	fields := make(map[string]string, len(labels))
+	for label, key := range labels {
+		value, err := normalizeOCRValue(key, words[label])
+		if err != nil {
+			result.Warnings[key] = err.Error()
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		setOCRValue(vehicle, key, value)
+		fields[key] = value
+	}
+	for _, key := range ocrFieldKeys {
+		if _, ok := fields[key]; ok {
+			result.Fields = append(result.Fields, key)
+		}
+	}
+
+	for _, fe := range validation.CheckExternalVehicleFields(vehicle, result.Fields) {
+		result.Warnings[fe.Field] = fe.Message
+	}
+	if vehicle.LicensePlate != "" {
+		// 车牌可解析时按车辆类型推断号牌颜色，与提交时的处理一致
+		_ = applyPlate(&vehicle.LicensePlate, &vehicle.PlateColor, vehicle.VehicleType, false)
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	recognition := &model.OCRRecognition{
+		ParkID:   parkID,
+		Kind:     kind,
+		Provider: s.ocr.Name(),
+		Fields:   data,
+	}
+	if err := s.repo.DB.Create(recognition).Error; err != nil {
+		return nil, err
+	}
+	result.RecognitionID = recognition.ID
+	return result, nil
+}
+
+// loadRecognitions 读取车辆提交时携带的识别记录，已使用或属于其他车场的记录不计入
+func (s *MiniProgramService) loadRecognitions(vehicle *model.ExternalVehicle) ([]model.OCRRecognition, error) {
+	if len(vehicle.OCRRecognitionIDs) == 0 {
+		return nil, nil
+	}
+	var recognitions []model.OCRRecognition
+	err := s.repo.DB.Where("id IN ? AND vehicle_id IS NULL AND park_id IN ?",
+		vehicle.OCRRecognitionIDs, []uint{0, vehicle.ParkID}).Find(&recognitions).Error
+	return recognitions, err
+}
+
+// fieldSources 对照识别记录标记可识别字段的来源：与识别值一致为 ocr，识别后被修改为 edited，未识别的为 manual
+func fieldSources(vehicle *model.ExternalVehicle, recognitions []model.OCRRecognition) (json.RawMessage, error) {
+	recognized := make(map[string][]string)
+	for _, recognition := range recognitions {
+		var fields map[string]string
+		if err := json.Unmarshal(recognition.Fields, &fields); err != nil {
+			log.Printf("Failed to parse ocr recognition %d: %v", recognition.ID, err)
+			continue
+		}
+		for key, value := range fields {
+			recognized[key] = append(recognized[key], value)
+		}
+	}
+
+	sources := make(map[string]string)
+	for _, key := range ocrFieldKeys {
+		current := ocrValue(vehicle, key)
+		if current == "" {
+			continue
+		}
+		values, ok := recognized[key]
+		if !ok {
+			sources[key] = model.FieldSourceManual
+			continue
+		}
+		sources[key] = model.FieldSourceEdited
+		for _, value := range values {
+			if strings.EqualFold(value, current) {
+				sources[key] = model.FieldSourceOCR
+				break
+			}
+		}
+	}
+	return json.Marshal(sources)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/model"
+)
+
+// baiduOCRBaseURL 百度智能云文字识别接口地址
+const baiduOCRBaseURL = "https://aip.baidubce.com"
+
+// baiduOCRProvider 百度智能云行驶证识别，支持行驶证主页和副页
+type baiduOCRProvider struct {
+	apiKey    string
+	secretKey string
+	client    *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newBaiduOCRProvider(cfg config.OCRConfig) *baiduOCRProvider {
+	return &baiduOCRProvider{
+		apiKey:    cfg.APIKey,
+		secretKey: cfg.SecretKey,
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (p *baiduOCRProvider) Name() string {
+	return "baidu"
+}
+
+func (p *baiduOCRProvider) Recognize(ctx context.Context, kind string, image []byte) (map[string]string, error) {
+	var side string
+	switch kind {
+	case model.OCRKindDrivingLicense:
+		side = "front"
+	case model.OCRKindDrivingLicenseBack:
+		side = "back"
+	default:
+		return nil, fmt.Errorf("百度证照识别不支持%s", ocrKindLabels[kind])
+	}
+
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"image":                {base64.StdEncoding.EncodeToString(image)},
+		"vehicle_license_side": {side},
+		"detect_direction":     {"true"},
+	}
+	endpoint := baiduOCRBaseURL + "/rest/2.0/ocr/v1/vehicle_license?access_token=" + url.QueryEscape(token)
+
+	var result struct {
+		ErrorCode   int    `json:"error_code"`
+		ErrorMsg    string `json:"error_msg"`
+		WordsResult map[string]struct {
+			Words string `json:"words"`
+		} `json:"words_result"`
+	}
+	if err := p.post(ctx, endpoint, form, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrorCode != 0 {
+		// 110、111 为令牌无效或过期，下次识别时重新获取
+		if result.ErrorCode == 110 || result.ErrorCode == 111 {
+			p.mu.Lock()
+			p.token = ""
+			p.mu.Unlock()
+		}
+		return nil, fmt.Errorf("%s (%d)", result.ErrorMsg, result.ErrorCode)
+	}
+
+	words := make(map[string]string, len(result.WordsResult))
+	for label, item := range result.WordsResult {
+		words[label] = item.Words
+	}
+	return words, nil
+}
+
+// accessToken 返回缓存的访问令牌，过期前一小时重新获取
+func (p *baiduOCRProvider) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expiresAt) {
+		return p.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.apiKey},
+		"client_secret": {p.secretKey},
+	}
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.post(ctx, baiduOCRBaseURL+"/oauth/2.0/token", form, &result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("获取百度访问令牌失败: %s %s", result.Error, result.ErrorDescription)
+	}
+
+	p.token = result.AccessToken
+	p.expiresAt = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Hour)
+	return p.token, nil
+}
+
+func (p *baiduOCRProvider) post(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, out)
+}
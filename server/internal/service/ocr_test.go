@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/repository"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// pngHeader 可被识别为图片的最小内容
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// newDryRunRepository 返回不连接数据库的仓库，写入语句只生成不执行
+func newDryRunRepository(t *testing.T) *repository.Repository {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repository.New(db)
+}
+
+func TestRecognize(t *testing.T) {
+	s := &MiniProgramService{repo: newDryRunRepository(t), ocr: NewFakeOCRProvider()}
+
+	result, err := s.Recognize(context.Background(), 1, model.OCRKindDrivingLicense, pngHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := result.Vehicle
+	if v.ParkID != 1 || v.LicensePlate != "京A12345" || v.VIN != "LFWSRXSJ5J1A12345" || v.Owner != "北京示例物流有限公司" {
+		t.Errorf("vehicle = %+v", v)
+	}
+	if v.RegisterDate != "2018-05-06" || v.IssueDate != "2018-05-06" {
+		t.Errorf("dates = %q, %q, want 2018-05-06", v.RegisterDate, v.IssueDate)
+	}
+	wantFields := []string{"license_plate", "vehicle_type", "vin", "register_date", "brand_model", "usage_nature", "engine_number", "address", "issue_date", "owner"}
+	if !reflect.DeepEqual(result.Fields, wantFields) {
+		t.Errorf("fields = %v, want %v", result.Fields, wantFields)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+
+	// 副页：质量统一为千克，“--”视为未填写
+	result, err = s.Recognize(context.Background(), 1, model.OCRKindDrivingLicenseBack, pngHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = result.Vehicle
+	if v.TotalMass == nil || *v.TotalMass != 25000 || v.MaxTowingMass == nil || *v.MaxTowingMass != 40000 {
+		t.Errorf("masses = %v, %v", v.TotalMass, v.MaxTowingMass)
+	}
+	if v.ApprovedLoadMass != nil {
+		t.Errorf("approved load mass = %v, want nil", *v.ApprovedLoadMass)
+	}
+
+	// 识别值未通过规范化时仍返回其余字段，并给出提示
+	fake := NewFakeOCRProvider()
+	fake.Results[model.OCRKindDrivingLicense]["注册日期"] = "20180230"
+	s.ocr = fake
+	result, err = s.Recognize(context.Background(), 1, model.OCRKindDrivingLicense, pngHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Vehicle.RegisterDate != "" || result.Warnings["register_date"] == "" {
+		t.Errorf("register date = %q, warnings = %v", result.Vehicle.RegisterDate, result.Warnings)
+	}
+	if result.Vehicle.IssueDate != "2018-05-06" {
+		t.Errorf("issue date = %q", result.Vehicle.IssueDate)
+	}
+}
+
+func TestRecognizeErrors(t *testing.T) {
+	failing := NewFakeOCRProvider()
+	failing.Err = errors.New("timeout")
+	tests := []struct {
+		name  string
+		ocr   OCRProvider
+		kind  string
+		image []byte
+		want  error
+	}{
+		{"unconfigured", nil, model.OCRKindDrivingLicense, pngHeader, ErrOCRUnavailable},
+		{"unknown kind", NewFakeOCRProvider(), "passport", pngHeader, ErrInvalidOCRRequest},
+		{"empty image", NewFakeOCRProvider(), model.OCRKindDrivingLicense, nil, ErrInvalidOCRRequest},
+		{"not an image", NewFakeOCRProvider(), model.OCRKindDrivingLicense, []byte("%PDF-1.4"), ErrInvalidOCRRequest},
+		{"too large", NewFakeOCRProvider(), model.OCRKindDrivingLicense, make([]byte, MaxOCRImageSize+1), ErrInvalidOCRRequest},
+		{"provider error", failing, model.OCRKindDrivingLicense, pngHeader, ErrOCRFailed},
+	}
+	for _, tt := range tests {
+		s := &MiniProgramService{repo: newDryRunRepository(t), ocr: tt.ocr}
+		if _, err := s.Recognize(context.Background(), 1, tt.kind, tt.image); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeOCRValue(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+		wantErr          bool
+	}{
+		{key: "register_date", value: "20180506", want: "2018-05-06"},
+		{key: "register_date", value: "2018-5-6", want: "2018-05-06"},
+		{key: "register_date", value: "2018年05月06日", want: "2018-05-06"},
+		{key: "issue_date", value: "2018.12.31", want: "2018-12-31"},
+		{key: "issue_date", value: "2024-02-29", want: "2024-02-29"},
+		{key: "issue_date", value: "2023-02-29", wantErr: true},
+		{key: "register_date", value: "2018-02-30", wantErr: true},
+		{key: "register_date", value: "2018-13-01", wantErr: true},
+		{key: "register_date", value: "2018-00-10", wantErr: true},
+		{key: "register_date", value: "五月六日", wantErr: true},
+		{key: "register_date", value: "--", want: ""},
+
+		{key: "total_mass", value: "25000kg", want: "25000"},
+		{key: "total_mass", value: "25 t", want: "25000"},
+		{key: "curb_mass", value: "8.8吨", want: "8800"},
+		{key: "max_towing_mass", value: "40000公斤", want: "40000"},
+		{key: "approved_load_mass", value: "1.5T", want: "1500"},
+		{key: "approved_load_mass", value: "——", want: ""},
+		{key: "approved_load_mass", value: "约25吨", wantErr: true},
+
+		{key: "vin", value: "LFWSRXSJ5J1A12345", want: "LFWSRXSJ5J1A12345"},
+		{key: "vin", value: "lfwsrxsj5jiao2345", want: "LFWSRXSJ5J1A02345"},
+		{key: "vin", value: "LFWSRXSJ5JQA1234O", want: "LFWSRXSJ5J0A12340"},
+		{key: "vin", value: " LFW SRXSJ5J1A12345 ", want: "LFWSRXSJ5J1A12345"},
+
+		{key: "owner", value: " 北京示例物流有限公司 ", want: "北京示例物流有限公司"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeOCRValue(tt.key, tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeOCRValue(%q, %q) = %q, want error", tt.key, tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeOCRValue(%q, %q) = %q, %v, want %q", tt.key, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestFieldSources(t *testing.T) {
+	recognition := func(fields map[string]string) model.OCRRecognition {
+		data, _ := json.Marshal(fields)
+		return model.OCRRecognition{Fields: data}
+	}
+	mass := 40000.0
+	vehicle := &model.ExternalVehicle{
+		LicensePlate:  "京A12345",           // 与识别值一致
+		VIN:           "lfwsrxsj5j1a12345", // 只有大小写不同
+		Owner:         "北京另一物流有限公司",        // 识别后被修改
+		Phone:         "13800000000",       // 不可识别的字段不标记
+		FuelType:      "柴油",
+		MaxTowingMass: &mass, // 识别自副页
+		EngineModel:   "CA6DM2-42E51",
+		Address:       "北京市朝阳区示例路1号", // 未识别到
+	}
+	recognitions := []model.OCRRecognition{
+		recognition(map[string]string{"license_plate": "京A12345", "vin": "LFWSRXSJ5J1A12345", "owner": "北京示例物流有限公司"}),
+		recognition(map[string]string{"license_plate": "京A12345", "max_towing_mass": "40000"}),
+		{ID: 9, Fields: json.RawMessage("not json")}, // 无法解析的记录跳过
+	}
+
+	data, err := fieldSources(vehicle, recognitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"license_plate":   model.FieldSourceOCR,
+		"vin":             model.FieldSourceOCR,
+		"owner":           model.FieldSourceEdited,
+		"max_towing_mass": model.FieldSourceOCR,
+		"engine_model":    model.FieldSourceManual,
+		"address":         model.FieldSourceManual,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field sources = %v, want %v", got, want)
+	}
+
+	// 没有识别记录时，已填写的可识别字段均为车主填写
+	data, err = fieldSources(&model.ExternalVehicle{LicensePlate: "京A12345"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"license_plate":"manual"}` {
+		t.Errorf("field sources = %s", data)
+	}
+}
@@ -7,15 +7,19 @@ import (
 	"time"
 
 	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
+
+	"gorm.io/gorm"
 )
 
 type ParkService struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	events *realtime.Hub
 }
 
-func NewParkService(repo *repository.Repository) *ParkService {
-	return &ParkService{repo: repo}
+func NewParkService(repo *repository.Repository, events *realtime.Hub) *ParkService {
+	return &ParkService{repo: repo, events: events}
 }
 
 func (s *ParkService) Create(park *model.Park) error {
@@ -42,7 +46,14 @@ func (s *ParkService) Create(park *model.Park) error {
 		park.EndTime = time.Now().AddDate(1, 0, 0) // 默认一年有效期
 	}
 
-	return s.repo.DB.Create(park).Error
+	// 车场与三类二维码在同一事务中创建
+	return s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(park).Error; err != nil {
+			return err
+		}
+		_, err := provisionQRCodes(tx, park.ID)
+		return err
+	})
 }
 
 func (s *ParkService) GetByID(id uint) (*model.Park, error) {
@@ -101,7 +112,12 @@ func (s *ParkService) Update(id uint, updates map[string]interface{}) error {
 		}
 	}
 
-	return s.repo.DB.Model(&model.Park{}).Where("id = ?", id).Updates(filteredUpdates).Error
+	if err := s.repo.DB.Model(&model.Park{}).Where("id = ?", id).Updates(filteredUpdates).Error; err != nil {
+		return err
+	}
+
+	s.events.Publish(id, realtime.EventConfigChanged, map[string]interface{}{"scope": "park"})
+	return nil
 }
 
 func (s *ParkService) Delete(id uint) error {
@@ -139,6 +155,7 @@ func (s *ParkService) Renew(id uint, duration int) (*model.Park, error) {
 		return nil, err
 	}
 
+	s.events.Publish(id, realtime.EventConfigChanged, map[string]interface{}{"scope": "park"})
 	return &park, nil
 }
 
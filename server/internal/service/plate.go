@@ -0,0 +1,25 @@
+package service
+
+import (
+	"taizhang-server/internal/plate"
+)
+
+// applyPlate 校验并规范化车牌号码，车牌颜色为空时根据车牌和车辆类型推断
+// required 为 false 时允许车牌为空（如厂内车辆、非道路机械未上牌）
+func applyPlate(number, color *string, vehicleType string, required bool) error {
+	if plate.Normalize(*number) == "" && !required {
+		*number = ""
+		return nil
+	}
+
+	p, err := plate.Parse(*number)
+	if err != nil {
+		return err
+	}
+
+	*number = p.Number
+	if color != nil && *color == "" {
+		*color = p.Color(vehicleType)
+	}
+	return nil
+}
@@ -1,29 +1,143 @@
-
 package service
 
 import (
+	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"taizhang-server/internal/config"
 	"taizhang-server/internal/model"
+	"taizhang-server/internal/payload"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PluginService struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	cfg    *config.Config
+	events *realtime.Hub
+	files  *FileService
+
+	nonceMu       sync.Mutex
+	noncePurgedAt time.Time
 }
 
-func NewPluginService(repo *repository.Repository) *PluginService {
+func NewPluginService(repo *repository.Repository, cfg *config.Config, events *realtime.Hub, files *FileService) *PluginService {
 	return &PluginService{
-		repo: repo,
+		repo:   repo,
+		cfg:    cfg,
+		events: events,
+		files:  files,
+	}
+}
+
+var (
+	// ErrInvalidPluginToken 令牌不存在、已注销或已过期
+	ErrInvalidPluginToken = errors.New("invalid or expired token")
+	// ErrUnsupportedProtocol 插件请求的协议版本或加密方式不受支持
+	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+)
+
+// 插件请求签名的时间戳允许偏差，随机数在此期间内不得重复使用
+const (
+	signatureWindow = 5 * time.Minute
+	nonceTTL        = 2 * signatureWindow
+)
+
+// ErrReplayedRequest 随机数已被使用过
+var ErrReplayedRequest = errors.New("nonce already used")
+
+// VerifyRequest 校验插件请求签名：时间戳在有效期内、签名覆盖请求方法、路径、时间戳、随机数和请求体摘要，且随机数未被使用过
+func (s *PluginService) VerifyRequest(req *model.SignedRequest) error {
+	if l := len(req.Nonce); l < 16 || l > 64 {
+		return fmt.Errorf("nonce must be 16 to 64 characters")
+	}
+
+	var park model.Park
+	err := s.repo.DB.Select("id, secret_key").First(&park, req.ParkID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("park not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// 验证时间戳
+	now := time.Now()
+	if d := now.Sub(time.Unix(req.Timestamp, 0)); d > signatureWindow || d < -signatureWindow {
+		return fmt.Errorf("timestamp expired")
+	}
+
+	// 验证签名
+	expectedSignature := s.generateSignature(park.SecretKey, signingString(req))
+	if !hmac.Equal([]byte(req.Signature), []byte(expectedSignature)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	// 记录随机数，同一车场重复使用即视为重放
+	s.purgeExpiredNonces(now)
+	res := s.repo.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.PluginNonce{
+		ParkID:    park.ID,
+		Nonce:     req.Nonce,
+		ExpiresAt: now.Add(nonceTTL),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrReplayedRequest
+	}
+	return nil
+}
+
+// purgeExpiredNonces 清理过期的随机数，每分钟最多执行一次
+func (s *PluginService) purgeExpiredNonces(now time.Time) {
+	s.nonceMu.Lock()
+	if now.Sub(s.noncePurgedAt) < time.Minute {
+		s.nonceMu.Unlock()
+		return
+	}
+	s.noncePurgedAt = now
+	s.nonceMu.Unlock()
+
+	if err := s.repo.DB.Where("expires_at <= ?", now).Delete(&model.PluginNonce{}).Error; err != nil {
+		log.Printf("Failed to purge expired plugin nonces: %v", err)
 	}
 }
 
-// Verify PC端插件验证
-func (s *PluginService) Verify(parkID uint, timestamp int64, signature string) (*model.Park, error) {
+// Verify PC端插件验证，请求签名已由中间件校验，检查车场有效期后签发会话令牌
+// protocolVersion 为 0 时按版本 1 处理；encryption 为空时不加密，加密需协议版本 2 及以上
+func (s *PluginService) Verify(parkID uint, protocolVersion int, encryption string) (*model.PluginSession, error) {
+	if protocolVersion == 0 {
+		protocolVersion = model.SyncMinProtocolVersion
+	}
+	if protocolVersion < model.SyncMinProtocolVersion || protocolVersion > model.SyncProtocolVersion {
+		return nil, fmt.Errorf("%w: protocol version %d", ErrUnsupportedProtocol, protocolVersion)
+	}
+	if encryption == "" {
+		encryption = payload.EncryptionNone
+	}
+	if !payload.SupportedEncryption(encryption) {
+		return nil, fmt.Errorf("%w: encryption %s", ErrUnsupportedProtocol, encryption)
+	}
+	if encryption != payload.EncryptionNone && protocolVersion < payload.EncryptedVersion {
+		return nil, fmt.Errorf("%w: encryption requires protocol version %d or later", ErrUnsupportedProtocol, payload.EncryptedVersion)
+	}
+
 	// 获取车场信息
 	var park model.Park
 	err := s.repo.DB.First(&park, parkID).Error
@@ -31,46 +145,458 @@ func (s *PluginService) Verify(parkID uint, timestamp int64, signature string) (
 		return nil, err
 	}
 
-	// 验证时间戳（5分钟内有效）
-	now := time.Now().Unix()
-	if now-timestamp > 300 || timestamp-now > 300 {
-		return nil, fmt.Errorf("timestamp expired")
+	// 检查车场有效期
+	if park.StartTime.After(time.Now()) || park.EndTime.Before(time.Now()) {
+		return nil, fmt.Errorf("park has expired")
 	}
 
-	// 验证签名
-	expectedSignature := s.generateSignature(park.SecretKey, timestamp)
-	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
-		return nil, fmt.Errorf("invalid signature")
+	var session *model.PluginSession
+	err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		session, err = s.issueToken(tx, &park, protocolVersion, encryption)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return session, nil
+}
 
-	// 检查车场有效期
+// RefreshToken 用未过期的令牌换取新令牌，旧令牌立即失效
+func (s *PluginService) RefreshToken(token string) (*model.PluginSession, error) {
+	auth, err := s.findToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var park model.Park
+	if err := s.repo.DB.First(&park, auth.ParkID).Error; err != nil {
+		return nil, err
+	}
 	if park.StartTime.After(time.Now()) || park.EndTime.Before(time.Now()) {
 		return nil, fmt.Errorf("park has expired")
 	}
 
-	return &park, nil
+	var session *model.PluginSession
+	err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		// 并发刷新时只有一次能删除旧令牌成功
+		res := tx.Delete(&model.PluginAuth{}, auth.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidPluginToken
+		}
+		session, err = s.issueToken(tx, &park, auth.ProtocolVersion, auth.Encryption)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用旧令牌建立的实时连接随之关闭，插件用新令牌重连
+	s.events.CloseSession(auth.Token, realtime.EventTokenRevoked, map[string]interface{}{"reason": "refreshed"})
+	return session, nil
 }
 
-// Sync 同步数据
-func (s *PluginService) Sync(parkID uint, dataType string, data interface{}) error {
-	// 根据数据类型处理不同的同步逻辑
-	switch dataType {
-	case "external-vehicle":
-		// 处理厂外运输车辆数据同步
-	case "internal-vehicle":
-		// 处理厂内运输车辆数据同步
-	case "non-road":
-		// 处理非道路移动机械数据同步
+// RevokeToken 注销令牌，并关闭使用该令牌的实时连接
+func (s *PluginService) RevokeToken(token string) error {
+	if err := s.repo.DB.Where("token = ?", hashToken(token)).Delete(&model.PluginAuth{}).Error; err != nil {
+		return err
+	}
+	s.events.CloseSession(hashToken(token), realtime.EventTokenRevoked, map[string]interface{}{"reason": "revoked"})
+	return nil
+}
+
+// Subscribe 为令牌建立实时事件订阅，令牌注销、刷新或过期后订阅随之失效
+func (s *PluginService) Subscribe(auth *model.PluginAuth, cursor uint64) (*realtime.Subscriber, []realtime.Event, uint64, bool) {
+	return s.events.Subscribe(auth.ParkID, auth.Token, auth.ExpiresAt, cursor)
+}
+
+// Unsubscribe 连接断开时取消订阅
+func (s *PluginService) Unsubscribe(sub *realtime.Subscriber) {
+	s.events.Unsubscribe(sub)
+}
+
+// TouchPresence 记录插件在实时连接上的活动
+func (s *PluginService) TouchPresence(parkID uint) {
+	s.events.Touch(parkID)
+}
+
+// WaitEvents 长轮询等待车场的实时事件
+func (s *PluginService) WaitEvents(ctx context.Context, parkID uint, cursor uint64, timeout time.Duration) ([]realtime.Event, uint64, bool) {
+	return s.events.Wait(ctx, parkID, cursor, timeout)
+}
+
+// AuthenticateToken 校验令牌，返回令牌记录（含所属车场和协商结果）
+func (s *PluginService) AuthenticateToken(token string) (*model.PluginAuth, error) {
+	return s.findToken(token)
+}
+
+// EncryptPayload 使用车场密钥派生的密钥加密响应载荷
+func (s *PluginService) EncryptPayload(parkID uint, v interface{}) (*payload.Envelope, error) {
+	key, err := s.payloadKey(parkID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return payload.Seal(key, parkID, data)
+}
+
+// DecryptPayload 解密插件上传的加密载荷
+func (s *PluginService) DecryptPayload(parkID uint, env *payload.Envelope) ([]byte, error) {
+	key, err := s.payloadKey(parkID)
+	if err != nil {
+		return nil, err
+	}
+	return payload.Open(key, parkID, env)
+}
+
+// payloadKey 由车场密钥派生载荷加密密钥
+func (s *PluginService) payloadKey(parkID uint) ([]byte, error) {
+	var park model.Park
+	if err := s.repo.DB.Select("id, secret_key").First(&park, parkID).Error; err != nil {
+		return nil, err
+	}
+	return payload.DeriveKey(park.SecretKey), nil
+}
+
+// findToken 查找未过期的令牌
+func (s *PluginService) findToken(token string) (*model.PluginAuth, error) {
+	if token == "" {
+		return nil, ErrInvalidPluginToken
+	}
+
+	var auth model.PluginAuth
+	err := s.repo.DB.Where("token = ? AND expires_at > ?", hashToken(token), time.Now()).First(&auth).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidPluginToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// issueToken 为车场签发新令牌，同时清理该车场已过期的令牌
+func (s *PluginService) issueToken(tx *gorm.DB, park *model.Park, protocolVersion int, encryption string) (*model.PluginSession, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	if err := tx.Where("park_id = ? AND expires_at <= ?", park.ID, now).Delete(&model.PluginAuth{}).Error; err != nil {
+		return nil, err
+	}
+
+	auth := &model.PluginAuth{
+		ParkID:          park.ID,
+		Token:           hashToken(token),
+		ExpiresAt:       now.Add(s.cfg.Plugin.TokenTTL),
+		ProtocolVersion: protocolVersion,
+		Encryption:      encryption,
+	}
+	if err := tx.Create(auth).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PluginSession{
+		Token:           token,
+		TokenType:       "Bearer",
+		ExpiresAt:       auth.ExpiresAt,
+		ProtocolVersion: protocolVersion,
+		Encryption:      encryption,
+		Park: model.PluginParkInfo{
+			ID:        park.ID,
+			Name:      park.Name,
+			Code:      park.Code,
+			StartTime: park.StartTime,
+			EndTime:   park.EndTime,
+		},
+	}, nil
+}
+
+// hashToken 令牌入库前取 SHA-256 摘要，数据库泄露时无法直接冒用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 增量拉取每页条数
+const (
+	syncPullDefaultLimit = 100
+	syncPullMaxLimit     = 500
+	syncPushMaxChanges   = 200
+)
+
+// errSyncConflict 写入时记录版本已被其他修改更新
+var errSyncConflict = errors.New("version conflict")
+
+// Pull 按游标增量拉取车场的台账变更，dataTypes 为空时拉取全部三类台账
+// 变更序号在锁定车场后分配（见 lockParkChanges），车场内序号顺序与提交顺序一致，游标不会越过未提交的变更
+// 同一记录在一页内多次变更时只返回最后一次，新增和修改均返回记录当前的完整数据
+func (s *PluginService) Pull(parkID uint, cursor uint64, dataTypes []string, limit int) (*model.SyncPullResult, error) {
+	if limit <= 0 {
+		limit = syncPullDefaultLimit
+	}
+	if limit > syncPullMaxLimit {
+		limit = syncPullMaxLimit
+	}
+	for _, dataType := range dataTypes {
+		if _, ok := ledgerTables[dataType]; !ok {
+			return nil, fmt.Errorf("unsupported data type: %s", dataType)
+		}
+	}
+
+	query := s.repo.DB.Where("park_id = ? AND seq > ?", parkID, cursor)
+	if len(dataTypes) > 0 {
+		query = query.Where("data_type IN ?", dataTypes)
+	}
+	var logs []model.SyncChange
+	if err := query.Order("seq").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	// 每条记录只保留本页内的最后一次变更
+	type recordKey struct {
+		dataType string
+		id       uint
+	}
+	last := make(map[recordKey]int, len(logs))
+	ids := make(map[string][]uint)
+	for i, entry := range logs {
+		key := recordKey{entry.DataType, entry.RecordID}
+		if _, seen := last[key]; !seen && entry.Op == model.SyncOpUpsert {
+			ids[entry.DataType] = append(ids[entry.DataType], entry.RecordID)
+		}
+		last[key] = i
+	}
+
+	records := make(map[string]map[uint]model.Ledger, len(ids))
+	for dataType, list := range ids {
+		found, err := findLedgers(s.repo.DB, dataType, parkID, list)
+		if err != nil {
+			return nil, err
+		}
+		records[dataType] = found
+	}
+
+	result := &model.SyncPullResult{
+		ProtocolVersion: model.SyncProtocolVersion,
+		Cursor:          cursor,
+		HasMore:         len(logs) == limit,
+		Changes:         make([]model.SyncRecordChange, 0, len(last)),
+	}
+	for i, entry := range logs {
+		result.Cursor = entry.Seq
+		if last[recordKey{entry.DataType, entry.RecordID}] != i {
+			continue
+		}
+
+		change := model.SyncRecordChange{
+			Seq:      entry.Seq,
+			DataType: entry.DataType,
+			Op:       entry.Op,
+			RecordID: entry.RecordID,
+		}
+		if entry.Op == model.SyncOpUpsert {
+			record, ok := records[entry.DataType][entry.RecordID]
+			if ok {
+				change.Version = record.GetLedgerMeta().Version
+				change.Data = record
+			} else {
+				// 记录已在拉取前被删除，按删除返回
+				change.Op = model.SyncOpDelete
+			}
+		}
+		result.Changes = append(result.Changes, change)
+	}
+
+	return result, nil
+}
+
+// Push 处理插件上传的本地变更，逐条返回处理结果
+// 修改和删除须携带插件最后同步到的版本号，与服务端版本不一致时返回冲突及服务端当前记录
+func (s *PluginService) Push(parkID uint, changes []model.SyncPushChange) ([]model.SyncPushResult, error) {
+	if len(changes) > syncPushMaxChanges {
+		return nil, fmt.Errorf("too many changes, at most %d per request", syncPushMaxChanges)
+	}
+
+	results := make([]model.SyncPushResult, 0, len(changes))
+	for _, change := range changes {
+		results = append(results, s.pushChange(parkID, change))
+	}
+	return results, nil
+}
+
+// pushChange 处理单条上传变更，每条变更在独立事务中执行
+func (s *PluginService) pushChange(parkID uint, change model.SyncPushChange) model.SyncPushResult {
+	result := model.SyncPushResult{
+		ClientRef: change.ClientRef,
+		DataType:  change.DataType,
+		RecordID:  change.RecordID,
+	}
+	reject := func(err error) model.SyncPushResult {
+		result.Status = model.SyncStatusRejected
+		result.Error = err.Error()
+		var fieldErrs validation.Errors
+		if errors.As(err, &fieldErrs) {
+			result.Fields = fieldErrs
+		}
+		return result
+	}
+
+	record, err := newLedger(change.DataType)
+	if err != nil {
+		return reject(err)
+	}
+
+	// 修改和删除先比对版本
+	var existing model.Ledger
+	if change.Op == model.SyncPushUpdate || change.Op == model.SyncPushDelete {
+		existing, _ = newLedger(change.DataType)
+		err := s.repo.DB.Where("park_id = ?", parkID).First(existing, change.RecordID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return reject(fmt.Errorf("记录不存在"))
+		}
+		if err != nil {
+			return reject(err)
+		}
+		if meta := existing.GetLedgerMeta(); meta.Version != change.BaseVersion {
+			result.Status = model.SyncStatusConflict
+			result.Version = meta.Version
+			result.Error = fmt.Sprintf("服务端版本为 %d，与提交的基础版本 %d 不一致", meta.Version, change.BaseVersion)
+			result.Server = existing
+			return result
+		}
+	}
+
+	switch change.Op {
+	case model.SyncPushCreate:
+		if err := json.Unmarshal(change.Data, record); err != nil {
+			return reject(fmt.Errorf("数据格式不正确: %v", err))
+		}
+		record.SetLedgerMeta(model.LedgerMeta{ParkID: parkID})
+		keepServerFields(record, nil)
+		if err := validateLedger(s.repo, change.DataType, record, nil); err != nil {
+			return reject(err)
+		}
+		if err := checkLedgerAttachments(s.files, change.DataType, record, nil); err != nil {
+			return reject(err)
+		}
+		err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit(clause.Associations).Create(record).Error; err != nil {
+				return err
+			}
+			return logChanges(tx, change.DataType, model.SyncOpUpsert, record.GetLedgerMeta().ID)
+		})
+
+	case model.SyncPushUpdate:
+		if err := json.Unmarshal(change.Data, record); err != nil {
+			return reject(fmt.Errorf("数据格式不正确: %v", err))
+		}
+		meta := existing.GetLedgerMeta()
+		meta.Version++
+		record.SetLedgerMeta(meta)
+		keepServerFields(record, existing)
+		if err := validateLedger(s.repo, change.DataType, record, existing); err != nil {
+			return reject(err)
+		}
+		if err := checkLedgerAttachments(s.files, change.DataType, record, existing); err != nil {
+			return reject(err)
+		}
+		err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(record).Where("version = ?", change.BaseVersion).
+				Select("*").Omit(clause.Associations).Updates(record)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errSyncConflict
+			}
+			return logChanges(tx, change.DataType, model.SyncOpUpsert, meta.ID)
+		})
+
+	case model.SyncPushDelete:
+		record = existing
+		err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			if err := logChanges(tx, change.DataType, model.SyncOpDelete, change.RecordID); err != nil {
+				return err
+			}
+			res := tx.Where("version = ?", change.BaseVersion).Delete(existing)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errSyncConflict
+			}
+			return nil
+		})
+
 	default:
-		return fmt.Errorf("unsupported data type")
+		return reject(fmt.Errorf("unsupported op: %s", change.Op))
 	}
 
-	return nil
+	if errors.Is(err, errSyncConflict) {
+		result.Status = model.SyncStatusConflict
+		result.Error = "记录已被其他修改更新，请重新拉取后再提交"
+		return result
+	}
+	if err != nil {
+		return reject(err)
+	}
+
+	meta := record.GetLedgerMeta()
+	result.Status = model.SyncStatusAccepted
+	result.RecordID = meta.ID
+	result.Version = meta.Version
+	return result
+}
+
+// BackfillSyncChanges 为尚无变更日志的存量台账记录补写变更，使插件首次同步时能拉取到全部数据
+func (s *PluginService) BackfillSyncChanges() (int64, error) {
+	var total int64
+	for _, dataType := range model.QRCodeTypes {
+		err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			if err := lockParkChanges(tx); err != nil {
+				return err
+			}
+			res := tx.Exec(fmt.Sprintf(
+				"INSERT INTO sync_changes (park_id, data_type, record_id, op, created_at) "+
+					"SELECT t.park_id, ?, t.id, ?, NOW() FROM %s t "+
+					"WHERE NOT EXISTS (SELECT 1 FROM sync_changes c WHERE c.data_type = ? AND c.record_id = t.id) "+
+					"ORDER BY t.id", ledgerTables[dataType]),
+				dataType, model.SyncOpUpsert, dataType)
+			total += res.RowsAffected
+			return res.Error
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// signingString 待签名字符串，各部分以换行分隔：
+// 请求方法、路径（含查询参数）、时间戳、随机数、请求体的 SHA-256 十六进制摘要
+func signingString(req *model.SignedRequest) string {
+	return strings.Join([]string{
+		strings.ToUpper(req.Method),
+		req.Path,
+		strconv.FormatInt(req.Timestamp, 10),
+		req.Nonce,
+		req.BodyHash,
+	}, "\n")
 }
 
 // generateSignature 生成签名
-func (s *PluginService) generateSignature(secretKey string, timestamp int64) string {
+func (s *PluginService) generateSignature(secretKey, payload string) string {
 	h := hmac.New(sha256.New, []byte(secretKey))
-	h.Write([]byte(fmt.Sprintf("%d", timestamp)))
+	h.Write([]byte(payload))
 	return hex.EncodeToString(h.Sum(nil))
 }
@@ -4,22 +4,53 @@ package service
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
+	"taizhang-server/internal/config"
 	"taizhang-server/internal/model"
+	"taizhang-server/internal/qr"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
+	"taizhang-server/internal/validation"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type QRCodeService struct {
-	repo *repository.Repository
+	repo   *repository.Repository
+	cfg    *config.Config
+	events *realtime.Hub
 }
 
-func NewQRCodeService(repo *repository.Repository) *QRCodeService {
+func NewQRCodeService(repo *repository.Repository, cfg *config.Config, events *realtime.Hub) *QRCodeService {
 	return &QRCodeService{
-		repo: repo,
+		repo:   repo,
+		cfg:    cfg,
+		events: events,
 	}
 }
 
+// 二维码图片尺寸范围（像素）
+const (
+	QRCodeImageMinSize     = 128
+	QRCodeImageMaxSize     = 2048
+	QRCodeImageDefaultSize = 512
+)
+
+// qrcodeTitles 各类型二维码在海报上显示的标题
+var qrcodeTitles = map[string]string{
+	model.QRCodeTypeExternalVehicle: "厂外运输车辆登记",
+	model.QRCodeTypeInternalVehicle: "厂内运输车辆登记",
+	model.QRCodeTypeNonRoad:         "非道路移动机械登记",
+}
+
 func (s *QRCodeService) GetByParkIDAndType(parkID uint, qrcodeType string) (*model.QRCode, error) {
 	var qrcode model.QRCode
 	err := s.repo.DB.Where("park_id = ? AND type = ?", parkID, qrcodeType).First(&qrcode).Error
@@ -30,6 +61,156 @@ func (s *QRCodeService) GetByParkIDAndType(parkID uint, qrcodeType string) (*mod
 }
 
 func (s *QRCodeService) GenerateQRCode(parkID uint, qrcodeType string) (*model.QRCode, error) {
+	var qrcode *model.QRCode
+	err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		qrcode, err = createQRCode(tx, parkID, qrcodeType)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return qrcode, nil
+}
+
+// BackfillQRCodes 为缺少二维码的车场补齐三类二维码，返回涉及的车场数和新生成的二维码数
+func (s *QRCodeService) BackfillQRCodes() (int, int, error) {
+	var parkIDs []uint
+	if err := s.repo.DB.Model(&model.Park{}).Order("id").Pluck("id", &parkIDs).Error; err != nil {
+		return 0, 0, err
+	}
+
+	parks, created := 0, 0
+	for _, parkID := range parkIDs {
+		var n int
+		err := s.repo.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			n, err = provisionQRCodes(tx, parkID)
+			return err
+		})
+		if err != nil {
+			return parks, created, fmt.Errorf("park %d: %w", parkID, err)
+		}
+		if n > 0 {
+			parks++
+			created += n
+		}
+	}
+	return parks, created, nil
+}
+
+// provisionQRCodes 在事务中为车场生成缺少的二维码，返回新生成的数量
+// 先锁定车场记录，同一车场的并发补齐（新建车场、backfill-qrcodes）依次执行，不会重复生成
+func provisionQRCodes(tx *gorm.DB, parkID uint) (int, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&model.Park{}, parkID).Error; err != nil {
+		return 0, err
+	}
+	var existing []string
+	if err := tx.Model(&model.QRCode{}).Where("park_id = ?", parkID).Pluck("type", &existing).Error; err != nil {
+		return 0, err
+	}
+	has := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		has[t] = true
+	}
+
+	created := 0
+	for _, qrcodeType := range model.QRCodeTypes {
+		if has[qrcodeType] {
+			continue
+		}
+		if _, err := createQRCode(tx, parkID, qrcodeType); err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+// MergeDuplicateQRCodes 合并同一车场同一类型的重复二维码，返回合并的数量
+// 保留最早生成的二维码，其余的令牌记入签发记录并作废，已张贴的重复海报扫码时按宽限期处理
+// 须在为 (park_id, type) 建立唯一索引之前执行，没有重复时不做任何修改
+func MergeDuplicateQRCodes(db *gorm.DB) (int, error) {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&model.QRCode{}) {
+		return 0, nil
+	}
+	if err := migrator.AutoMigrate(&model.QRCodeHistory{}); err != nil {
+		return 0, err
+	}
+
+	var groups []struct {
+		ParkID uint
+		Type   string
+		KeepID uint
+	}
+	err := db.Model(&model.QRCode{}).
+		Select("park_id, type, MIN(id) AS keep_id").
+		Group("park_id, type").
+		Having("COUNT(*) > 1").
+		Scan(&groups).Error
+	if err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	for _, g := range groups {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var duplicates []model.QRCode
+			if err := tx.Where("park_id = ? AND type = ? AND id <> ?", g.ParkID, g.Type, g.KeepID).Find(&duplicates).Error; err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, qrcode := range duplicates {
+				var history model.QRCodeHistory
+				err := tx.Where("content = ?", qrcode.Content).First(&history).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					history = model.QRCodeHistory{
+						ParkID:   qrcode.ParkID,
+						Type:     qrcode.Type,
+						Content:  qrcode.Content,
+						IssuedAt: qrcode.CreatedAt,
+					}
+				} else if err != nil {
+					return err
+				}
+				// 签发记录归入保留的二维码，扫码时据此定位
+				history.QRCodeID = g.KeepID
+				if history.RevokedAt == nil {
+					history.RevokedAt = &now
+				}
+				history.RotatedBy = "system"
+				if err := tx.Save(&history).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&model.QRCodeHistory{}).Where("qr_code_id = ?", qrcode.ID).Update("qr_code_id", g.KeepID).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&model.QRCode{}, qrcode.ID).Error; err != nil {
+					return err
+				}
+				merged++
+			}
+			return nil
+		})
+		if err != nil {
+			return merged, fmt.Errorf("park %d %s: %w", g.ParkID, g.Type, err)
+		}
+	}
+	return merged, nil
+}
+
+// createQRCode 在事务中生成二维码，写入默认字段配置和首条签发记录
+func createQRCode(tx *gorm.DB, parkID uint, qrcodeType string) (*model.QRCode, error) {
+	config, err := validation.DefaultFieldsConfig(qrcodeType)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// 生成随机二维码内容
 	content, err := generateRandomContent()
 	if err != nil {
@@ -37,42 +218,254 @@ func (s *QRCodeService) GenerateQRCode(parkID uint, qrcodeType string) (*model.Q
 	}
 
 	qrcode := &model.QRCode{
+		ParkID:       parkID,
+		Type:         qrcodeType,
+		Content:      content,
+		IsEnabled:    true,
+		FieldsConfig: string(data),
+	}
+	if err := tx.Create(qrcode).Error; err != nil {
+		return nil, err
+	}
+
+	err = tx.Create(&model.QRCodeHistory{
+		QRCodeID: qrcode.ID,
 		ParkID:   parkID,
 		Type:     qrcodeType,
 		Content:  content,
-		IsEnabled: true,
-	}
-
-	err = s.repo.DB.Create(qrcode).Error
+		IssuedAt: qrcode.CreatedAt,
+	}).Error
 	if err != nil {
 		return nil, err
 	}
-
 	return qrcode, nil
 }
 
-func (s *QRCodeService) UpdateQRCode(parkID uint, qrcodeType string) (*model.QRCode, error) {
+// UpdateQRCode 更换二维码内容，旧令牌记入签发记录并标记为已作废
+func (s *QRCodeService) UpdateQRCode(parkID uint, qrcodeType, operator string) (*model.QRCode, error) {
 	// 生成新的二维码内容
 	content, err := generateRandomContent()
 	if err != nil {
 		return nil, err
 	}
 
-	// 更新二维码内容
-	err = s.repo.DB.Model(&model.QRCode{}).
-		Where("park_id = ? AND type = ?", parkID, qrcodeType).
-		Update("content", content).Error
+	err = s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		var qrcode model.QRCode
+		if err := tx.Where("park_id = ? AND type = ?", parkID, qrcodeType).First(&qrcode).Error; err != nil {
+			return err
+		}
+
+		// 作废旧令牌，签发记录功能上线前生成的二维码在此补建记录
+		var history model.QRCodeHistory
+		err := tx.Where("content = ?", qrcode.Content).First(&history).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			history = model.QRCodeHistory{
+				QRCodeID: qrcode.ID,
+				ParkID:   qrcode.ParkID,
+				Type:     qrcode.Type,
+				Content:  qrcode.Content,
+				IssuedAt: qrcode.CreatedAt,
+			}
+		} else if err != nil {
+			return err
+		}
+		now := time.Now()
+		history.RevokedAt = &now
+		history.RotatedBy = operator
+		if err := tx.Save(&history).Error; err != nil {
+			return err
+		}
+
+		// 更新二维码内容
+		if err := tx.Model(&qrcode).Update("content", content).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.QRCodeHistory{
+			QRCodeID: qrcode.ID,
+			ParkID:   qrcode.ParkID,
+			Type:     qrcode.Type,
+			Content:  content,
+			IssuedAt: now,
+		}).Error
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	s.events.Publish(parkID, realtime.EventQRCodeRevoked, map[string]interface{}{"type": qrcodeType})
 	return s.GetByParkIDAndType(parkID, qrcodeType)
 }
 
-func (s *QRCodeService) UpdateFieldsConfig(parkID uint, qrcodeType string, fieldsConfig string) error {
-	return s.repo.DB.Model(&model.QRCode{}).
+// ListHistory 获取二维码令牌签发记录，最新签发的在前
+func (s *QRCodeService) ListHistory(parkID uint, qrcodeType string) ([]model.QRCodeHistory, error) {
+	var histories []model.QRCodeHistory
+	err := s.repo.DB.Where("park_id = ? AND type = ?", parkID, qrcodeType).
+		Order("issued_at DESC, id DESC").
+		Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// ListRevokedScans 按旧令牌汇总已作废二维码的扫码情况，最近被扫的在前
+func (s *QRCodeService) ListRevokedScans(parkID uint, qrcodeType string) ([]model.RevokedScanSummary, error) {
+	var summaries []model.RevokedScanSummary
+	err := s.repo.DB.Model(&model.QRCodeScanLog{}).
+		Select("history_id, content, COUNT(*) AS scan_count, SUM(accepted) AS accepted_count, MAX(created_at) AS last_scanned_at").
+		Where("park_id = ? AND type = ?", parkID, qrcodeType).
+		Group("history_id, content").
+		Order("last_scanned_at DESC").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// issuedAt 当前令牌的签发时间，无签发记录时取二维码创建时间
+func (s *QRCodeService) issuedAt(qrcode *model.QRCode) time.Time {
+	var history model.QRCodeHistory
+	if err := s.repo.DB.Select("issued_at").Where("content = ?", qrcode.Content).First(&history).Error; err != nil {
+		return qrcode.CreatedAt
+	}
+	return history.IssuedAt
+}
+
+// RenderImage 将二维码渲染为图片，format 为 png 或 svg，返回图片数据和 Content-Type
+func (s *QRCodeService) RenderImage(parkID uint, qrcodeType, format string, size int) ([]byte, string, error) {
+	if size < QRCodeImageMinSize || size > QRCodeImageMaxSize {
+		return nil, "", fmt.Errorf("图片尺寸须在 %d 到 %d 之间", QRCodeImageMinSize, QRCodeImageMaxSize)
+	}
+	if format != "png" && format != "svg" {
+		return nil, "", errors.New("图片格式仅支持 png 或 svg")
+	}
+
+	qrcode, err := s.GetByParkIDAndType(parkID, qrcodeType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	code, err := qr.Encode([]byte(s.payload(qrcode)), qr.LevelM)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "svg" {
+		return code.SVG(size), "image/svg+xml", nil
+	}
+	data, err := code.PNG(size)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "image/png", nil
+}
+
+// RenderPoster 生成可打印的二维码海报（PDF），返回文件内容和建议的文件名
+func (s *QRCodeService) RenderPoster(parkID uint, qrcodeType string) ([]byte, string, error) {
+	qrcode, err := s.GetByParkIDAndType(parkID, qrcodeType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var park model.Park
+	if err := s.repo.DB.Select("name").First(&park, parkID).Error; err != nil {
+		return nil, "", err
+	}
+
+	// 海报打印后尺寸较大，使用较高纠错等级以容忍污损
+	code, err := qr.Encode([]byte(s.payload(qrcode)), qr.LevelQ)
+	if err != nil {
+		return nil, "", err
+	}
+
+	title := qrcodeTitles[qrcodeType]
+	data := code.PosterPDF(qr.Poster{
+		Title:    park.Name,
+		Subtitle: title,
+		Footer:   "创建时间：" + s.issuedAt(qrcode).Format("2006-01-02 15:04:05"),
+	})
+	return data, fmt.Sprintf("%s-%s.pdf", park.Name, title), nil
+}
+
+// payload 二维码中实际编码的内容：配置了落地页地址时为带令牌的链接，否则为令牌本身
+func (s *QRCodeService) payload(qrcode *model.QRCode) string {
+	if s.cfg == nil || s.cfg.QRCode.BaseURL == "" {
+		return qrcode.Content
+	}
+
+	base := s.cfg.QRCode.BaseURL
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "qrcode=" + url.QueryEscape(qrcode.Content)
+}
+
+// GetFieldsConfig 获取字段配置，未保存时返回该类型的默认模板
+func (s *QRCodeService) GetFieldsConfig(parkID uint, qrcodeType string) (*model.FieldsConfig, error) {
+	return loadFieldsConfig(s.repo, parkID, qrcodeType)
+}
+
+// UpdateFieldsConfig 校验并保存字段配置
+func (s *QRCodeService) UpdateFieldsConfig(parkID uint, qrcodeType string, config *model.FieldsConfig) error {
+	if err := validation.NormalizeFieldsConfig(qrcodeType, config); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.GetByParkIDAndType(parkID, qrcodeType); err != nil {
+		return err
+	}
+	if err := checkParkDepartments(s.repo, parkID, config); err != nil {
+		return err
+	}
+
+	err = s.repo.DB.Model(&model.QRCode{}).
 		Where("park_id = ? AND type = ?", parkID, qrcodeType).
-		Update("fields_config", fieldsConfig).Error
+		Update("fields_config", string(data)).Error
+	if err != nil {
+		return err
+	}
+
+	s.events.Publish(parkID, realtime.EventConfigChanged, map[string]interface{}{"scope": "fields", "type": qrcodeType})
+	return nil
+}
+
+// loadFieldsConfig 读取车场二维码的字段配置，二维码不存在或未保存配置时返回默认模板
+func loadFieldsConfig(repo *repository.Repository, parkID uint, qrcodeType string) (*model.FieldsConfig, error) {
+	config, err := validation.DefaultFieldsConfig(qrcodeType)
+	if err != nil {
+		return nil, err
+	}
+
+	var qrcode model.QRCode
+	err = repo.DB.Select("fields_config").
+		Where("park_id = ? AND type = ?", parkID, qrcodeType).
+		First(&qrcode).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if qrcode.FieldsConfig == "" {
+		return config, nil
+	}
+
+	var saved model.FieldsConfig
+	if err := json.Unmarshal([]byte(qrcode.FieldsConfig), &saved); err != nil {
+		return nil, fmt.Errorf("字段配置格式不正确: %v", err)
+	}
+	// 以当前字段定义为准补全配置；字段定义调整前保存的配置若已不合法则原样使用，未知字段在转换规则时忽略
+	if err := validation.NormalizeFieldsConfig(qrcodeType, &saved); err != nil {
+		log.Printf("Fields config of park %d (%s) is outdated: %v", parkID, qrcodeType, err)
+	}
+	return &saved, nil
 }
 
 // generateRandomContent 生成随机二维码内容
@@ -1,8 +1,14 @@
 package service
 
 import (
+	"log"
+
 	"taizhang-server/internal/config"
+	"taizhang-server/internal/imaging"
+	"taizhang-server/internal/realtime"
 	"taizhang-server/internal/repository"
+	"taizhang-server/internal/storage"
+	"taizhang-server/internal/thirdparty"
 )
 
 type Services struct {
@@ -18,21 +24,44 @@ type Services struct {
 	Department      *DepartmentService
 	MiniProgram     *MiniProgramService
 	Plugin          *PluginService
+	Dispatch        *DispatchService
+	Audit           *AuditService
+	File            *FileService
+	Import          *ImportService
+	Events          *realtime.Hub
 }
 
 func New(repos *repository.Repository, cfg *config.Config) *Services {
+	events := realtime.NewHub()
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	images := imaging.New(cfg.Storage)
+	files := NewFileService(repos, cfg, store, images)
+	vehicleLists := thirdparty.New(cfg.ThirdParty, store, images)
+	audit := NewAuditService(repos, vehicleLists, events)
+	ocr, err := NewOCRProvider(cfg.OCR)
+	if err != nil {
+		log.Printf("Warning: OCR disabled: %v", err)
+	}
 	return &Services{
-		Park:            NewParkService(repos),
+		Park:            NewParkService(repos, events),
 		Renewal:         NewRenewalService(repos),
 		Company:         NewCompanyService(repos),
-		QRCode:          NewQRCodeService(repos),
-		ExternalVehicle: NewExternalVehicleService(repos, cfg),
-		InternalVehicle: NewInternalVehicleService(repos),
-		NonRoad:         NewNonRoadService(repos),
+		QRCode:          NewQRCodeService(repos, cfg, events),
+		ExternalVehicle: NewExternalVehicleService(repos, vehicleLists, files, events),
+		InternalVehicle: NewInternalVehicleService(repos, files, events),
+		NonRoad:         NewNonRoadService(repos, files, events),
 		User:            NewUserService(repos),
 		Role:            NewRoleService(repos),
 		Department:      NewDepartmentService(repos),
-		MiniProgram:     NewMiniProgramService(repos, cfg),
-		Plugin:          NewPluginService(repos),
+		MiniProgram:     NewMiniProgramService(repos, cfg, audit, ocr, vehicleLists, files),
+		Plugin:          NewPluginService(repos, cfg, events, files),
+		Dispatch:        NewDispatchService(repos, events),
+		Audit:           audit,
+		File:            files,
+		Import:          NewImportService(repos, cfg, store, events),
+		Events:          events,
 	}
 }
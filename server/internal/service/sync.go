@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/realtime"
+	"taizhang-server/internal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ledgerTables 各台账类型对应的数据表
+var ledgerTables = map[string]string{
+	model.QRCodeTypeExternalVehicle: "external_vehicles",
+	model.QRCodeTypeInternalVehicle: "internal_vehicles",
+	model.QRCodeTypeNonRoad:         "non_road_machineries",
+}
+
+// newLedger 按数据类型创建空的台账记录
+func newLedger(dataType string) (model.Ledger, error) {
+	switch dataType {
+	case model.QRCodeTypeExternalVehicle:
+		return &model.ExternalVehicle{}, nil
+	case model.QRCodeTypeInternalVehicle:
+		return &model.InternalVehicle{}, nil
+	case model.QRCodeTypeNonRoad:
+		return &model.NonRoadMachinery{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+}
+
+// findLedgers 批量读取车场内的台账记录，按 ID 索引
+func findLedgers(db *gorm.DB, dataType string, parkID uint, ids []uint) (map[uint]model.Ledger, error) {
+	records := make(map[uint]model.Ledger, len(ids))
+	query := db.Where("park_id = ? AND id IN ?", parkID, ids)
+
+	switch dataType {
+	case model.QRCodeTypeExternalVehicle:
+		var list []model.ExternalVehicle
+		if err := query.Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for i := range list {
+			records[list[i].ID] = &list[i]
+		}
+	case model.QRCodeTypeInternalVehicle:
+		var list []model.InternalVehicle
+		if err := query.Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for i := range list {
+			records[list[i].ID] = &list[i]
+		}
+	case model.QRCodeTypeNonRoad:
+		var list []model.NonRoadMachinery
+		if err := query.Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for i := range list {
+			records[list[i].ID] = &list[i]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+	return records, nil
+}
+
+// validateLedger 按数据类型执行字段配置校验
+func validateLedger(repo *repository.Repository, dataType string, record, existing model.Ledger) error {
+	switch r := record.(type) {
+	case *model.ExternalVehicle:
+		e, _ := existing.(*model.ExternalVehicle)
+		return validateExternalVehicle(repo, r, e)
+	case *model.InternalVehicle:
+		e, _ := existing.(*model.InternalVehicle)
+		return validateInternalVehicle(repo, r, e)
+	case *model.NonRoadMachinery:
+		e, _ := existing.(*model.NonRoadMachinery)
+		return validateNonRoadMachinery(repo, r, e)
+	default:
+		return fmt.Errorf("unsupported data type: %s", dataType)
+	}
+}
+
+// checkLedgerAttachments 按记录类型调用 FileService.CheckAttachments，existing 为 nil 表示新增
+func checkLedgerAttachments(files *FileService, dataType string, record, existing model.Ledger) error {
+	var attachments, previous model.Attachments
+	switch r := record.(type) {
+	case *model.ExternalVehicle:
+		attachments = r.Attachments
+		if e, ok := existing.(*model.ExternalVehicle); ok {
+			previous = e.Attachments
+		}
+	case *model.InternalVehicle:
+		attachments = r.Attachments
+		if e, ok := existing.(*model.InternalVehicle); ok {
+			previous = e.Attachments
+		}
+	case *model.NonRoadMachinery:
+		attachments = r.Attachments
+		if e, ok := existing.(*model.NonRoadMachinery); ok {
+			previous = e.Attachments
+		}
+	default:
+		return fmt.Errorf("unsupported data type: %s", dataType)
+	}
+	return files.CheckAttachments(context.Background(), dataType, record.GetLedgerMeta().ParkID, attachments, previous)
+}
+
+// keepServerFields 审核、下发和联网状态由服务端维护，不采用客户端提交的值：
+// existing 为 nil（新增）时置为初始状态，否则沿用服务端记录的值
+func keepServerFields(record, existing model.Ledger) {
+	switch r := record.(type) {
+	case *model.ExternalVehicle:
+		e, _ := existing.(*model.ExternalVehicle)
+		if e == nil {
+			e = &model.ExternalVehicle{AuditStatus: model.AuditStatusPending, DispatchStatus: model.DispatchStatusUndispatched}
+		}
+		r.AuditStatus, r.AuditStep, r.FieldSources = e.AuditStatus, e.AuditStep, e.FieldSources
+		r.DispatchStatus, r.DispatchCount, r.DispatchTime, r.NetworkStatus = e.DispatchStatus, e.DispatchCount, e.DispatchTime, e.NetworkStatus
+	case *model.InternalVehicle:
+		e, _ := existing.(*model.InternalVehicle)
+		if e == nil {
+			e = &model.InternalVehicle{DispatchStatus: model.DispatchStatusUndispatched}
+		}
+		r.DispatchStatus, r.DispatchTime, r.NetworkStatus = e.DispatchStatus, e.DispatchTime, e.NetworkStatus
+	case *model.NonRoadMachinery:
+		e, _ := existing.(*model.NonRoadMachinery)
+		if e == nil {
+			e = &model.NonRoadMachinery{DispatchStatus: model.DispatchStatusUndispatched}
+		}
+		r.DispatchStatus, r.DispatchTime = e.DispatchStatus, e.DispatchTime
+	}
+}
+
+// logChanges 写入同步变更日志，记录所属车场从台账表读取，因此删除操作须在删除记录前调用
+func logChanges(tx *gorm.DB, dataType, op string, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	table, ok := ledgerTables[dataType]
+	if !ok {
+		return fmt.Errorf("unsupported data type: %s", dataType)
+	}
+
+	var rows []struct {
+		ID     uint
+		ParkID uint
+	}
+	if err := tx.Table(table).Select("id, park_id").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	parkIDs := make([]uint, 0, 1)
+	for _, row := range rows {
+		if !slices.Contains(parkIDs, row.ParkID) {
+			parkIDs = append(parkIDs, row.ParkID)
+		}
+	}
+	if err := lockParkChanges(tx, parkIDs...); err != nil {
+		return err
+	}
+
+	changes := make([]model.SyncChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, model.SyncChange{
+			ParkID:   row.ParkID,
+			DataType: dataType,
+			RecordID: row.ID,
+			Op:       op,
+		})
+	}
+	return tx.Create(&changes).Error
+}
+
+// lockParkChanges 分配变更序号前锁定车场，锁持有到事务提交
+// 同一车场的变更事务因此依次分配序号并提交，插件的拉取游标越过某个序号时，车场中更小的序号都已提交
+// 未指定车场时锁定全部车场
+func lockParkChanges(tx *gorm.DB, parkIDs ...uint) error {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&model.Park{}).Order("id")
+	if len(parkIDs) > 0 {
+		query = query.Where("id IN ?", parkIDs)
+	}
+	var locked []uint
+	return query.Pluck("id", &locked).Error
+}
+
+// createLedger 新增台账记录并写入同步变更日志
+func createLedger(repo *repository.Repository, dataType string, record model.Ledger) error {
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		return createLedgerTx(tx, dataType, record)
+	})
+}
+
+// createLedgerTx 在调用方事务内新增台账记录
+func createLedgerTx(tx *gorm.DB, dataType string, record model.Ledger) error {
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	return logChanges(tx, dataType, model.SyncOpUpsert, record.GetLedgerMeta().ID)
+}
+
+// saveLedgerTx 在调用方事务内保存台账记录并写入同步变更日志，调用方负责递增版本号
+func saveLedgerTx(tx *gorm.DB, dataType string, record model.Ledger) error {
+	if err := tx.Save(record).Error; err != nil {
+		return err
+	}
+	return logChanges(tx, dataType, model.SyncOpUpsert, record.GetLedgerMeta().ID)
+}
+
+// updateLedgers 批量更新台账字段，版本号加一并写入同步变更日志
+func updateLedgers(repo *repository.Repository, dataType string, m model.Ledger, ids []uint, updates map[string]interface{}) error {
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		return updateLedgersTx(tx, dataType, m, ids, updates)
+	})
+}
+
+// updateLedgersTx 在调用方事务内批量更新台账字段
+func updateLedgersTx(tx *gorm.DB, dataType string, m model.Ledger, ids []uint, updates map[string]interface{}) error {
+	updates["version"] = gorm.Expr("version + 1")
+	if err := tx.Model(m).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		return err
+	}
+	return logChanges(tx, dataType, model.SyncOpUpsert, ids...)
+}
+
+// deleteLedger 删除台账记录并写入同步变更日志
+// 已下发到车场的记录，提交后通知车场插件删除本地数据，待投递的下发项转入死信
+func deleteLedger(repo *repository.Repository, events *realtime.Hub, dataType string, m model.Ledger, id uint) error {
+	var parkIDs []uint
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := logChanges(tx, dataType, model.SyncOpDelete, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.DispatchItem{}).Where("data_type = ? AND record_id = ?", dataType, id).
+			Distinct().Pluck("park_id", &parkIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.DispatchItem{}).
+			Where("data_type = ? AND record_id = ? AND status = ?", dataType, id, model.DispatchPending).
+			UpdateColumns(map[string]interface{}{"status": model.DispatchDead, "last_error": "记录已删除"}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(m, id).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, parkID := range parkIDs {
+		events.Publish(parkID, realtime.EventRecordDeleted, map[string]interface{}{
+			"data_type":  dataType,
+			"record_ids": []uint{id},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/repository"
+	"taizhang-server/internal/validation"
+)
+
+// loadFieldRules 读取车场二维码的字段配置并转换为校验规则
+func loadFieldRules(repo *repository.Repository, parkID uint, qrcodeType string) (validation.Rules, error) {
+	config, err := loadFieldsConfig(repo, parkID, qrcodeType)
+	if err != nil {
+		return nil, err
+	}
+	return validation.RulesFromConfig(qrcodeType, config), nil
+}
+
+// validateExternalVehicle 按车场字段配置校验厂外运输车辆，并补全车牌颜色等派生字段
+func validateExternalVehicle(repo *repository.Repository, vehicle, existing *model.ExternalVehicle) error {
+	rules, err := loadFieldRules(repo, vehicle.ParkID, model.QRCodeTypeExternalVehicle)
+	if err != nil {
+		return err
+	}
+	return checkExternalVehicle(vehicle, existing, rules)
+}
+
+// checkExternalVehicle 按已读取的规则校验厂外运输车辆
+func checkExternalVehicle(vehicle, existing *model.ExternalVehicle, rules validation.Rules) error {
+	// 核定载质量、准牵引总质量其中一个数据不为空则符合要求；都为空，默认核定载质量40000KG
+	if vehicle.ApprovedLoadMass == nil && vehicle.MaxTowingMass == nil {
+		defaultMass := 40000.0
+		vehicle.ApprovedLoadMass = &defaultMass
+	}
+
+	if err := validation.ValidateExternalVehicle(vehicle, existing, rules); err != nil {
+		return err
+	}
+	return applyPlate(&vehicle.LicensePlate, &vehicle.PlateColor, vehicle.VehicleType, false)
+}
+
+// validateInternalVehicle 按车场字段配置校验厂内运输车辆
+func validateInternalVehicle(repo *repository.Repository, vehicle, existing *model.InternalVehicle) error {
+	rules, err := loadFieldRules(repo, vehicle.ParkID, model.QRCodeTypeInternalVehicle)
+	if err != nil {
+		return err
+	}
+	return checkInternalVehicle(vehicle, existing, rules)
+}
+
+// checkInternalVehicle 按已读取的规则校验厂内运输车辆
+func checkInternalVehicle(vehicle, existing *model.InternalVehicle, rules validation.Rules) error {
+	if err := validation.ValidateInternalVehicle(vehicle, existing, rules); err != nil {
+		return err
+	}
+	return applyPlate(&vehicle.LicensePlate, &vehicle.PlateColor, vehicle.VehicleType, false)
+}
+
+// validateNonRoadMachinery 按车场字段配置校验非道路移动机械
+func validateNonRoadMachinery(repo *repository.Repository, machinery, existing *model.NonRoadMachinery) error {
+	rules, err := loadFieldRules(repo, machinery.ParkID, model.QRCodeTypeNonRoad)
+	if err != nil {
+		return err
+	}
+	return checkNonRoadMachinery(machinery, existing, rules)
+}
+
+// checkNonRoadMachinery 按已读取的规则校验非道路移动机械
+func checkNonRoadMachinery(machinery, existing *model.NonRoadMachinery, rules validation.Rules) error {
+	if err := validation.ValidateNonRoadMachinery(machinery, existing, rules); err != nil {
+		return err
+	}
+	return applyPlate(&machinery.LicensePlate, nil, "", false)
+}
+
+// checkLedger 按已读取的规则校验新增的台账记录，用于批量导入时避免逐条读取字段配置
+func checkLedger(record model.Ledger, rules validation.Rules) error {
+	switch r := record.(type) {
+	case *model.ExternalVehicle:
+		return checkExternalVehicle(r, nil, rules)
+	case *model.InternalVehicle:
+		return checkInternalVehicle(r, nil, rules)
+	case *model.NonRoadMachinery:
+		return checkNonRoadMachinery(r, nil, rules)
+	default:
+		return fmt.Errorf("unsupported ledger type %T", record)
+	}
+}
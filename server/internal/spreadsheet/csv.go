@@ -0,0 +1,59 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// utf8BOM Excel 保存的 UTF-8 CSV 带有字节顺序标记
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// readCSV 读取 CSV 表格，不是有效 UTF-8 的文件按 GB18030（兼容 GBK，中文版 Excel 默认编码）解码
+func readCSV(data []byte, maxRows int) ([][]string, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if !utf8.Valid(data) {
+		decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		data = decoded
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return nil, ErrUnsupported
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows [][]string
+	lastLine := 0 // 上一条记录结束的行
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		// csv.Reader 跳过空行，Excel 打开时空行仍占一行，补齐以保持行号一致
+		line, _ := reader.FieldPos(0)
+		for i := lastLine + 1; i < line; i++ {
+			rows = append(rows, nil)
+		}
+		last := len(record) - 1
+		lastLine, _ = reader.FieldPos(last)
+		lastLine += bytes.Count([]byte(record[last]), []byte("\n"))
+
+		if maxRows > 0 && len(rows) >= maxRows {
+			return nil, ErrTooManyRows
+		}
+		rows = append(rows, record)
+	}
+}
@@ -0,0 +1,90 @@
+package spreadsheet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+	}{
+		{
+			name: "utf-8 with BOM",
+			data: "\xEF\xBB\xBF车牌号码,所有人\r\n京A12345, 北京示例物流 \r\n",
+			want: [][]string{{"车牌号码", "所有人"}, {"京A12345", "北京示例物流"}},
+		},
+		{
+			// 空行保留，行号与 Excel 一致；末尾的空行和空单元格去除
+			name: "blank lines",
+			data: "车牌号码,所有人\n\n京A12345,,\n\n\n",
+			want: [][]string{{"车牌号码", "所有人"}, nil, {"京A12345"}},
+		},
+		{
+			// 引号内的换行不结束记录，其后的行号仍然对应
+			name: "multiline field",
+			data: "住址,电话\n\"北京市\n朝阳区\",138\n\n京B,139\n",
+			want: [][]string{{"住址", "电话"}, {"北京市\n朝阳区", "138"}, nil, {"京B", "139"}},
+		},
+		{
+			name: "ragged rows",
+			data: "a,b,c\nd\ne,f,g,h\n",
+			want: [][]string{{"a", "b", "c"}, {"d"}, {"e", "f", "g", "h"}},
+		},
+		{
+			name: "lazy quotes",
+			data: "品牌\"型号\",1\n",
+			want: [][]string{{"品牌\"型号\"", "1"}},
+		},
+	}
+	for _, tt := range tests {
+		rows, err := Read([]byte(tt.data), 0)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: rows = %q, want %q", tt.name, rows, tt.want)
+		}
+	}
+}
+
+func TestReadCSVGBK(t *testing.T) {
+	data, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("车牌号码,所有人\n京A12345,北京示例物流\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := Read(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"车牌号码", "所有人"}, {"京A12345", "北京示例物流"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestReadCSVRowLimit(t *testing.T) {
+	data := []byte("a\nb\nc\n")
+	if rows, err := Read(data, 3); err != nil || len(rows) != 3 {
+		t.Errorf("Read(maxRows 3) = %q, %v", rows, err)
+	}
+	if _, err := Read(data, 2); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("Read(maxRows 2): err = %v, want ErrTooManyRows", err)
+	}
+	// 空行计入行号
+	if _, err := Read([]byte("a\n\n\nb\n"), 3); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("Read(blank lines, maxRows 3): err = %v, want ErrTooManyRows", err)
+	}
+}
+
+func TestReadCSVBinary(t *testing.T) {
+	if _, err := Read([]byte("a,b\x00c\n"), 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("err = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,56 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnsupported 不支持的表格格式
+	ErrUnsupported = errors.New("unsupported spreadsheet format")
+	// ErrInvalid 表格文件无法解析
+	ErrInvalid = errors.New("invalid spreadsheet")
+	// ErrTooManyRows 表格行数超出上限
+	ErrTooManyRows = errors.New("too many rows")
+)
+
+// Read 读取 XLSX（第一个工作表）或 CSV 表格，返回各行单元格的文本
+// 行号与表格中的行号对应（第 i 行为 rows[i-1]），单元格去除首尾空白，末尾的空行和空单元格去除
+// maxRows 为行数上限，为 0 时不限制
+func Read(data []byte, maxRows int) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		rows, err = readXLSX(data, maxRows)
+	case bytes.HasPrefix(data, []byte("\xD0\xCF\x11\xE0")):
+		// Excel 97-2003 工作簿为 OLE 复合文档
+		return nil, ErrUnsupported
+	default:
+		rows, err = readCSV(data, maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		rows[i] = trimRow(row)
+	}
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+// trimRow 去除行末尾的空单元格
+func trimRow(row []string) []string {
+	n := len(row)
+	for n > 0 && row[n-1] == "" {
+		n--
+	}
+	return row[:n]
+}
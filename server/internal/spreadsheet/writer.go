@@ -0,0 +1,110 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 导出格式
+const (
+	FormatXLSX = "xlsx"
+	FormatCSV  = "csv"
+)
+
+// MaxXLSXRows XLSX 工作表的行数上限（含表头）
+const MaxXLSXRows = 1048576
+
+// Cell 写出的单元格
+type Cell struct {
+	Value  string
+	Number bool // 按数值写出，Value 须为十进制数（仅 XLSX）
+	Link   bool // Value 为超链接地址，写出为可点击的链接（仅 XLSX）
+}
+
+// Text 返回文本单元格
+func Text(value string) Cell {
+	return Cell{Value: value}
+}
+
+// Writer 逐行写出表格，已写出的行不在内存中保留，第一行为表头
+type Writer interface {
+	WriteRow(cells []Cell) error
+	// Close 写出表格的剩余部分，不关闭底层的 io.Writer
+	Close() error
+}
+
+// NewWriter 按格式创建表格写出器，sheet 为 XLSX 工作表名称
+func NewWriter(w io.Writer, format, sheet string) (Writer, error) {
+	switch format {
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet)
+	case FormatCSV:
+		return newCSVWriter(w)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, format)
+}
+
+// ContentType 返回导出格式的 MIME 类型
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// csvWriter 写出带字节顺序标记的 UTF-8 CSV，Excel 据此识别编码
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	return &csvWriter{w: writer}, nil
+}
+
+func (w *csvWriter) WriteRow(cells []Cell) error {
+	w.record = w.record[:0]
+	for _, c := range cells {
+		value := c.Value
+		if !c.Number && !c.Link && isFormulaLike(value) {
+			// 防止以 = + - @ 开头的文本在 Excel 中被当作公式执行
+			value = "'" + value
+		}
+		w.record = append(w.record, value)
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func isFormulaLike(value string) bool {
+	return value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0]))
+}
+
+// sheetName 去除工作表名称中不允许的字符并截断为 31 个字符
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
@@ -0,0 +1,398 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPartSize 工作簿中单个 XML 部件解压后的大小上限，避免压缩炸弹
+const maxPartSize = 256 << 20
+
+// readXLSX 读取工作簿的第一个工作表
+func readXLSX(data []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		parts[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	if parts["xl/workbook.xml"] == nil {
+		return nil, fmt.Errorf("%w: 缺少工作簿", ErrInvalid)
+	}
+
+	sheet, date1904, err := firstSheet(parts)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := sharedStrings(parts["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+	dateStyles, err := dateStyles(parts["xl/styles.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &sheetReader{shared: shared, dateStyles: dateStyles, date1904: date1904, maxRows: maxRows}
+	if err := r.read(sheet); err != nil {
+		return nil, err
+	}
+	return r.rows, nil
+}
+
+// openPart 打开工作簿中的 XML 部件，使用完毕须关闭返回的 Closer
+func openPart(f *zip.File) (*xml.Decoder, io.Closer, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	decoder := xml.NewDecoder(io.LimitReader(rc, maxPartSize))
+	return decoder, rc, nil
+}
+
+// firstSheet 按工作簿中的顺序查找第一个工作表，并返回工作簿是否使用 1904 日期系统
+func firstSheet(parts map[string]*zip.File) (*zip.File, bool, error) {
+	var workbook struct {
+		Properties struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(parts["xl/workbook.xml"], &workbook); err != nil {
+		return nil, false, err
+	}
+	date1904 := workbook.Properties.Date1904 == "1" || workbook.Properties.Date1904 == "true"
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if f := parts["xl/_rels/workbook.xml.rels"]; f != nil && len(workbook.Sheets) > 0 {
+		if err := decodePart(f, &rels); err != nil {
+			return nil, false, err
+		}
+		for _, rel := range rels.Relationships {
+			if rel.ID != workbook.Sheets[0].ID {
+				continue
+			}
+			name := rel.Target
+			if strings.HasPrefix(name, "/") {
+				name = strings.TrimPrefix(name, "/")
+			} else {
+				name = path.Join("xl", name)
+			}
+			if sheet := parts[name]; sheet != nil {
+				return sheet, date1904, nil
+			}
+		}
+	}
+	if sheet := parts["xl/worksheets/sheet1.xml"]; sheet != nil {
+		return sheet, date1904, nil
+	}
+	return nil, false, fmt.Errorf("%w: 缺少工作表", ErrInvalid)
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	decoder, closer, err := openPart(f)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+	}
+	return nil
+}
+
+// sharedStrings 读取共享字符串表，富文本按顺序拼接各段文字，忽略拼音注音
+func sharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+	decoder, closer, err := openPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var strs []string
+	var text strings.Builder
+	inPhonetic := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				if inPhonetic {
+					continue
+				}
+				var s string
+				if err := decoder.DecodeElement(&s, &t); err != nil {
+					return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+				}
+				text.WriteString(s)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, text.String())
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// builtinDateFormats 内置数字格式中的日期时间格式
+var builtinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true, 50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// dateStyles 返回使用日期格式的单元格样式序号
+func dateStyles(f *zip.File) (map[int]bool, error) {
+	if f == nil {
+		return nil, nil
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodePart(f, &styles); err != nil {
+		return nil, err
+	}
+
+	formats := make(map[int]bool, len(builtinDateFormats)+len(styles.NumFmts))
+	for id := range builtinDateFormats {
+		formats[id] = true
+	}
+	for _, numFmt := range styles.NumFmts {
+		formats[numFmt.ID] = isDateFormat(numFmt.Code)
+	}
+	result := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if formats[xf.NumFmtID] {
+			result[i] = true
+		}
+	}
+	return result, nil
+}
+
+// isDateFormat 自定义数字格式是否为日期格式：去除引号内文字、转义字符和颜色等方括号部分后包含年月日占位符
+func isDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '\\' || c == '_' || c == '*':
+			i++
+		case c == '[':
+			inBracket = true
+		case c == ']':
+			inBracket = false
+		case inBracket:
+		case c == 'y' || c == 'Y' || c == 'd' || c == 'D' || c == 'm' || c == 'M':
+			return true
+		}
+	}
+	return false
+}
+
+// sheetReader 逐个读取工作表单元格
+type sheetReader struct {
+	shared     []string
+	dateStyles map[int]bool
+	date1904   bool
+	maxRows    int
+	rows       [][]string
+}
+
+func (r *sheetReader) read(f *zip.File) error {
+	decoder, closer, err := openPart(f)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	current, column := 0, 0 // 当前行号和下一个单元格的列序号
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "row":
+			current++
+			if v, err := strconv.Atoi(attr(start, "r")); err == nil && v > 0 {
+				current = v
+			}
+			column = 0
+		case "c":
+			var c cell
+			if err := decoder.DecodeElement(&c, &start); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+			}
+			if c.Ref != "" {
+				if column, ok = columnIndex(c.Ref); !ok {
+					return fmt.Errorf("%w: 单元格位置错误: %s", ErrInvalid, c.Ref)
+				}
+			}
+			col := column
+			column++
+
+			// 只设置了格式的空单元格和空行不计入行数
+			value := r.value(c)
+			if value == "" {
+				continue
+			}
+			if r.maxRows > 0 && current > r.maxRows {
+				return ErrTooManyRows
+			}
+			for len(r.rows) < max(current, 1) {
+				r.rows = append(r.rows, nil)
+			}
+			row := r.rows[len(r.rows)-1]
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			row[col] = value
+			r.rows[len(r.rows)-1] = row
+		}
+	}
+}
+
+// cell 单元格：t 为类型（s 共享字符串、inlineStr 内联字符串、str 公式字符串、b 布尔、d 日期、e 错误，缺省为数字），s 为样式序号
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  int    `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+func (r *sheetReader) value(c cell) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(r.shared) {
+			return ""
+		}
+		return r.shared[i]
+	case "inlineStr":
+		text := c.Inline.Text
+		for _, run := range c.Inline.Runs {
+			text += run.Text
+		}
+		return text
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "e":
+		return ""
+	case "str":
+		return c.Value
+	case "d":
+		// ISO 8601 日期时间
+		date, _, _ := strings.Cut(c.Value, "T")
+		return date
+	}
+
+	f, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return c.Value
+	}
+	if r.dateStyles[c.Style] {
+		return excelDate(f, r.date1904)
+	}
+	// Excel 按 15 位有效数字存储和显示数值，去除二进制浮点误差
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// excelDate 将 Excel 日期序列值转换为 YYYY-MM-DD，忽略时间部分
+func excelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 61 {
+		// 1900 日期系统将 1900 年误作闰年，3 月 1 日之前的序列值多算了一天
+		serial++
+	}
+	days := math.Floor(serial)
+	return epoch.AddDate(0, 0, int(days)).Format("2006-01-02")
+}
+
+// columnIndex 将单元格位置（如 AB12）的列转换为从 0 开始的序号
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		n++
+	}
+	if n == 0 || n > 3 {
+		return 0, false
+	}
+	return col - 1, true
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
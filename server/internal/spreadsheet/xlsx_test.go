@@ -0,0 +1,201 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const (
+	workbookRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet1.xml"/>
+</Relationships>`
+
+	// 自定义格式 164 为日期，165 的 d 在引号内、166 的 d 在颜色方括号内，均不是日期
+	testStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="3">
+<numFmt numFmtId="164" formatCode="yyyy&quot;年&quot;m&quot;月&quot;d&quot;日&quot;"/>
+<numFmt numFmtId="165" formatCode="&quot;Day &quot;0"/>
+<numFmt numFmtId="166" formatCode="[Red]0.00"/>
+</numFmts>
+<cellXfs count="5">
+<xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/><xf numFmtId="166"/>
+</cellXfs>
+</styleSheet>`
+
+	// 富文本按段拼接，拼音注音（rPh）忽略
+	testSharedStrings = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="4" uniqueCount="4">
+<si><t>车牌号码</t></si>
+<si><r><t>京A</t></r><r><rPr><b/></rPr><t>12345</t></r></si>
+<si><t>北京示例物流</t><rPh sb="0" eb="2"><t>ペキン</t></rPh></si>
+<si><t xml:space="preserve">  有空白  </t></si>
+</sst>`
+)
+
+// workbook 生成工作簿，第一个工作表为 sheet2.xml（工作表关系中的第一项），date1904 为工作簿属性
+func workbook(t *testing.T, sheet string, date1904 bool, extra map[string]string) []byte {
+	t.Helper()
+	props := ""
+	if date1904 {
+		props = `<workbookPr date1904="1"/>`
+	}
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			props + `<sheets><sheet name="台账" sheetId="2" r:id="rId1"/><sheet name="说明" sheetId="1" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": workbookRels,
+		"xl/styles.xml":              testStyles,
+		"xl/sharedStrings.xml":       testSharedStrings,
+		"xl/worksheets/sheet1.xml":   worksheet(`<row r="1"><c r="A1" t="inlineStr"><is><t>不应读取</t></is></c></row>`),
+		"xl/worksheets/sheet2.xml":   worksheet(sheet),
+	}
+	for name, content := range extra {
+		parts[name] = content
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range parts {
+		if content == "" {
+			continue
+		}
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func worksheet(rows string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+func TestReadXLSX(t *testing.T) {
+	sheet := `
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>所有人</t></is></c><c r="C1" t="inlineStr"><is><r><t>注册</t></r><r><t>日期</t></r></is></c></row>
+<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2" t="s"><v>2</v></c><c r="C2" s="1"><v>45352</v></c><c r="E2" s="2"><v>45352.75</v></c></row>
+<row r="4"><c r="B4" t="s"><v>3</v></c><c t="b"><v>1</v></c><c t="b"><v>0</v></c><c r="G4" t="e"><v>#N/A</v></c><c t="str"><v>公式结果</v></c></row>
+<row r="5"><c r="A5"><v>0.30000000000000004</v></c><c r="B5" s="3"><v>7</v></c><c r="C5" s="4"><v>12.5</v></c><c r="D5" t="d"><v>2024-03-01T08:30:00</v></c><c r="AA5"><v>25000</v></c></row>
+<row r="6"><c r="A6" s="1"/><c r="B6" t="s"><v>99</v></c></row>
+<row r="9"><c r="A9" s="1"/></row>`
+
+	rows, err := Read(workbook(t, sheet, false, nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row5 := []string{"0.3", "7", "12.5", "2024-03-01"}
+	for len(row5) < 26 {
+		row5 = append(row5, "")
+	}
+	row5 = append(row5, "25000")
+	want := [][]string{
+		{"车牌号码", "所有人", "注册日期"},
+		{"京A12345", "北京示例物流", "2024-03-01", "", "2024-03-01"},
+		nil, // 第 3 行为空
+		{"", "有空白", "TRUE", "FALSE", "", "", "", "公式结果"},
+		row5,
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows =\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestExcelDate(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{1, false, "1900-01-01"},
+		{59, false, "1900-02-28"},
+		{60, false, "1900-03-01"}, // Excel 中不存在的 1900-02-29
+		{61, false, "1900-03-01"},
+		{45352, false, "2024-03-01"},
+		{45352.999, false, "2024-03-01"},
+		{0, true, "1904-01-01"},
+		{43890, true, "2024-03-01"},
+	}
+	for _, tt := range tests {
+		if got := excelDate(tt.serial, tt.date1904); got != tt.want {
+			t.Errorf("excelDate(%v, %v) = %s, want %s", tt.serial, tt.date1904, got, tt.want)
+		}
+	}
+
+	// 1904 日期系统的工作簿
+	rows, err := Read(workbook(t, `<row r="1"><c r="A1" s="1"><v>43890</v></c></row>`, true, nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"2024-03-01"}}) {
+		t.Errorf("date1904 rows = %q", rows)
+	}
+}
+
+func TestReadXLSXRowLimit(t *testing.T) {
+	sheet := `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><v>2</v></c></row>` +
+		`<row r="3"><c r="A3" s="1"/></row>` // 只设置了格式的空行不计入行数
+	data := workbook(t, sheet, false, nil)
+	if rows, err := Read(data, 2); err != nil || len(rows) != 2 {
+		t.Errorf("Read(maxRows 2) = %q, %v", rows, err)
+	}
+
+	data = workbook(t, sheet+`<row r="3"><c r="B3" t="inlineStr"><is><t>x</t></is></c></row>`, false, nil)
+	if _, err := Read(data, 2); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("Read(3 rows, maxRows 2): err = %v, want ErrTooManyRows", err)
+	}
+	if rows, err := Read(data, 0); err != nil || len(rows) != 3 {
+		t.Errorf("Read(no limit) = %q, %v", rows, err)
+	}
+}
+
+func TestReadXLSXInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"xls", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), ErrUnsupported},
+		{"broken zip", []byte("PK\x03\x04broken"), ErrInvalid},
+		{"no workbook", workbook(t, "", false, map[string]string{"xl/workbook.xml": ""}), ErrInvalid},
+		{"bad cell ref", workbook(t, `<row r="1"><c r="1A"><v>1</v></c></row>`, false, nil), ErrInvalid},
+		{"bad xml", workbook(t, `<row r="1"><c r="A1"><v>1</row>`, false, nil), ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Read(tt.data, 0); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+		ok   bool
+	}{
+		{"A1", 0, true},
+		{"Z9", 25, true},
+		{"AA10", 26, true},
+		{"XFD1048576", 16383, true},
+		{"1A", 0, false},
+		{"ABCD1", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := columnIndex(tt.ref)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("columnIndex(%s) = %d, %v, want %d, %v", tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
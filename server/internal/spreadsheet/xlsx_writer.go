@@ -0,0 +1,195 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFormulaText 公式中文本常量的长度上限，超出的链接写出为普通文本
+const maxFormulaText = 255
+
+// 单元格样式序号，对应 xlsxStyles 中的 cellXfs
+const (
+	styleHeader = 1
+	styleLink   = 2
+)
+
+// xlsxWriter 流式写出只有一个工作表的 XLSX：工作表使用内联字符串，不需要在内存中保留共享字符串表
+// 超链接使用 HYPERLINK 公式，不受工作表超链接数量上限的限制
+type xlsxWriter struct {
+	archive *zip.Writer
+	created time.Time
+	sheet   *bufio.Writer
+	rows    int
+	ref     []byte
+}
+
+func newXLSXWriter(w io.Writer, sheet string) (*xlsxWriter, error) {
+	x := &xlsxWriter{archive: zip.NewWriter(w), created: time.Now()}
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName(sheet)))
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := x.create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (w *xlsxWriter) create(name string) (io.Writer, error) {
+	return w.archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: w.created})
+}
+
+func (w *xlsxWriter) WriteRow(cells []Cell) error {
+	if w.rows >= MaxXLSXRows {
+		return ErrTooManyRows
+	}
+	if w.sheet == nil {
+		// 工作表在写出表头时创建，列宽按表头文字设置
+		f, err := w.create("xl/worksheets/sheet1.xml")
+		if err != nil {
+			return err
+		}
+		w.sheet = bufio.NewWriterSize(f, 64<<10)
+		w.sheet.WriteString(xml.Header)
+		w.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+		w.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+		if len(cells) > 0 {
+			w.sheet.WriteString("<cols>")
+			for i, c := range cells {
+				fmt.Fprintf(w.sheet, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, columnWidth(c.Value))
+			}
+			w.sheet.WriteString("</cols>")
+		}
+		w.sheet.WriteString("<sheetData>")
+	}
+	w.rows++
+
+	row := strconv.Itoa(w.rows)
+	fmt.Fprintf(w.sheet, `<row r="%s">`, row)
+	for i, c := range cells {
+		if c.Value == "" {
+			continue
+		}
+		w.ref = appendColumnName(w.ref[:0], i)
+		w.ref = append(w.ref, row...)
+		switch {
+		case w.rows == 1:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t>`, w.ref, styleHeader)
+			writeText(w.sheet, c.Value)
+			w.sheet.WriteString("</t></is></c>")
+		case c.Number:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>`, w.ref)
+			writeText(w.sheet, c.Value)
+			w.sheet.WriteString("</v></c>")
+		case c.Link && len(c.Value) <= maxFormulaText:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d" t="str"><f>HYPERLINK(&quot;`, w.ref, styleLink)
+			writeText(w.sheet, strings.ReplaceAll(c.Value, `"`, `""`))
+			w.sheet.WriteString("&quot;)</f><v>")
+			writeText(w.sheet, c.Value)
+			w.sheet.WriteString("</v></c>")
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, w.ref)
+			writeText(w.sheet, c.Value)
+			w.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	if w.sheet == nil {
+		if err := w.WriteRow(nil); err != nil {
+			return err
+		}
+	}
+	w.sheet.WriteString("</sheetData></worksheet>")
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// writeText 转义 XML 文本，XML 不允许的控制字符替换为 U+FFFD
+func writeText(w io.Writer, s string) {
+	xml.EscapeText(w, []byte(s))
+}
+
+// appendColumnName 追加从 0 开始的列序号对应的列名（A、B、…、AA）
+func appendColumnName(dst []byte, col int) []byte {
+	if col >= 26 {
+		dst = appendColumnName(dst, col/26-1)
+	}
+	return append(dst, byte('A'+col%26))
+}
+
+// columnWidth 按表头文字估算列宽，中文字符按两个字符宽度计算
+func columnWidth(header string) int {
+	width := 2
+	for _, r := range header {
+		if r >= utf8.RuneSelf {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return max(width, 10)
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles 样式：0 默认，1 表头（加粗），2 链接（蓝色下划线）
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="3">` +
+	`<font><sz val="11"/><name val="宋体"/></font>` +
+	`<font><b/><sz val="11"/><name val="宋体"/></font>` +
+	`<font><u/><sz val="11"/><color rgb="FF0563C1"/><name val="宋体"/></font>` +
+	`</fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
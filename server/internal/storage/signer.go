@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature 下载地址签名不正确
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrURLExpired 下载地址已过期
+	ErrURLExpired = errors.New("url expired")
+)
+
+// Signer 为对象生成限时下载地址，签名包含对象键、车场和过期时间
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), ttl: ttl}
+}
+
+// Sign 返回下载地址的查询参数及过期时间
+func (s *Signer) Sign(key string, parkID uint, now time.Time) (url.Values, time.Time) {
+	return s.SignTTL(key, parkID, now, s.ttl)
+}
+
+// SignTTL 同 Sign，使用指定的有效期
+func (s *Signer) SignTTL(key string, parkID uint, now time.Time, ttl time.Duration) (url.Values, time.Time) {
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	return url.Values{
+		"park_id": {strconv.FormatUint(uint64(parkID), 10)},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {s.signature(key, parkID, expires)},
+	}, expiresAt
+}
+
+// Verify 校验下载地址，返回签名时的车场
+func (s *Signer) Verify(key string, query url.Values, now time.Time) (uint, error) {
+	parkID, err := strconv.ParseUint(query.Get("park_id"), 10, 32)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	expected := s.signature(key, uint(parkID), expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("sig"))) {
+		return 0, ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return 0, ErrURLExpired
+	}
+	return uint(parkID), nil
+}
+
+func (s *Signer) signature(key string, parkID uint, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d\n%d", key, parkID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
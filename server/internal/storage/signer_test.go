@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner("secret", time.Hour)
+	now := time.Date(2024, 3, 1, 8, 0, 0, 500, time.UTC)
+	key := "parks/7/photo.jpg"
+
+	query, expiresAt := signer.Sign(key, 7, now)
+	if want := now.Add(time.Hour).Truncate(time.Second); !expiresAt.Equal(want) {
+		t.Errorf("expiresAt = %v, want %v", expiresAt, want)
+	}
+	if query.Get("park_id") != "7" || query.Get("expires") != "1709283600" {
+		t.Errorf("query = %v", query)
+	}
+
+	// 经 URL 编码往返后仍可校验
+	parsed, err := url.ParseQuery(query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parkID, err := signer.Verify(key, parsed, now)
+	if err != nil || parkID != 7 {
+		t.Fatalf("Verify = %d, %v, want 7", parkID, err)
+	}
+	// 到期的那一秒仍有效，之后过期
+	if _, err := signer.Verify(key, parsed, expiresAt); err != nil {
+		t.Errorf("Verify at expiry: %v", err)
+	}
+	if _, err := signer.Verify(key, parsed, expiresAt.Add(time.Second)); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Verify after expiry: err = %v, want ErrURLExpired", err)
+	}
+
+	short, _ := signer.SignTTL(key, 7, now, time.Minute)
+	if _, err := signer.Verify(key, short, now.Add(2*time.Minute)); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Verify SignTTL after expiry: err = %v, want ErrURLExpired", err)
+	}
+}
+
+func TestSignerVerifyTampered(t *testing.T) {
+	signer := NewSigner("secret", time.Hour)
+	now := time.Now()
+	key := "parks/7/photo.jpg"
+	query, _ := signer.Sign(key, 7, now)
+
+	with := func(name, value string) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = append([]string(nil), v...)
+		}
+		q.Set(name, value)
+		return q
+	}
+	tests := []struct {
+		name  string
+		key   string
+		query url.Values
+	}{
+		{"other key", "parks/7/other.jpg", query},
+		{"thumbnail key", ThumbnailKey(key), query},
+		{"other park", key, with("park_id", "8")},
+		{"extended expiry", key, with("expires", "9999999999")},
+		{"bad signature", key, with("sig", "00")},
+		{"missing park", key, with("park_id", "")},
+		{"malformed expiry", key, with("expires", "tomorrow")},
+	}
+	for _, tt := range tests {
+		if _, err := signer.Verify(tt.key, tt.query, now); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+
+	// 不同密钥签发的地址无效
+	if _, err := NewSigner("other", time.Hour).Verify(key, query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: err = %v, want ErrInvalidSignature", err)
+	}
+}
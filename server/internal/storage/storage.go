@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"taizhang-server/internal/config"
+)
+
+// SharedPrefix 不属于单个车场的对象（如第三方随车清单图片）的键前缀，任一车场均可访问
+const SharedPrefix = "vehicle-lists/"
+
+var (
+	// ErrNotFound 对象不存在
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey 对象键不合法
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object 读取到的对象，使用完毕须关闭 Body
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64 // 未知时为 -1
+}
+
+// Storage 对象存储，键使用“/”分隔，见 ValidateKey
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New 按配置创建对象存储：local 为本地目录，s3 为 S3 兼容的对象存储（阿里云 OSS、MinIO 等）
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "", "local":
+		return NewLocal(cfg.Storage.LocalDir), nil
+	case "s3":
+		return NewS3(cfg.OSS, cfg.Storage.Timeout)
+	}
+	return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Storage.Backend)
+}
+
+// thumbnailSuffix 缩略图键的后缀，缩略图统一为 JPEG
+const thumbnailSuffix = ".thumb.jpg"
+
+// ThumbnailKey 返回图片对应缩略图的键
+func ThumbnailKey(key string) string {
+	return key + thumbnailSuffix
+}
+
+// OriginalKey 返回缩略图对应原图的键，key 不是缩略图时 ok 为 false
+func OriginalKey(key string) (original string, ok bool) {
+	return strings.CutSuffix(key, thumbnailSuffix)
+}
+
+// ParkKey 返回车场对象的键
+func ParkKey(parkID uint, name string) string {
+	return fmt.Sprintf("parks/%d/%s", parkID, name)
+}
+
+// KeyParkID 返回对象所属车场，共享对象返回 0，不属于任何车场时 ok 为 false
+func KeyParkID(key string) (parkID uint, ok bool) {
+	if strings.HasPrefix(key, SharedPrefix) {
+		return 0, true
+	}
+	rest, found := strings.CutPrefix(key, "parks/")
+	if !found {
+		return 0, false
+	}
+	id, _, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// ValidateKey 校验对象键：只允许字母、数字和 . _ - /，不能以“/”开头或包含空段、“.”和“..”段
+func ValidateKey(key string) error {
+	if key == "" || len(key) > 512 {
+		return ErrInvalidKey
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-', r == '/':
+		default:
+			return ErrInvalidKey
+		}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
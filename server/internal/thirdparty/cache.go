@@ -0,0 +1,69 @@
+package thirdparty
+
+import (
+	"sync"
+	"time"
+
+	"taizhang-server/internal/model"
+)
+
+// maxCacheEntries 缓存条目上限，超过时先清理过期条目，仍超过则清空
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	data      model.ThirdPartyVehicleData
+	expiresAt time.Time
+}
+
+// cache 查询结果缓存，ttl 为 0 时不缓存
+type cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// get 返回缓存结果的副本
+func (c *cache) get(key string) (*model.ThirdPartyVehicleData, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	data := entry.data
+	return &data, true
+}
+
+func (c *cache) put(key string, data *model.ThirdPartyVehicleData) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[string]cacheEntry)
+		}
+	}
+	c.entries[key] = cacheEntry{data: *data, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,231 @@
+package thirdparty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"taizhang-server/internal/config"
+	"taizhang-server/internal/imaging"
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/plate"
+	"taizhang-server/internal/storage"
+)
+
+// maxImageSize 随车清单图片大小上限
+const maxImageSize = 10 << 20
+
+// ErrCircuitOpen 第三方接口连续失败已熔断，冷却期内直接返回
+var ErrCircuitOpen = errors.New("随车清单查询服务暂不可用，请稍后重试")
+
+// APIError 第三方接口返回的业务错误（如未查询到车辆），不重试也不计入熔断
+type APIError struct {
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Query 随车清单查询条件
+type Query struct {
+	Plate        string
+	VIN          string
+	EngineNumber string
+	VehicleType  string
+}
+
+// Client 第三方随车清单接口客户端：超时、重试、熔断，并按查询条件缓存查询结果
+// 查询结果中的随车清单图片下载后转存，避免台账引用会过期的 OSS 签名地址
+type Client struct {
+	cfg       config.ThirdPartyConfig
+	http      *http.Client
+	breaker   *breaker
+	cache     *cache
+	store     storage.Storage
+	processor *imaging.Processor
+}
+
+func New(cfg config.ThirdPartyConfig, store storage.Storage, processor *imaging.Processor) *Client {
+	return &Client{
+		cfg:       cfg,
+		store:     store,
+		processor: processor,
+		http:      &http.Client{Timeout: cfg.Timeout},
+		breaker:   newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		cache:     newCache(cfg.CacheTTL),
+	}
+}
+
+// Lookup 查询随车清单数据，命中缓存时不请求第三方接口
+// 缓存键包含全部查询条件；VIN 和发动机号均为空时无法可靠区分车辆，不使用缓存
+func (c *Client) Lookup(ctx context.Context, q Query) (*model.ThirdPartyVehicleData, error) {
+	key := cacheKey(q)
+	if key != "" {
+		if data, ok := c.cache.get(key); ok {
+			return data, nil
+		}
+	}
+
+	if !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	data, err := c.fetch(ctx, q)
+	// 业务错误和调用方取消的请求不说明第三方服务异常，不计入熔断
+	var apiErr *APIError
+	c.breaker.record(err == nil || errors.As(err, &apiErr) || ctx.Err() != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 图片下载失败时仍返回查询结果，但不缓存，避免缓存中的 OSS 地址过期后仍被使用
+	if data.OSSURL != "" {
+		photo, err := c.saveImage(ctx, data.OSSURL)
+		if err != nil {
+			log.Printf("Failed to store vehicle list image for %s: %v", q.VIN, err)
+			return data, nil
+		}
+		data.VehicleListPhoto = photo
+	}
+	if key != "" {
+		c.cache.put(key, data)
+	}
+	return data, nil
+}
+
+// cacheKey 返回查询条件的缓存键，VIN 和发动机号均为空时返回空字符串
+func cacheKey(q Query) string {
+	vin, engine := plate.Normalize(q.VIN), plate.Normalize(q.EngineNumber)
+	if vin == "" && engine == "" {
+		return ""
+	}
+	return strings.Join([]string{vin, engine, plate.Normalize(q.Plate), strings.TrimSpace(q.VehicleType)}, "|")
+}
+
+// fetch 调用第三方接口，网络错误、429 和 5xx 按指数退避重试
+func (c *Client) fetch(ctx context.Context, q Query) (*model.ThirdPartyVehicleData, error) {
+	reqBody := map[string]interface{}{
+		"park_id":     c.cfg.ParkID,
+		"car_number":  q.Plate,
+		"vin":         q.VIN,
+		"motor":       q.EngineNumber,
+		"VehicleType": q.VehicleType,
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	backoff := c.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		body, retry, err = c.post(ctx, jsonData)
+		if err == nil || !retry || attempt >= c.cfg.Retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		State int `json:"state"`
+		Data  struct {
+			OSS          string `json:"oss"`
+			PFJD         string `json:"pfjd"` // 排放阶段
+			VIN          string `json:"vin"`
+			Type         int    `json:"type"`
+			MotorCompany string `json:"motor_company"` // 发动机生产厂
+			MotorXH      string `json:"motor_xh"`      // 发动机型号
+			CPYS         string `json:"cpys"`          // 车牌颜色
+			RLLX         string `json:"rllx"`          // 燃油类型
+		} `json:"data"`
+		Errmsg string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.State != 1 {
+		if result.Errmsg == "" {
+			result.Errmsg = "未查询到随车清单数据"
+		}
+		return nil, &APIError{Message: result.Errmsg}
+	}
+
+	return &model.ThirdPartyVehicleData{
+		OSSURL:             result.Data.OSS,
+		EmissionStandard:   result.Data.PFJD,
+		VIN:                result.Data.VIN,
+		EngineManufacturer: result.Data.MotorCompany,
+		EngineModel:        result.Data.MotorXH,
+		PlateColor:         result.Data.CPYS,
+		FuelType:           result.Data.RLLX,
+	}, nil
+}
+
+// post 发送一次查询请求，retry 表示失败后是否值得重试
+func (c *Client) post(ctx context.Context, jsonData []byte) (body []byte, retry bool, err error) {
+	url := fmt.Sprintf("%s/get_car_data", c.cfg.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("third party API returned status %d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(resp.Body)
+	return body, err == nil, err
+}
+
+// saveImage 下载随车清单图片，处理后与缩略图一起保存到对象存储，按内容命名以便重复查询时复用，返回对象键
+func (c *Client) saveImage(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("image download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageSize {
+		return "", fmt.Errorf("image exceeds %d bytes", maxImageSize)
+	}
+
+	saved, err := c.processor.Save(ctx, c.store, storage.SharedPrefix, data)
+	if err != nil {
+		return "", err
+	}
+	return saved.Key, nil
+}
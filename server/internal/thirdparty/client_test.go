@@ -0,0 +1,88 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"taizhang-server/internal/config"
+)
+
+// fakeVehicleLists 第三方随车清单接口，按车牌返回排放阶段并记录请求次数
+type fakeVehicleLists struct {
+	mu       sync.Mutex
+	requests int
+	stages   map[string]string // 车牌 -> 排放阶段
+}
+
+func (f *fakeVehicleLists) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.mu.Lock()
+	f.requests++
+	stage := f.stages[req["car_number"].(string)]
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"state": 1,
+		"data":  map[string]interface{}{"pfjd": stage, "vin": req["vin"]},
+	})
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(config.ThirdPartyConfig{
+		BaseURL:          server.URL,
+		Timeout:          time.Second,
+		CacheTTL:         time.Minute,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	}, nil, nil)
+}
+
+func TestLookupCacheKey(t *testing.T) {
+	fake := &fakeVehicleLists{stages: map[string]string{"京A12345": "国五", "京B67890": "国六", "京C11111": "国四"}}
+	c := newTestClient(t, fake)
+	ctx := context.Background()
+
+	lookup := func(q Query) string {
+		t.Helper()
+		data, err := c.Lookup(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data.EmissionStandard
+	}
+
+	// 同一车辆重复查询命中缓存，VIN 大小写和空白不影响
+	if got := lookup(Query{Plate: "京A12345", VIN: "LFWSRXSJ5J1A12345", EngineNumber: "E1"}); got != "国五" {
+		t.Fatalf("first lookup = %s", got)
+	}
+	if got := lookup(Query{Plate: "京A12345", VIN: " lfwsrxsj5j1a12345", EngineNumber: "E1"}); got != "国五" || fake.requests != 1 {
+		t.Errorf("cached lookup = %s, requests = %d, want 1", got, fake.requests)
+	}
+
+	// VIN 和发动机号均为空（字段配置隐藏）时不共用缓存，按车牌分别查询
+	if got := lookup(Query{Plate: "京A12345"}); got != "国五" {
+		t.Errorf("plate A = %s", got)
+	}
+	if got := lookup(Query{Plate: "京B67890"}); got != "国六" {
+		t.Errorf("plate B = %s, want 国六 (not vehicle A's data)", got)
+	}
+	if got := lookup(Query{Plate: "京B67890"}); got != "国六" || fake.requests != 4 {
+		t.Errorf("uncached lookup = %s, requests = %d, want 4", got, fake.requests)
+	}
+
+	// 只有发动机号时按全部条件缓存，车牌不同的车辆不命中
+	if got := lookup(Query{Plate: "京C11111", EngineNumber: "E9"}); got != "国四" {
+		t.Errorf("plate C = %s", got)
+	}
+	if got := lookup(Query{Plate: "京B67890", EngineNumber: "E9"}); got != "国六" || fake.requests != 6 {
+		t.Errorf("same engine, other plate = %s, requests = %d, want 6", got, fake.requests)
+	}
+}
@@ -0,0 +1,157 @@
+package validation
+
+import (
+	"fmt"
+
+	"taizhang-server/internal/model"
+)
+
+var (
+	companyFeature         = model.FeatureSetting{Key: model.FeatureCompany, Label: "公司管理"}
+	entryNoticeFeature     = model.FeatureSetting{Key: model.FeatureEntryNotice, Label: "入厂通知"}
+	departmentAuditFeature = model.FeatureSetting{Key: model.FeatureDepartmentAudit, Label: "部门审核"}
+	autoDispatchFeature    = model.FeatureSetting{Key: model.FeatureAutoDispatch, Label: "自动下发", Enabled: true}
+)
+
+// features 按二维码类型可配置的功能开关
+var features = map[string][]model.FeatureSetting{
+	model.QRCodeTypeExternalVehicle: {companyFeature, entryNoticeFeature, departmentAuditFeature},
+	model.QRCodeTypeInternalVehicle: {companyFeature, entryNoticeFeature, autoDispatchFeature},
+	model.QRCodeTypeNonRoad:         {companyFeature, entryNoticeFeature, autoDispatchFeature},
+}
+
+// SupportedType 是否为支持字段配置的二维码类型
+func SupportedType(qrcodeType string) bool {
+	_, ok := schemas[qrcodeType]
+	return ok
+}
+
+// DefaultFieldsConfig 返回指定类型的默认字段配置模板
+// 厂外运输车辆默认启用字段配置，厂内运输车辆和非道路移动机械默认不启用
+func DefaultFieldsConfig(qrcodeType string) (*model.FieldsConfig, error) {
+	s, ok := schemas[qrcodeType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的二维码类型: %s", qrcodeType)
+	}
+
+	config := &model.FieldsConfig{
+		Enabled:  qrcodeType == model.QRCodeTypeExternalVehicle,
+		Fields:   make([]model.FieldSetting, 0, len(s)),
+		Features: append([]model.FeatureSetting(nil), features[qrcodeType]...),
+	}
+	for _, f := range s {
+		config.Fields = append(config.Fields, model.FieldSetting{
+			Key:      f.Key,
+			Label:    f.Label,
+			Visible:  true,
+			Required: f.Required,
+		})
+	}
+	return config, nil
+}
+
+// NormalizeFieldsConfig 校验字段配置，未提交的字段和功能按默认模板补全，标签和顺序以字段定义为准
+func NormalizeFieldsConfig(qrcodeType string, config *model.FieldsConfig) error {
+	defaults, err := DefaultFieldsConfig(qrcodeType)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+
+	// 改为照片附件前保存的配置，照片字段按对应的照片类型处理
+	for i, f := range config.Fields {
+		if kind, ok := model.LegacyPhotoFields[f.Key]; ok {
+			config.Fields[i].Key = kind
+		}
+	}
+
+	fields := make(map[string]model.FieldSetting, len(config.Fields))
+	for _, f := range config.Fields {
+		if _, dup := fields[f.Key]; dup {
+			errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: fmt.Sprintf("字段重复配置: %s", f.Key)})
+			continue
+		}
+		fields[f.Key] = f
+	}
+	for i, d := range defaults.Fields {
+		f, ok := fields[d.Key]
+		if !ok {
+			continue
+		}
+		delete(fields, d.Key)
+		if f.Required && !f.Visible {
+			errs = append(errs, FieldError{Field: d.Key, Label: d.Label, Message: d.Label + "未显示时不能设为必填"})
+		}
+		defaults.Fields[i].Visible = f.Visible
+		defaults.Fields[i].Required = f.Required
+	}
+	for _, f := range config.Fields {
+		if _, unknown := fields[f.Key]; unknown {
+			errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: fmt.Sprintf("未知字段: %s", f.Key)})
+			delete(fields, f.Key)
+		}
+	}
+
+	known := make(map[string]int, len(defaults.Features))
+	for i, d := range defaults.Features {
+		known[d.Key] = i
+	}
+	for _, f := range config.Features {
+		i, ok := known[f.Key]
+		if !ok {
+			errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: fmt.Sprintf("未知功能: %s", f.Key)})
+			continue
+		}
+		defaults.Features[i].Enabled = f.Enabled
+		defaults.Features[i].Content = f.Content
+		if f.Key == model.FeatureDepartmentAudit {
+			if msg := checkAuditDepartments(f); msg != "" {
+				errs = append(errs, FieldError{Field: f.Key, Label: defaults.Features[i].Label, Message: msg})
+				continue
+			}
+			defaults.Features[i].Departments = f.Departments
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	defaults.Enabled = config.Enabled
+	*config = *defaults
+	return nil
+}
+
+// checkAuditDepartments 部门审核启用时须至少指定一个部门，且同一部门不能重复审核
+func checkAuditDepartments(f model.FeatureSetting) string {
+	if f.Enabled && len(f.Departments) == 0 {
+		return "启用部门审核时须指定审核部门"
+	}
+	seen := make(map[uint]bool, len(f.Departments))
+	for _, id := range f.Departments {
+		if seen[id] {
+			return fmt.Sprintf("审核部门重复: %d", id)
+		}
+		seen[id] = true
+	}
+	return ""
+}
+
+// RulesFromConfig 将字段配置转换为校验规则，未启用字段配置时使用默认规则
+func RulesFromConfig(qrcodeType string, config *model.FieldsConfig) Rules {
+	rules := DefaultRules(qrcodeType)
+	if config == nil || !config.Enabled {
+		return rules
+	}
+	for _, f := range config.Fields {
+		key := f.Key
+		if kind, ok := model.LegacyPhotoFields[key]; ok {
+			key = kind
+		}
+		if _, ok := rules[key]; ok {
+			rules[key] = Rule{Visible: f.Visible, Required: f.Visible && f.Required}
+		}
+	}
+	return rules
+}
@@ -0,0 +1,191 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"taizhang-server/internal/model"
+	"taizhang-server/internal/plate"
+)
+
+var (
+	datePattern  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	phonePattern = regexp.MustCompile(`^1\d{10}$`)
+)
+
+// externalVehicleSchema 厂外运输车辆字段
+var externalVehicleSchema = schema{
+	{Key: "company_id", Label: "公司"},
+	{Key: "license_plate", Label: "车牌号码", Required: true, Check: plate.Validate},
+	{Key: "plate_color", Label: "号牌颜色"},
+	{Key: "vehicle_type", Label: "车辆类型", Required: true, Check: checkVehicleType},
+	{Key: "vin", Label: "车辆识别代号", Required: true, Check: checkVIN},
+	{Key: "register_date", Label: "注册日期", Required: true, Check: checkDate},
+	{Key: "brand_model", Label: "品牌型号", Required: true},
+	{Key: "fuel_type", Label: "燃料类型"},
+	{Key: "emission_standard", Label: "排放阶段"},
+	{Key: "usage_nature", Label: "使用性质", Required: true},
+	{Key: "engine_number", Label: "发动机号码"},
+	{Key: "engine_model", Label: "发动机型号"},
+	{Key: "engine_manufacturer", Label: "发动机制造商"},
+	{Key: "total_mass", Label: "总质量"},
+	{Key: "curb_mass", Label: "整备质量"},
+	{Key: "approved_load_mass", Label: "核定载质量"},
+	{Key: "max_towing_mass", Label: "准牵引质量"},
+	{Key: "phone", Label: "手机号码", Check: checkPhone},
+	{Key: "is_obd_enabled", Label: "安装OBD"},
+	{Key: "address", Label: "住址", Required: true},
+	{Key: "issue_date", Label: "发证日期", Required: true, Check: checkDate},
+	{Key: "owner", Label: "所有人", Required: true},
+	{Key: "fleet_name", Label: "车队名称"},
+	{Key: "inbound_cargo_name", Label: "进厂运输货物名称"},
+	{Key: "inbound_cargo_weight", Label: "进厂运输量"},
+	{Key: "outbound_cargo_name", Label: "出厂运输货物名称"},
+	{Key: "outbound_cargo_weight", Label: "出厂运输量"},
+	{Key: model.AttachmentDrivingLicenseMain, Label: "行驶证主页", Attachment: true},
+	{Key: model.AttachmentDrivingLicenseSub, Label: "行驶证副页", Attachment: true},
+	{Key: model.AttachmentVehicleFront, Label: "车头照片", Attachment: true},
+	{Key: model.AttachmentVehicleList, Label: "随车清单", Attachment: true},
+}
+
+// internalVehicleSchema 厂内运输车辆字段
+var internalVehicleSchema = schema{
+	{Key: "environmental_code", Label: "环保登记编码"},
+	{Key: "vin", Label: "车辆识别代号", Check: checkVIN},
+	{Key: "production_date", Label: "生产日期", Check: checkDate},
+	{Key: "license_plate", Label: "车牌号码", Check: plate.Validate},
+	{Key: "register_date", Label: "注册登记日期", Check: checkDate},
+	{Key: "brand_model", Label: "车辆品牌型号"},
+	{Key: "fuel_type", Label: "燃料类型"},
+	{Key: "emission_standard", Label: "排放标准"},
+	{Key: "usage_nature", Label: "使用性质"},
+	{Key: "owner", Label: "车辆所有人（单位）"},
+	{Key: "vehicle_type", Label: "车辆类型"},
+	{Key: "plate_color", Label: "车牌颜色"},
+	{Key: "engine_number", Label: "发动机号码"},
+	{Key: "local_environmental_code", Label: "地标环保登记编码"},
+	{Key: "approved_load_mass", Label: "核定载质量"},
+	{Key: "max_towing_mass", Label: "准牵引质量"},
+	{Key: "address", Label: "住址"},
+	{Key: "issue_date", Label: "发证日期", Check: checkDate},
+	{Key: model.AttachmentVehicleList, Label: "随车清单", Attachment: true},
+	{Key: model.AttachmentDrivingLicenseMain, Label: "行驶证主页", Attachment: true},
+	{Key: model.AttachmentDrivingLicenseSub, Label: "行驶证副页", Attachment: true},
+	{Key: model.AttachmentVehicleFront, Label: "车头照片", Attachment: true},
+}
+
+// nonRoadSchema 非道路移动机械字段
+var nonRoadSchema = schema{
+	{Key: "environmental_code", Label: "环保登记编码"},
+	{Key: "production_date", Label: "机械生产日期", Check: checkDate},
+	{Key: "license_plate", Label: "车牌号码", Check: plate.Validate},
+	{Key: "emission_standard", Label: "排放标准"},
+	{Key: "fuel_type", Label: "燃料类型"},
+	{Key: "machinery_type", Label: "机械种类"},
+	{Key: "pin", Label: "机械环保代码/产品识别码"},
+	{Key: "machinery_model", Label: "机械型号"},
+	{Key: "engine_model", Label: "发动机型号"},
+	{Key: "engine_manufacturer", Label: "发动机生产厂"},
+	{Key: "engine_number", Label: "发动机编号"},
+	{Key: "engine_power", Label: "发动机额定净功率"},
+	{Key: "owner", Label: "所属人（单位）"},
+	{Key: "environmental_info_number", Label: "环保信息公开编号"},
+	{Key: "register_date", Label: "登记日期", Check: checkDate},
+	{Key: "machinery_manufacturer", Label: "机械制造厂"},
+	{Key: "local_environmental_code", Label: "地标环保登记编码"},
+	{Key: "entry_date", Label: "入场日期", Check: checkDate},
+	{Key: model.AttachmentMachineNameplate, Label: "整车（机）铭牌", Attachment: true},
+	{Key: model.AttachmentEngineNameplate, Label: "发动机铭牌", Attachment: true},
+	{Key: model.AttachmentEnvironmentalLabel, Label: "机械环保信息标", Attachment: true},
+	{Key: model.AttachmentDevice, Label: "设备照片", Attachment: true},
+}
+
+// schemas 按二维码类型索引的字段定义
+var schemas = map[string]schema{
+	model.QRCodeTypeExternalVehicle: externalVehicleSchema,
+	model.QRCodeTypeInternalVehicle: internalVehicleSchema,
+	model.QRCodeTypeNonRoad:         nonRoadSchema,
+}
+
+// DefaultRules 返回指定类型未配置字段时使用的默认规则
+func DefaultRules(qrcodeType string) Rules {
+	return schemas[qrcodeType].defaults()
+}
+
+// FieldLabel 返回字段的中文名，未定义的字段返回字段名
+func FieldLabel(qrcodeType, key string) string {
+	if f, ok := schemas[qrcodeType].field(key); ok {
+		return f.Label
+	}
+	return key
+}
+
+// IsAttachment 字段是否为照片附件
+func IsAttachment(qrcodeType, key string) bool {
+	f, ok := schemas[qrcodeType].field(key)
+	return ok && f.Attachment
+}
+
+// ValidateExternalVehicle 校验厂外运输车辆，existing 为更新前的记录（创建时为 nil）
+func ValidateExternalVehicle(vehicle, existing *model.ExternalVehicle, rules Rules) error {
+	if existing == nil {
+		return externalVehicleSchema.validate(vehicle, nil, rules)
+	}
+	return externalVehicleSchema.validate(vehicle, existing, rules)
+}
+
+// CheckExternalVehicleFields 对厂外运输车辆的指定字段做格式校验，用于核对证照识别结果
+func CheckExternalVehicleFields(vehicle *model.ExternalVehicle, keys []string) Errors {
+	return externalVehicleSchema.check(vehicle, keys)
+}
+
+// ValidateInternalVehicle 校验厂内运输车辆，existing 为更新前的记录（创建时为 nil）
+func ValidateInternalVehicle(vehicle, existing *model.InternalVehicle, rules Rules) error {
+	if existing == nil {
+		return internalVehicleSchema.validate(vehicle, nil, rules)
+	}
+	return internalVehicleSchema.validate(vehicle, existing, rules)
+}
+
+// ValidateNonRoadMachinery 校验非道路移动机械，existing 为更新前的记录（创建时为 nil）
+func ValidateNonRoadMachinery(machinery, existing *model.NonRoadMachinery, rules Rules) error {
+	if existing == nil {
+		return nonRoadSchema.validate(machinery, nil, rules)
+	}
+	return nonRoadSchema.validate(machinery, existing, rules)
+}
+
+func checkDate(value string) error {
+	if !datePattern.MatchString(value) {
+		return fmt.Errorf("日期格式不正确，应为YYYY-MM-DD")
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return fmt.Errorf("日期不正确")
+	}
+	return nil
+}
+
+func checkVIN(value string) error {
+	if utf8.RuneCountInString(value) != 17 {
+		return fmt.Errorf("车辆识别代号必须是17位")
+	}
+	return nil
+}
+
+func checkVehicleType(value string) error {
+	// 车辆类型最后一位字符必须是"车"
+	if !strings.HasSuffix(value, "车") {
+		return fmt.Errorf("车辆类型错误，最后一位必须是'车'")
+	}
+	return nil
+}
+
+func checkPhone(value string) error {
+	if !phonePattern.MatchString(value) {
+		return fmt.Errorf("手机号码格式不正确")
+	}
+	return nil
+}
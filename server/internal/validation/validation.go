@@ -0,0 +1,238 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"taizhang-server/internal/model"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`   // 字段名（与 JSON 字段一致）
+	Label   string `json:"label"`   // 字段中文名
+	Message string `json:"message"` // 错误信息
+}
+
+// Errors 字段校验错误集合
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "；")
+}
+
+// Rule 字段显示/必填规则
+type Rule struct {
+	Visible  bool `json:"visible"`
+	Required bool `json:"required"`
+}
+
+// Rules 按字段名索引的规则，未配置的字段使用默认规则
+type Rules map[string]Rule
+
+// field 可配置字段定义
+type field struct {
+	Key      string
+	Label    string
+	Required bool               // 默认是否必填
+	Check    func(string) error // 格式校验，仅对非空的字符串字段生效
+
+	Attachment bool // 照片附件，Key 为照片类型，存放于记录的 attachments 字段
+}
+
+// schema 某一类记录的字段定义
+type schema []field
+
+// defaults 返回该类记录的默认规则
+func (s schema) defaults() Rules {
+	rules := make(Rules, len(s))
+	for _, f := range s {
+		rules[f.Key] = Rule{Visible: true, Required: f.Required}
+	}
+	return rules
+}
+
+// validate 按规则校验记录：隐藏字段不可由提交方修改，必填字段不能为空，非空字段需通过格式校验
+// existing 为更新前的记录，创建时为 nil
+func (s schema) validate(record, existing interface{}, rules Rules) error {
+	values := jsonFields(record)
+	var previous map[string]reflect.Value
+	if existing != nil {
+		previous = jsonFields(existing)
+	}
+
+	var errs Errors
+	for _, f := range s {
+		value, ok := values[f.Key]
+		if !ok || f.Attachment {
+			continue
+		}
+
+		rule := s.rule(f, rules)
+
+		if !rule.Visible {
+			if old, ok := previous[f.Key]; ok {
+				value.Set(old)
+			} else {
+				value.Set(reflect.Zero(value.Type()))
+			}
+			continue
+		}
+
+		if isEmpty(value) {
+			if rule.Required {
+				errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: f.Label + "不能为空"})
+			}
+			continue
+		}
+
+		if f.Check != nil && value.Kind() == reflect.String {
+			if err := f.Check(value.String()); err != nil {
+				message := err.Error()
+				if !strings.HasPrefix(message, f.Label) {
+					message = f.Label + "：" + message
+				}
+				errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: message})
+			}
+		}
+	}
+
+	errs = append(errs, s.validateAttachments(values, previous, rules)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateAttachments 按各照片类型的规则校验照片附件，规则同普通字段；不支持的类型和重复的类型视为错误
+// 校验通过后附件按字段定义的顺序排列
+func (s schema) validateAttachments(values, previous map[string]reflect.Value, rules Rules) Errors {
+	value, ok := values["attachments"]
+	if !ok {
+		return nil
+	}
+	submitted := value.Interface().(model.Attachments)
+	var old model.Attachments
+	if v, ok := previous["attachments"]; ok {
+		old = v.Interface().(model.Attachments)
+	}
+
+	var errs Errors
+	byKind := make(map[string]model.Attachment, len(submitted))
+	for _, attachment := range submitted {
+		f, ok := s.field(attachment.Kind)
+		if !ok || !f.Attachment {
+			errs = append(errs, FieldError{Field: "attachments", Label: "照片", Message: fmt.Sprintf("不支持的照片类型: %s", attachment.Kind)})
+			continue
+		}
+		if _, dup := byKind[attachment.Kind]; dup {
+			errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: f.Label + "重复上传"})
+			continue
+		}
+		attachment.Key = strings.TrimSpace(attachment.Key)
+		byKind[attachment.Kind] = attachment
+	}
+
+	var result model.Attachments
+	for _, f := range s {
+		if !f.Attachment {
+			continue
+		}
+		rule := s.rule(f, rules)
+		if !rule.Visible {
+			if key := old.Get(f.Key); key != "" {
+				result = append(result, model.Attachment{Kind: f.Key, Key: key})
+			}
+			continue
+		}
+		attachment, ok := byKind[f.Key]
+		if !ok || attachment.Key == "" {
+			if rule.Required {
+				errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: f.Label + "不能为空"})
+			}
+			continue
+		}
+		result = append(result, attachment)
+	}
+	value.Set(reflect.ValueOf(result))
+	return errs
+}
+
+// rule 返回字段的规则，未配置时使用默认规则
+func (s schema) rule(f field, rules Rules) Rule {
+	if rule, ok := rules[f.Key]; ok {
+		return rule
+	}
+	return Rule{Visible: true, Required: f.Required}
+}
+
+// field 按 Key 查找字段定义
+func (s schema) field(key string) (field, bool) {
+	for _, f := range s {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// check 只对指定字段做格式校验，不检查显示和必填规则
+func (s schema) check(record interface{}, keys []string) Errors {
+	values := jsonFields(record)
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	var errs Errors
+	for _, f := range s {
+		value, ok := values[f.Key]
+		if !ok || !wanted[f.Key] || f.Check == nil || value.Kind() != reflect.String || isEmpty(value) {
+			continue
+		}
+		if err := f.Check(value.String()); err != nil {
+			message := err.Error()
+			if !strings.HasPrefix(message, f.Label) {
+				message = f.Label + "：" + message
+			}
+			errs = append(errs, FieldError{Field: f.Key, Label: f.Label, Message: message})
+		}
+	}
+	return errs
+}
+
+// jsonFields 按 JSON 字段名返回结构体字段的可写值
+func jsonFields(record interface{}) map[string]reflect.Value {
+	v := reflect.ValueOf(record)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	fields := make(map[string]reflect.Value, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = v.Field(i)
+	}
+	return fields
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
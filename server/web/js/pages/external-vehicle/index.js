@@ -14,8 +14,10 @@ const ExternalVehicleManagement = {
                         </el-form-item>
                         <el-form-item label="审核状态">
                             <el-select v-model="searchForm.auditStatus" placeholder="请选择" clearable>
-                                <el-option label="已审核" value="approved" />
-                                <el-option label="未审核" value="pending" />
+                                <el-option label="已通过" value="approved" />
+                                <el-option label="待审核" value="pending" />
+                                <el-option label="已驳回" value="rejected" />
+                                <el-option label="重新提交" value="resubmitted" />
                             </el-select>
                         </el-form-item>
                         <el-form-item label="下发状态">
@@ -46,8 +48,8 @@ const ExternalVehicleManagement = {
                     <el-table-column prop="emissionStandard" label="排放标准" width="100" />
                     <el-table-column prop="auditStatus" label="审核状态" width="100" align="center">
                         <template #default="scope">
-                            <el-tag :type="scope.row.auditStatus === 'approved' ? 'success' : 'warning'">
-                                {{ scope.row.auditStatus === 'approved' ? '已审核' : '未审核' }}
+                            <el-tag :type="auditStatusTag(scope.row.auditStatus)">
+                                {{ auditStatusLabel(scope.row.auditStatus) }}
                             </el-tag>
                         </template>
                     </el-table-column>
@@ -60,7 +62,8 @@ const ExternalVehicleManagement = {
                     </el-table-column>
                     <el-table-column label="操作" width="200" fixed="right" align="center">
                         <template #default="scope">
-                            <el-button type="warning" size="small" @click="audit(scope.row)" v-if="scope.row.auditStatus !== 'approved'">审核</el-button>
+                            <el-button type="warning" size="small" @click="audit(scope.row)" v-if="isReviewable(scope.row)">审核</el-button>
+                            <el-button type="danger" size="small" @click="reject(scope.row)" v-if="isReviewable(scope.row)">驳回</el-button>
                             <el-button type="success" size="small" @click="dispatch(scope.row)" v-if="scope.row.auditStatus === 'approved'">下发</el-button>
                             <el-button type="primary" size="small" @click="viewDetail(scope.row)">详情</el-button>
                         </template>
@@ -96,10 +99,14 @@ const ExternalVehicleManagement = {
         search() { this.pagination.page = 1; this.loadList(); },
         resetSearch() { this.searchForm = { plateNumber: '', auditStatus: '', dispatchStatus: '' }; this.search(); },
         handleSelectionChange(val) { this.selection = val; },
-        async audit(row) { try { const result = await request('/external-vehicles/audit', { method: 'POST', body: JSON.stringify({ ids: [row.id], status: 'approved' }) }); if (result.code === 0) { ElMessage.success('审核成功'); this.loadList(); } } catch (error) { console.error('Audit failed:', error); } },
-        async batchAudit() { try { const ids = this.selection.map(item => item.id); const result = await request('/external-vehicles/audit', { method: 'POST', body: JSON.stringify({ ids, status: 'approved' }) }); if (result.code === 0) { ElMessage.success('批量审核成功'); this.loadList(); } } catch (error) { console.error('Batch audit failed:', error); } },
+        auditStatusLabel(status) { return ({ approved: '已通过', pending: '待审核', rejected: '已驳回', resubmitted: '重新提交' })[status] || '待审核'; },
+        auditStatusTag(status) { return ({ approved: 'success', rejected: 'danger', resubmitted: 'primary' })[status] || 'warning'; },
+        isReviewable(row) { return row.auditStatus !== 'approved' && row.auditStatus !== 'rejected'; },
+        async reject(row) { try { const { value } = await ElMessageBox.prompt('请输入驳回理由（可为空）', '驳回', { confirmButtonText: '确定', cancelButtonText: '取消', inputValue: '' }); const result = await request('/external-vehicles/audit', { method: 'POST', body: JSON.stringify({ id: row.id, status: 'rejected', reason: value || '' }) }); if (result.code === 0) { ElMessage.success('已驳回'); this.loadList(); } } catch (error) { if (error !== 'cancel') console.error('Reject failed:', error); } },
+        async audit(row) { try { const result = await request('/external-vehicles/audit', { method: 'POST', body: JSON.stringify({ id: row.id, status: 'approved' }) }); if (result.code === 0) { ElMessage.success('审核成功'); this.loadList(); } } catch (error) { console.error('Audit failed:', error); } },
+        async batchAudit() { try { const ids = this.selection.map(item => item.id); const result = await request('/external-vehicles/audit/batch', { method: 'POST', body: JSON.stringify({ ids, status: 'approved' }) }); if (result.failed > 0) { ElMessage.warning(`审核成功${result.succeeded}条，失败${result.failed}条`); } else { ElMessage.success('批量审核成功'); } this.loadList(); } catch (error) { console.error('Batch audit failed:', error); } },
         async dispatch(row) { try { const result = await request('/external-vehicles/dispatch', { method: 'POST', body: JSON.stringify({ ids: [row.id] }) }); if (result.code === 0) { ElMessage.success('下发成功'); this.loadList(); } } catch (error) { console.error('Dispatch failed:', error); } },
-        async batchDispatch() { const unapproved = this.selection.filter(item => item.auditStatus !== 'approved'); if (unapproved.length > 0) { ElMessage.warning('只能下发已审核的车辆'); return; } try { const ids = this.selection.map(item => item.id); const result = await request('/external-vehicles/dispatch', { method: 'POST', body: JSON.stringify({ ids }) }); if (result.code === 0) { ElMessage.success('批量下发成功'); this.loadList(); } } catch (error) { console.error('Batch dispatch failed:', error); } },
+        async batchDispatch() { const unapproved = this.selection.filter(item => item.auditStatus !== 'approved'); if (unapproved.length > 0) { ElMessage.warning('只能下发已审核的车辆'); return; } try { const ids = this.selection.map(item => item.id); const result = await request('/external-vehicles/dispatch', { method: 'POST', body: JSON.stringify({ ids }) }); if (result.failed > 0) { ElMessage.warning(`下发成功${result.succeeded}条，失败${result.failed}条`); } else { ElMessage.success('批量下发成功'); } this.loadList(); } catch (error) { console.error('Batch dispatch failed:', error); } },
         viewDetail(row) { ElMessage.info('详情功能开发中...'); }
     }
 };
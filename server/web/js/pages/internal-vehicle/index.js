@@ -58,11 +58,11 @@ const InternalVehicleManagement = {
                     <el-table-column label="照片" prop="photos" width="180" fixed="left">
                         <template #default="{ row }">
                             <div style="display:flex;flex-direction:column;gap:6px;align-items:center;">
-                                <el-image v-if="row.vehicle_photo" :src="row.vehicle_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.vehicle_photo]" />
+                                <el-image v-if="row.photo_urls && row.photo_urls.vehicle_front" :src="row.photo_urls.vehicle_front" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.vehicle_front]" />
                                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
-                                <el-image v-if="row.driving_license_photo" :src="row.driving_license_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.driving_license_photo]" />
+                                <el-image v-if="row.photo_urls && row.photo_urls.driving_license_main" :src="row.photo_urls.driving_license_main" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.driving_license_main]" />
                                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
-                                <el-image v-if="row.manifest_photo" :src="row.manifest_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.manifest_photo]" />
+                                <el-image v-if="row.photo_urls && row.photo_urls.vehicle_list" :src="row.photo_urls.vehicle_list" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.vehicle_list]" />
                                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
                             </div>
                         </template>
@@ -77,7 +77,11 @@ const InternalVehicleManagement = {
                     <el-table-column prop="brand_model" label="车辆品牌型号" width="160" />
                     <el-table-column prop="fuel_type" label="燃料类型" width="120" />
                     <el-table-column prop="emission_standard" label="排放标准" width="120" />
-                    <el-table-column prop="network_status" label="联网状态" width="100" />
+                    <el-table-column prop="network_status" label="联网状态" width="100" align="center">
+                        <template #default="{ row }">
+                            <el-tag :type="{ online: 'success', pending: 'warning', failed: 'danger' }[row.network_status] || 'info'">{{ { online: '已联网', pending: '下发中', failed: '下发失败' }[row.network_status] || '未联网' }}</el-tag>
+                        </template>
+                    </el-table-column>
                     <el-table-column prop="usage_nature" label="使用性质" width="120" />
                     <el-table-column prop="created_at" label="登记时间" width="160" />
                     <el-table-column prop="updated_at" label="修改时间" width="160" />
@@ -38,11 +38,11 @@ const NonroadManagement = {
           <el-table-column label="照片" prop="photos" width="180" fixed="left">
             <template #default="{ row }">
               <div style="display:flex;flex-direction:column;gap:6px;align-items:center;">
-                <el-image v-if="row.front_photo" :src="row.front_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.front_photo]" />
+                <el-image v-if="row.photo_urls && row.photo_urls.machine_nameplate" :src="row.photo_urls.machine_nameplate" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.machine_nameplate]" />
                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
-                <el-image v-if="row.license_photo" :src="row.license_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.license_photo]" />
+                <el-image v-if="row.photo_urls && row.photo_urls.engine_nameplate" :src="row.photo_urls.engine_nameplate" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.engine_nameplate]" />
                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
-                <el-image v-if="row.manifest_photo" :src="row.manifest_photo" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.manifest_photo]" />
+                <el-image v-if="row.photo_urls && row.photo_urls.device" :src="row.photo_urls.device" style="width:140px;height:90px;object-fit:cover;" :preview-src-list="[row.photo_urls.device]" />
                 <el-image v-else style="width:140px;height:90px;" src="/web/img/placeholder.png" />
               </div>
             </template>